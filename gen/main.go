@@ -1,58 +1,173 @@
 // Copyright 2015 go-fuzz project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
+// Package gen helps to write generators of initial corpus for go-fuzz.
+//
+// A generator is a program that creates a Generator and emits inputs until Done:
+//
+//	g := gen.New()
+//	for !g.Done() {
+//		data, valid := generate(g.Rand)
+//		if err := g.Emit(data, nil, valid); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// New parses the following flags from the command line:
+//
+//	-out dir: write valid inputs into dir/valid and invalid ones into dir/invalid;
+//	-n N: number of inputs to generate;
+//	-seed S: random seed, the same seed generates the same inputs;
+//	-stream: write inputs to stdout for go-fuzz -gen instead of -out dir
+//	(both valid and invalid inputs are added to corpus).
+//
+// The flags are not registered in flag.CommandLine, so they don't conflict with
+// flags of the program. A program with own flags can add generator flags
+// to its flag set with AddFlags, then New does not parse the command line itself:
+//
+//	gen.AddFlags(flag.CommandLine)
+//	flag.Parse()
+//	g := gen.New()
+//
+// Hint is a decimal priority of the input. It is stored in a .hint sidecar file
+// and go-fuzz uses it as the initial priority of the input.
 package gen
 
 import (
+	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"time"
+
+	. "github.com/dvyukov/go-fuzz/internal/go-fuzz-types"
 )
 
 var (
-	flagOut = flag.String("out", "", "output dir")
-	flagN   = flag.Int("n", 1000, "number of inputs to generate")
-	seq     = 0
+	flags      = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flagOut    = flags.String("out", "", "output dir")
+	flagN      = flags.Int("n", 1000, "number of inputs to generate")
+	flagSeed   = flags.Int64("seed", 0, "random seed (0 means time-based seed)")
+	flagStream = flags.Bool("stream", false, "stream inputs to stdout (used by go-fuzz -gen)")
+
+	flagsAdded bool // flags were added to a flag set of the program
 )
 
-func init() {
-	flag.Parse()
-	if *flagOut == "" {
+// ErrDone is returned by Emit when the requested number of inputs is already emitted.
+var ErrDone = errors.New("gen: all inputs are emitted")
+
+// AddFlags adds generator flags to fs. The program is responsible for parsing fs before New.
+func AddFlags(fs *flag.FlagSet) {
+	flags.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	flagsAdded = true
+}
+
+// Generator writes generated inputs either into a dir or to stdout.
+type Generator struct {
+	rand *rand.Rand
+	n    int
+	seq  int
+	out  string
+	enc  *gob.Encoder
+}
+
+// New creates a Generator configured with command line flags.
+// It parses the flags unless they were added to a flag set of the program with AddFlags.
+func New() *Generator {
+	if !flagsAdded && !flags.Parsed() {
+		flags.Parse(os.Args[1:])
+	}
+	seed := *flagSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+		// Print the seed, so that the run can be reproduced.
+		fmt.Fprintf(os.Stderr, "gen: seed %v\n", seed)
+	}
+	g := &Generator{
+		rand: rand.New(rand.NewSource(seed)),
+		n:    *flagN,
+		out:  *flagOut,
+	}
+	if *flagStream {
+		g.enc = gob.NewEncoder(os.Stdout)
+		return g
+	}
+	if g.out == "" {
 		fmt.Fprintf(os.Stderr, "output directory is not set\n")
 		os.Exit(1)
 	}
-	if err := os.MkdirAll(*flagOut, 0760); err != nil {
-		fmt.Fprintf(os.Stderr, "mkdir failed: %v\n", err)
-		os.Exit(1)
+	for _, dir := range []string{"valid", "invalid"} {
+		if err := os.MkdirAll(filepath.Join(g.out, dir), 0760); err != nil {
+			fmt.Fprintf(os.Stderr, "mkdir failed: %v\n", err)
+			os.Exit(1)
+		}
 	}
-	rand.Seed(time.Now().UnixNano())
+	return g
 }
 
-func Rand(n int) int {
-	return rand.Intn(n)
+// Rand returns a pseudo-random number in [0, n).
+func (g *Generator) Rand(n int) int {
+	return g.rand.Intn(n)
 }
 
-func Emit(data, hint []byte, valid bool) {
-	f, err := os.Create(filepath.Join(*flagOut, fmt.Sprintf("%d", seq)))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to create file: %v\n", err)
-		os.Exit(1)
-	}
-	defer f.Close()
+// Done says whether the requested number of inputs is emitted.
+func (g *Generator) Done() bool {
+	return g.seq >= g.n
+}
 
-	n, err := f.Write(data)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to write to file: %v\n", err)
-		os.Exit(1)
-	} else if n != len(data) {
-		fmt.Fprint(os.Stderr, "failed to write data to file\n")
-		os.Exit(1)
+// Emit writes the input.
+// valid selects the output subdir, with -stream it is ignored.
+// It returns ErrDone if the requested number of inputs is already emitted.
+func (g *Generator) Emit(data, hint []byte, valid bool) error {
+	if g.Done() {
+		return ErrDone
+	}
+	g.seq++
+	if g.enc != nil {
+		return g.enc.Encode(GenRecord{Data: data, Hint: hint})
+	}
+	dir := "invalid"
+	if valid {
+		dir = "valid"
 	}
+	fname := filepath.Join(g.out, dir, fmt.Sprintf("%d", g.seq))
+	if err := ioutil.WriteFile(fname, data, 0660); err != nil {
+		return err
+	}
+	if len(hint) != 0 {
+		if err := ioutil.WriteFile(fname+".hint", hint, 0660); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var std *Generator
 
-	if seq++; seq == *flagN {
-		os.Exit(0)
+func stdGenerator() *Generator {
+	if std == nil {
+		std = New()
 	}
+	return std
+}
+
+// Rand returns a pseudo-random number in [0, n) from the default generator.
+func Rand(n int) int {
+	return stdGenerator().Rand(n)
+}
+
+// Done says whether the default generator emitted the requested number of inputs.
+func Done() bool {
+	return stdGenerator().Done()
+}
+
+// Emit writes the input with the default generator, see Generator.Emit.
+func Emit(data, hint []byte, valid bool) error {
+	return stdGenerator().Emit(data, hint, valid)
 }
@@ -0,0 +1,125 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/internal/go-fuzz-types"
+)
+
+// generate emits n inputs with the given seed into dir and returns them.
+func generate(t *testing.T, dir string, seed int64, n int) [][]byte {
+	// Command line of the test binary contains test flags.
+	if err := flags.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	*flagSeed, *flagN, *flagOut = seed, n, dir
+	g := New()
+	var inputs [][]byte
+	for !g.Done() {
+		data := []byte{byte(g.Rand(256)), byte(g.Rand(256))}
+		var hint []byte
+		if data[0]%2 == 0 {
+			hint = []byte("100")
+		}
+		if err := g.Emit(data, hint, data[1]%2 == 0); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, data)
+	}
+	return inputs
+}
+
+func TestGenerator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-fuzz-gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const n = 100
+	inputs := generate(t, dir, 1, n)
+	if len(inputs) != n {
+		t.Fatalf("generated %v inputs, want %v", len(inputs), n)
+	}
+	if !reflect.DeepEqual(inputs, generate(t, filepath.Join(dir, "2"), 1, n)) {
+		t.Fatalf("the same seed generates different inputs")
+	}
+	if reflect.DeepEqual(inputs, generate(t, filepath.Join(dir, "3"), 2, n)) {
+		t.Fatalf("different seeds generate the same inputs")
+	}
+	for i, data := range inputs {
+		bucket := "invalid"
+		if data[1]%2 == 0 {
+			bucket = "valid"
+		}
+		fname := filepath.Join(dir, bucket, fmt.Sprint(i+1))
+		got, err := ioutil.ReadFile(fname)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("input #%v: bad file %v: %q, %v", i, fname, got, err)
+		}
+		hint, err := ioutil.ReadFile(fname + ".hint")
+		if data[0]%2 == 0 && (err != nil || string(hint) != "100") {
+			t.Fatalf("input #%v: bad hint %q, %v", i, hint, err)
+		}
+		if data[0]%2 != 0 && err == nil {
+			t.Fatalf("input #%v: unexpected hint file", i)
+		}
+	}
+}
+
+func TestGeneratorStream(t *testing.T) {
+	var buf bytes.Buffer
+	g := &Generator{n: 2, enc: gob.NewEncoder(&buf)}
+	if err := g.Emit([]byte("foo"), []byte("10"), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Emit([]byte("bar"), nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Done() {
+		t.Fatalf("generator is not done after %v inputs", g.seq)
+	}
+	if err := g.Emit([]byte("baz"), nil, true); err != ErrDone {
+		t.Fatalf("emit after done returned %v, want ErrDone", err)
+	}
+	dec := gob.NewDecoder(&buf)
+	var recs []GenRecord
+	for {
+		var rec GenRecord
+		if err := dec.Decode(&rec); err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+		recs = append(recs, rec)
+	}
+	want := []GenRecord{{Data: []byte("foo"), Hint: []byte("10")}, {Data: []byte("bar")}}
+	if !reflect.DeepEqual(recs, want) {
+		t.Fatalf("got records %+v, want %+v", recs, want)
+	}
+}
+
+func TestAddFlags(t *testing.T) {
+	defer func(n int) { *flagN, flagsAdded = n, false }(*flagN)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagX := fs.Int("x", 0, "program flag")
+	AddFlags(fs)
+	if err := fs.Parse([]string{"-x=1", "-n=3"}); err != nil {
+		t.Fatal(err)
+	}
+	if *flagX != 1 || *flagN != 3 {
+		t.Fatalf("bad parsed flags: x=%v n=%v", *flagX, *flagN)
+	}
+}
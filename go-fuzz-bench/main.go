@@ -0,0 +1,301 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// go-fuzz-bench measures efficiency of go-fuzz. It runs go-fuzz on a suite of targets
+// with several seeds for a fixed time or number of executions, and reports coverage
+// over time and time to the first crash. If two go-fuzz builds are given, it also
+// compares them with Mann-Whitney U test.
+//
+// Usage:
+//
+//	go-fuzz-bench -builds=old/bin,new/bin -time=10m -seeds=10
+//
+// where old/bin and new/bin contain go-fuzz and go-fuzz-build binaries
+// (e.g. installed with GOBIN=old/bin go install ./go-fuzz ./go-fuzz-build).
+// All samples are also saved in workdir/samples.csv for plotting.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	flagBuilds        = flag.String("builds", "", "comma-separated list of 1 or 2 dirs with go-fuzz and go-fuzz-build binaries (default: binaries from PATH)")
+	flagTargets       = flag.String("targets", strings.Join(defaultTargets, ","), "comma-separated list of targets (pkg or pkg:FuzzFunc)")
+	flagWorkdir       = flag.String("workdir", "", "dir for go-fuzz workdirs and results (default: a temp dir)")
+	flagSeeds         = flag.Int("seeds", 5, "number of runs with different seeds per target and build")
+	flagTime          = flag.Duration("time", 0, "time budget of a run (default 1m unless -execs is set)")
+	flagExecs         = flag.Uint64("execs", 0, "exec budget of a run, curves are reported over execs rather than time if set (0 means no limit)")
+	flagProcs         = flag.Int("procs", 1, "go-fuzz -procs value")
+	flagParallel      = flag.Int("parallel", 1, "number of go-fuzz processes to run concurrently")
+	flagDeterministic = flag.Bool("deterministic", false, "run go-fuzz with -deterministic")
+	flagPoints        = flag.Int("points", 10, "number of points of reported coverage curves")
+)
+
+// defaultTargets is the bundled benchmark suite.
+// Targets in go-fuzz-bench/targets have planted bugs of various difficulty.
+var defaultTargets = []string{
+	"github.com/dvyukov/go-fuzz/test",
+	"github.com/dvyukov/go-fuzz/go-fuzz-bench/targets/regexp",
+	"github.com/dvyukov/go-fuzz/go-fuzz-bench/targets/chunks",
+}
+
+func main() {
+	flag.Parse()
+	if *flagTime == 0 && *flagExecs == 0 {
+		*flagTime = time.Minute
+	}
+	if *flagSeeds <= 0 || *flagParallel <= 0 || *flagPoints <= 0 {
+		log.Fatalf("bad -seeds, -parallel or -points value")
+	}
+	var builds []*Build
+	if *flagBuilds == "" {
+		builds = append(builds, &Build{Name: "A"})
+	} else {
+		for i, dir := range strings.Split(*flagBuilds, ",") {
+			builds = append(builds, &Build{Name: string('A' + rune(i)), Dir: dir})
+		}
+	}
+	if len(builds) > 2 {
+		log.Fatalf("at most 2 builds can be compared")
+	}
+	var targets []Target
+	for _, t := range strings.Split(*flagTargets, ",") {
+		targets = append(targets, parseTarget(t))
+	}
+	workdir := *flagWorkdir
+	if workdir == "" {
+		dir, err := ioutil.TempDir("", "go-fuzz-bench")
+		if err != nil {
+			log.Fatalf("failed to create workdir: %v", err)
+		}
+		workdir = dir
+	}
+	for _, b := range builds {
+		log.Printf("build %v: %v", b.Name, b.tool("go-fuzz"))
+		b.probe()
+		if *flagDeterministic && !b.Deterministic {
+			log.Fatalf("build %v: go-fuzz does not support -deterministic", b.Name)
+		}
+		if !b.Seed {
+			log.Printf("build %v: go-fuzz does not support -seed, runs use random seeds", b.Name)
+		}
+	}
+
+	// Build all targets first, go-fuzz-build is too heavy to run concurrently with go-fuzz.
+	bins := make(map[*Build][]string)
+	for _, b := range builds {
+		for i, t := range targets {
+			dir := filepath.Join(workdir, b.Name, fmt.Sprint(i))
+			mkdirAll(dir)
+			log.Printf("build %v: building %v", b.Name, t)
+			bins[b] = append(bins[b], buildTarget(b, t, dir))
+		}
+	}
+
+	// Runs of different builds interleave, so that changing machine load affects them equally.
+	var runs []*Run
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan bool, *flagParallel)
+	for i, t := range targets {
+		for seed := 1; seed <= *flagSeeds; seed++ {
+			for _, b := range builds {
+				b, t, bin, seed := b, t, bins[b][i], seed
+				wd := filepath.Join(workdir, b.Name, fmt.Sprint(i), fmt.Sprint(seed))
+				mkdirAll(wd)
+				sem <- true
+				wg.Add(1)
+				go func() {
+					defer func() {
+						<-sem
+						wg.Done()
+					}()
+					log.Printf("build %v: fuzzing %v with seed %v", b.Name, t, seed)
+					run := runFuzzer(b, t, bin, seed, wd)
+					mu.Lock()
+					runs = append(runs, run)
+					mu.Unlock()
+				}()
+			}
+		}
+	}
+	wg.Wait()
+	sort.Slice(runs, func(i, j int) bool {
+		ri, rj := runs[i], runs[j]
+		if ri.Build != rj.Build {
+			return ri.Build.Name < rj.Build.Name
+		}
+		if ri.Target != rj.Target {
+			return ri.Target.String() < rj.Target.String()
+		}
+		return ri.Seed < rj.Seed
+	})
+
+	samples := filepath.Join(workdir, "samples.csv")
+	writeSamples(samples, runs)
+	for _, t := range targets {
+		report(os.Stdout, t, builds, runs)
+	}
+	fmt.Printf("all samples are saved in %v\n", samples)
+}
+
+// x returns position of the sample on the budget axis: seconds, or execs with -execs.
+func x(s Sample) float64 {
+	if *flagExecs != 0 {
+		return float64(s.Execs)
+	}
+	return s.Time.Seconds()
+}
+
+func fmtX(v float64) string {
+	switch {
+	case math.IsInf(v, 0) || math.IsNaN(v):
+		return "-"
+	case *flagExecs != 0:
+		return fmt.Sprintf("%.0f execs", v)
+	default:
+		return time.Duration(v * float64(time.Second)).Round(time.Second).String()
+	}
+}
+
+// metrics returns final coverage and position of the first crash (+Inf if none) of each run.
+func metrics(runs []*Run) (cover, crash []float64) {
+	for _, r := range runs {
+		cover = append(cover, float64(r.final().Cover))
+		if s, ok := r.firstCrash(); ok {
+			crash = append(crash, x(s))
+		} else {
+			crash = append(crash, math.Inf(1))
+		}
+	}
+	return
+}
+
+func report(w io.Writer, t Target, builds []*Build, all []*Run) {
+	byBuild := make(map[*Build][]*Run)
+	for _, r := range all {
+		if r.Target == t {
+			byBuild[r.Build] = append(byBuild[r.Build], r)
+		}
+	}
+	fmt.Fprintf(w, "\n%v\n", t)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "build\truns\tcover (median)\tcover (min-max)\texecs (median)\tcrashed\tfirst crash (median)\n")
+	for _, b := range builds {
+		runs := byBuild[b]
+		cover, crash := metrics(runs)
+		var execs []float64
+		crashed := 0
+		for i, r := range runs {
+			execs = append(execs, float64(r.final().Execs))
+			if !math.IsInf(crash[i], 1) {
+				crashed++
+			}
+		}
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, c := range cover {
+			lo, hi = math.Min(lo, c), math.Max(hi, c)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%.0f\t%.0f-%.0f\t%.0f\t%v/%v\t%v\n", b.Name, len(runs), median(cover),
+			lo, hi, median(execs), crashed, len(runs), fmtX(median(crash)))
+	}
+	tw.Flush()
+	for _, b := range builds {
+		if !b.Seed {
+			fmt.Fprintf(w, "build %v does not support -seed, its runs use random seeds\n", b.Name)
+		}
+	}
+
+	if len(builds) == 2 {
+		coverA, crashA := metrics(byBuild[builds[0]])
+		coverB, crashB := metrics(byBuild[builds[1]])
+		// A12 is probability that B is better than A: more cover, less time to the first crash.
+		p, a12 := mannWhitney(coverB, coverA)
+		fmt.Fprintf(w, "B vs A: cover p=%.3f A12=%.2f", p, a12)
+		p, a12 = mannWhitney(negate(crashB), negate(crashA))
+		fmt.Fprintf(w, ", first crash p=%.3f A12=%.2f\n", p, a12)
+	}
+
+	// Median coverage curves.
+	axis, budget := "time", flagTime.Seconds()
+	if *flagExecs != 0 {
+		axis, budget = "execs", float64(*flagExecs)
+	}
+	fmt.Fprintf(w, "median cover over %v:\n", axis)
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "%v", axis)
+	for _, b := range builds {
+		fmt.Fprintf(tw, "\t%v", b.Name)
+	}
+	fmt.Fprintf(tw, "\n")
+	for i := 1; i <= *flagPoints; i++ {
+		point := budget * float64(i) / float64(*flagPoints)
+		fmt.Fprintf(tw, "%v", fmtX(point))
+		for _, b := range builds {
+			var cover []float64
+			for _, r := range byBuild[b] {
+				v := 0.0
+				for _, s := range r.Samples {
+					if x(s) <= point {
+						v = float64(s.Cover)
+					}
+				}
+				cover = append(cover, v)
+			}
+			fmt.Fprintf(tw, "\t%.0f", median(cover))
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	tw.Flush()
+}
+
+func negate(values []float64) []float64 {
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = -v
+	}
+	return res
+}
+
+// writeSamples writes all samples of all runs into a CSV file.
+func writeSamples(file string, runs []*Run) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Fatalf("failed to create samples file: %v", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"build", "target", "seed", "seconds", "execs", "cover", "corpus", "crashers"})
+	for _, r := range runs {
+		for _, s := range r.Samples {
+			w.Write([]string{r.Build.Name, r.Target.String(), fmt.Sprint(r.Seed), fmt.Sprintf("%.1f", s.Time.Seconds()),
+				fmt.Sprint(s.Execs), fmt.Sprint(s.Cover), fmt.Sprint(s.Corpus), fmt.Sprint(s.Crashers)})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalf("failed to write samples file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("failed to write samples file: %v", err)
+	}
+}
+
+func mkdirAll(dir string) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Fatalf("failed to create dir: %v", err)
+	}
+}
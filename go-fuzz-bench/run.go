@@ -0,0 +1,259 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Build is a go-fuzz build under benchmark: a dir with go-fuzz and go-fuzz-build binaries.
+type Build struct {
+	Name string // short name used in reports
+	Dir  string // empty means binaries from PATH
+
+	// Flags supported by go-fuzz of the build, older builds don't have them.
+	Seed          bool
+	Deterministic bool
+}
+
+func (b *Build) tool(name string) string {
+	if b.Dir == "" {
+		return name
+	}
+	return filepath.Join(b.Dir, name)
+}
+
+// probe finds out which go-fuzz flags the build supports.
+func (b *Build) probe() {
+	// Exit status of -help differs between Go versions, so it is ignored.
+	out, err := exec.Command(b.tool("go-fuzz"), "-help").CombinedOutput()
+	if _, ok := err.(*exec.Error); ok {
+		log.Fatalf("build %v: failed to run go-fuzz: %v", b.Name, err)
+	}
+	b.Seed = bytes.Contains(out, []byte("-seed "))
+	b.Deterministic = bytes.Contains(out, []byte("-deterministic"))
+}
+
+// Target is a fuzz function to benchmark, specified as pkg or pkg:Func on command line.
+type Target struct {
+	Pkg  string
+	Func string
+}
+
+func parseTarget(s string) Target {
+	t := Target{Pkg: s}
+	if i := strings.LastIndexByte(s, ':'); i != -1 {
+		t.Pkg, t.Func = s[:i], s[i+1:]
+	}
+	return t
+}
+
+func (t Target) String() string {
+	if t.Func == "" {
+		return t.Pkg
+	}
+	return t.Pkg + ":" + t.Func
+}
+
+// Sample is a point of a coverage curve, parsed from go-fuzz stats output.
+type Sample struct {
+	Time     time.Duration // since go-fuzz start
+	Execs    uint64
+	Cover    uint64
+	Corpus   uint64
+	Crashers uint64
+}
+
+// Run is the result of one go-fuzz run.
+type Run struct {
+	Build      *Build
+	Target     Target
+	Seed       int
+	Samples    []Sample
+	FirstCrash time.Duration // when the first crasher appeared in workdir, 0 if none
+}
+
+// final returns the last sample of the run.
+func (r *Run) final() Sample {
+	if len(r.Samples) == 0 {
+		return Sample{}
+	}
+	return r.Samples[len(r.Samples)-1]
+}
+
+// firstCrash returns the first sample with a crasher. Stats lines are printed
+// every 3 seconds, so time of the sample is replaced with the time when
+// the crasher appeared in workdir. Execs are known only from stats lines.
+func (r *Run) firstCrash() (Sample, bool) {
+	for _, s := range r.Samples {
+		if s.Crashers != 0 {
+			if r.FirstCrash != 0 {
+				s.Time = r.FirstCrash
+			}
+			return s, true
+		}
+	}
+	if r.FirstCrash != 0 {
+		// Fuzzing was stopped before the next stats line.
+		s := r.final()
+		s.Time = r.FirstCrash
+		return s, true
+	}
+	return Sample{}, false
+}
+
+// statsRe matches stats lines that go-fuzz prints every 3 seconds, e.g.:
+// workers: 1, corpus: 12 (3s ago), crashers: 0, restarts: 1/0, execs: 4321 (1440/sec), cover: 98, uptime: 3s
+var statsRe = regexp.MustCompile(`corpus: (\d+) .*crashers: (\d+),.* execs: (\d+) .*cover: (\d+)`)
+
+// parseStats parses go-fuzz stats line.
+func parseStats(line string) (s Sample, ok bool) {
+	m := statsRe.FindStringSubmatch(line)
+	if m == nil {
+		return s, false
+	}
+	var vals [4]uint64
+	for i := range vals {
+		v, err := strconv.ParseUint(m[i+1], 10, 64)
+		if err != nil {
+			return s, false
+		}
+		vals[i] = v
+	}
+	s.Corpus, s.Crashers, s.Execs, s.Cover = vals[0], vals[1], vals[2], vals[3]
+	return s, true
+}
+
+// buildTarget builds the target with go-fuzz-build of build b and returns the archive path.
+func buildTarget(b *Build, t Target, dir string) string {
+	out := filepath.Join(dir, "fuzz.zip")
+	args := []string{"-o", out}
+	if t.Func != "" {
+		args = append(args, "-func", t.Func)
+	}
+	args = append(args, t.Pkg)
+	if output, err := exec.Command(b.tool("go-fuzz-build"), args...).CombinedOutput(); err != nil {
+		log.Fatalf("build %v: failed to build %v: %v\n%s", b.Name, t, err, output)
+	}
+	return out
+}
+
+// runFuzzer runs go-fuzz of build b on archive bin with the given seed in workdir
+// until the time or exec budget is exhausted. go-fuzz output is saved in workdir/log.
+func runFuzzer(b *Build, t Target, bin string, seed int, workdir string) *Run {
+	args := []string{
+		"-bin", bin,
+		"-workdir", workdir,
+		"-procs", fmt.Sprint(*flagProcs),
+	}
+	if b.Seed {
+		args = append(args, "-seed", fmt.Sprint(seed))
+	}
+	if *flagDeterministic {
+		args = append(args, "-deterministic")
+	}
+	if t.Func != "" {
+		args = append(args, "-func", t.Func)
+	}
+	logf, err := os.Create(filepath.Join(workdir, "log"))
+	if err != nil {
+		log.Fatalf("failed to create log file: %v", err)
+	}
+	defer logf.Close()
+	r, w := io.Pipe()
+	cmd := exec.Command(b.tool("go-fuzz"), args...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("build %v: failed to start go-fuzz: %v", b.Name, err)
+	}
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		w.Close()
+		done <- err
+	}()
+
+	run := &Run{Build: b, Target: t, Seed: seed}
+	stopCrashers := make(chan bool)
+	crashers := watchCrashers(filepath.Join(workdir, "crashers"), start, stopCrashers)
+	stopped := false
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fmt.Fprintln(logf, s.Text())
+		sample, ok := parseStats(s.Text())
+		if !ok || stopped {
+			continue
+		}
+		sample.Time = time.Since(start)
+		run.Samples = append(run.Samples, sample)
+		if *flagTime != 0 && sample.Time >= *flagTime || *flagExecs != 0 && sample.Execs >= *flagExecs {
+			stopped = true
+			close(stopCrashers)
+			stop(cmd)
+		}
+	}
+	io.Copy(ioutil.Discard, r)
+	if !stopped {
+		close(stopCrashers)
+	}
+	run.FirstCrash = <-crashers
+	if err := <-done; err != nil && !stopped {
+		log.Fatalf("build %v: go-fuzz failed on %v (seed %v): %v, see %v",
+			b.Name, t, seed, err, filepath.Join(workdir, "log"))
+	}
+	return run
+}
+
+// crasherPollPeriod is how often watchCrashers checks workdir for crashers.
+const crasherPollPeriod = 100 * time.Millisecond
+
+// watchCrashers polls dir until a file appears in it or stop is closed.
+// The returned channel receives time since start when the first file appeared, or 0.
+func watchCrashers(dir string, start time.Time, stop chan bool) chan time.Duration {
+	res := make(chan time.Duration, 1)
+	go func() {
+		ticker := time.NewTicker(crasherPollPeriod)
+		defer ticker.Stop()
+		for {
+			if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+				res <- time.Since(start)
+				return
+			}
+			select {
+			case <-stop:
+				res <- 0
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return res
+}
+
+// stop asks go-fuzz to shut down and kills it if it does not exit in time.
+func stop(cmd *exec.Cmd) {
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		// Interrupt is not supported on windows.
+		cmd.Process.Kill()
+		return
+	}
+	p := cmd.Process
+	time.AfterFunc(30*time.Second, func() {
+		p.Kill()
+	})
+}
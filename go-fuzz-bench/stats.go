@@ -0,0 +1,114 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// maxExactSamples is the max size of samples for which the exact distribution
+// of Mann-Whitney U statistic is used, larger samples use normal approximation.
+const maxExactSamples = 30
+
+// mannWhitney compares samples x and y with two-sided Mann-Whitney U test.
+// It returns the p-value and Vargha-Delaney A12 effect size, that is,
+// probability that a random value from x is larger than a random value from y
+// (0.5 means no difference).
+func mannWhitney(x, y []float64) (p, a12 float64) {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1, 0.5
+	}
+	// U statistic of x is the number of pairs where x wins, ties count as halves.
+	u := 0.0
+	for _, v1 := range x {
+		for _, v2 := range y {
+			if v1 > v2 {
+				u += 1
+			} else if v1 == v2 {
+				u += 0.5
+			}
+		}
+	}
+	a12 = u / float64(n1*n2)
+
+	all := append(append([]float64{}, x...), y...)
+	sort.Float64s(all)
+	ties := 0.0 // sum of t^3-t for groups of t equal values
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j] == all[i] {
+			j++
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	if ties == 0 && n1 <= maxExactSamples && n2 <= maxExactSamples {
+		return exactU(n1, n2, u), a12
+	}
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * (n + 1 - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1, a12
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma // with continuity correction
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2), a12
+}
+
+// exactU returns two-sided p-value for U statistic u of samples of sizes n1 and n2 without ties.
+func exactU(n1, n2 int, u float64) float64 {
+	// dist[i][j][k] is the number of arrangements of i and j values with U statistic k,
+	// U(i, j) = U(i-1, j) + j (the largest value is from x) or U(i, j-1) (it is from y).
+	dist := make([][][]float64, n1+1)
+	for i := range dist {
+		dist[i] = make([][]float64, n2+1)
+		for j := range dist[i] {
+			dist[i][j] = make([]float64, i*j+1)
+			if i == 0 || j == 0 {
+				dist[i][j][0] = 1
+				continue
+			}
+			for k := range dist[i][j] {
+				if k >= j && k-j < len(dist[i-1][j]) {
+					dist[i][j][k] += dist[i-1][j][k-j]
+				}
+				if k < len(dist[i][j-1]) {
+					dist[i][j][k] += dist[i][j-1][k]
+				}
+			}
+		}
+	}
+	counts := dist[n1][n2]
+	total, lower, upper := 0.0, 0.0, 0.0
+	for k, c := range counts {
+		total += c
+		if float64(k) <= u {
+			lower += c
+		}
+		if float64(k) >= u {
+			upper += c
+		}
+	}
+	return math.Min(1, 2*math.Min(lower, upper)/total)
+}
+
+// median returns median of values (NaN for empty values).
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		x, y []float64
+		p    float64
+		a12  float64
+	}{
+		// Exact distribution: 2 of C(6,3)=20 arrangements are as extreme.
+		{[]float64{4, 5, 6}, []float64{1, 2, 3}, 0.1, 1},
+		{[]float64{1, 2, 3}, []float64{4, 5, 6}, 0.1, 0},
+		// 2 of C(10,5)=252.
+		{[]float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 2.0 / 252, 1},
+		// U=5 for x, P(U<=4)=P(U>=5)=1/2 for sizes 3 and 3.
+		{[]float64{1, 4, 6}, []float64{2, 3, 5}, 1, 5.0 / 9},
+		// Ties use normal approximation, equal samples are not different.
+		{[]float64{1, 1, 2, 2}, []float64{1, 1, 2, 2}, 1, 0.5},
+		{[]float64{3, 3, 3}, []float64{3, 3, 3}, 1, 0.5},
+		// Censored values (no crash): U=1.5, sigma=sqrt(9/12*(7-60/30)), z=(3-0.5)/sigma.
+		{[]float64{1, 2, math.Inf(1)}, []float64{math.Inf(1), math.Inf(1), math.Inf(1)}, 0.197, 1.0 / 6},
+	}
+	for i, test := range tests {
+		p, a12 := mannWhitney(test.x, test.y)
+		if math.Abs(p-test.p) > 1e-3 || math.Abs(a12-test.a12) > 1e-9 {
+			t.Errorf("#%v: got p=%v a12=%v, want p=%v a12=%v", i, p, a12, test.p, test.a12)
+		}
+	}
+}
+
+func TestMannWhitneyLarge(t *testing.T) {
+	// Shifted samples of size 50 use normal approximation.
+	var x, y []float64
+	for i := 0; i < 50; i++ {
+		x = append(x, float64(i))
+		y = append(y, float64(i)+25.5)
+	}
+	if p, a12 := mannWhitney(x, y); p > 1e-4 || a12 > 0.3 {
+		t.Errorf("shifted samples: p=%v a12=%v", p, a12)
+	}
+	if p, _ := mannWhitney(x, x); p < 0.99 {
+		t.Errorf("equal samples: p=%v", p)
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	line := "2015/05/07 12:00:03 workers: 8, corpus: 123 (3s ago), crashers: 2, restarts: 1/9876," +
+		" execs: 456789 (15226/sec), cover: 1011, uptime: 30s"
+	s, ok := parseStats(line)
+	if !ok || s.Corpus != 123 || s.Crashers != 2 || s.Execs != 456789 || s.Cover != 1011 {
+		t.Fatalf("bad parsed stats: %+v", s)
+	}
+	if _, ok := parseStats("2015/05/07 12:00:03 hub: corpus=1 bootstrap=1 fuzz=0"); ok {
+		t.Fatalf("parsed non-stats line")
+	}
+}
+
+func TestFirstCrash(t *testing.T) {
+	r := &Run{Samples: []Sample{
+		{Time: 3 * time.Second, Execs: 100},
+		{Time: 6 * time.Second, Execs: 200, Crashers: 1},
+	}}
+	if s, ok := r.firstCrash(); !ok || s.Time != 6*time.Second || s.Execs != 200 {
+		t.Errorf("bad first crash: %+v, %v", s, ok)
+	}
+	// Time when the crasher appeared in workdir is more precise.
+	r.FirstCrash = 4 * time.Second
+	if s, ok := r.firstCrash(); !ok || s.Time != 4*time.Second || s.Execs != 200 {
+		t.Errorf("bad first crash: %+v, %v", s, ok)
+	}
+	r.Samples = r.Samples[:1]
+	if s, ok := r.firstCrash(); !ok || s.Time != 4*time.Second || s.Execs != 100 {
+		t.Errorf("bad first crash without stats: %+v, %v", s, ok)
+	}
+	r.FirstCrash = 0
+	if s, ok := r.firstCrash(); ok {
+		t.Errorf("unexpected first crash: %+v", s)
+	}
+}
+
+func TestWatchCrashers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-fuzz-bench-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stop := make(chan bool)
+	crashers := watchCrashers(dir, time.Now(), stop)
+	time.Sleep(2 * crasherPollPeriod)
+	if err := ioutil.WriteFile(filepath.Join(dir, "crasher"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if d := <-crashers; d < 2*crasherPollPeriod {
+		t.Errorf("crasher is detected too early: %v", d)
+	}
+	close(stop)
+	if d := <-watchCrashers(filepath.Join(dir, "nonexistent"), time.Now(), stop); d != 0 {
+		t.Errorf("crasher is detected in a nonexistent dir: %v", d)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package chunks is a PNG-like chunked format with bugs planted behind
+// obstacles that are hard for blind mutations: a magic signature,
+// length fields, multi-byte tags, checksums and bit fields.
+package chunks
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+const signature = "\x89CHK\r\n"
+
+func Fuzz(data []byte) int {
+	if len(data) < len(signature) || string(data[:len(signature)]) != signature {
+		return 0
+	}
+	data = data[len(signature):]
+	var version byte
+	for len(data) != 0 {
+		// Chunk: length (4 bytes BE), tag (4 bytes), payload, CRC32 of tag and payload (4 bytes).
+		if len(data) < 12 {
+			return 0
+		}
+		n := binary.BigEndian.Uint32(data)
+		if n > uint32(len(data)-12) {
+			return 0
+		}
+		tag, payload := string(data[4:8]), data[8:8+n]
+		if crc32.ChecksumIEEE(data[4:8+n]) != binary.BigEndian.Uint32(data[8+n:]) {
+			return 0
+		}
+		data = data[12+n:]
+		switch tag {
+		case "HEAD":
+			if len(payload) != 2 {
+				return 0
+			}
+			version = payload[0]
+			// Planted bug 1: flags 0x5 in the high nibble of the second byte.
+			if version == 3 && (payload[1]>>4)&7 == 5 {
+				panic("bad flags")
+			}
+		case "TEXT":
+			// Planted bug 2: a keyword in a text chunk of version 2.
+			if version == 2 && string(payload) == "overflow" {
+				var buf [4]byte
+				_ = buf[len(payload)]
+			}
+		case "LIST":
+			// Planted bug 3: the number of entries disagrees with the payload size.
+			if len(payload) < 2 {
+				return 0
+			}
+			cnt := int(binary.LittleEndian.Uint16(payload))
+			entries := make([]uint16, 0, 4)
+			for i := 0; i < cnt && 2+2*i+2 <= len(payload); i++ {
+				entries = append(entries, binary.LittleEndian.Uint16(payload[2+2*i:]))
+			}
+			if cnt == 0xabcd {
+				_ = entries[cnt]
+			}
+		default:
+			return 0
+		}
+	}
+	return 1
+}
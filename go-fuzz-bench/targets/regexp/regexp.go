@@ -0,0 +1,29 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package regexp is the regexp example from the slides, it measures coverage growth
+// on a large parser without planted bugs.
+package regexp
+
+import (
+	"regexp"
+)
+
+func Fuzz(data []byte) int {
+	if len(data) < 3 {
+		return 0
+	}
+	longestMode := data[0]%2 != 0  // first byte as "longest" flag
+	reStr := data[1 : len(data)/2] // half as regular expression
+	matchStr := data[len(data)/2:] // the rest is string to match
+
+	re, err := regexp.Compile(string(reStr))
+	if err != nil {
+		return 0
+	}
+	if longestMode {
+		re.Longest()
+	}
+	re.FindAll(matchStr, -1)
+	return 1
+}
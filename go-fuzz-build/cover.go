@@ -8,6 +8,7 @@ import (
 	"crypto/sha1"
 	"fmt"
 	"go/ast"
+	"go/build"
 	"go/constant"
 	"go/printer"
 	"go/token"
@@ -22,7 +23,7 @@ import (
 
 const fuzzdepPkg = "_go_fuzz_dep_"
 
-func instrument(pkg, fullName string, fset *token.FileSet, parsedFile *ast.File, info *types.Info, out io.Writer, blocks *[]CoverBlock, sonar *[]CoverBlock) {
+func instrument(pkg, fullName string, fset *token.FileSet, parsedFile *ast.File, info *types.Info, out io.Writer, blocks *[]CoverBlock, sonar *[]CoverBlock, valueProfile bool) {
 	file := &File{
 		fset:     fset,
 		pkg:      pkg,
@@ -31,14 +32,31 @@ func instrument(pkg, fullName string, fset *token.FileSet, parsedFile *ast.File,
 		blocks:   blocks,
 		info:     info,
 	}
-	if sonar == nil {
+	// Both passes run if blocks and sonar are set (go-fuzz-build -single).
+	if blocks != nil {
 		file.addImport("go-fuzz-dep", fuzzdepPkg, "CoverTab")
 		ast.Walk(file, file.astFile)
-	} else {
+		if valueProfile {
+			// Comparisons are instrumented after coverage, so that the generated code does not get counters.
+			// The sonar pass needs the original comparisons, so we restore them after printing.
+			vp := &Sonar{
+				fset:         fset,
+				fullName:     fullName,
+				pkg:          pkg,
+				astFile:      parsedFile,
+				info:         info,
+				valueProfile: true,
+			}
+			ast.Walk(vp, file.astFile)
+			defer vp.restoreAST()
+		}
+	}
+	if sonar != nil {
 		s := &Sonar{
 			fset:     fset,
 			fullName: fullName,
 			pkg:      pkg,
+			astFile:  parsedFile,
 			blocks:   sonar,
 			info:     info,
 		}
@@ -52,14 +70,27 @@ type Sonar struct {
 	fset     *token.FileSet
 	fullName string
 	pkg      string
+	astFile  *ast.File
 	blocks   *[]CoverBlock
 	info     *types.Info
+
+	// In value profile mode comparisons are instrumented with go-fuzz-dep.ValueProfile calls
+	// for the coverage binary instead of sonar.
+	valueProfile bool
+	restore      []func() // undo comparison instrumentation in value profile mode
 }
 
 var sonarSeq = 0
+var valueProfileSeq = 0
+
+func (s *Sonar) restoreAST() {
+	for _, f := range s.restore {
+		f()
+	}
+	s.restore = nil
+}
 
 func (s *Sonar) Visit(n ast.Node) ast.Visitor {
-	// TODO: detect "x&mask==0", emit sonar(x, x&^mask)
 	switch nn := n.(type) {
 	case *ast.BinaryExpr:
 		break
@@ -73,6 +104,35 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 	case *ast.SelectorExpr:
 		return nil
 
+	case *ast.AssignStmt:
+		// Map index expressions on the left side are stores, not lookups.
+		for _, lhs := range nn.Lhs {
+			s.walkStore(lhs)
+		}
+		for _, rhs := range nn.Rhs {
+			ast.Walk(s, rhs)
+		}
+		return nil
+
+	case *ast.IncDecStmt:
+		s.walkStore(nn.X)
+		return nil
+
+	case *ast.IndexExpr:
+		if s.valueProfile {
+			return s // recurse
+		}
+		ast.Walk(s, nn.X)
+		ast.Walk(s, nn.Index)
+		s.instrumentMapIndex(nn)
+		return nil
+
+	case *ast.CallExpr:
+		if s.valueProfile || !s.instrumentLibraryCall(nn) {
+			return s // recurse
+		}
+		return nil
+
 	case *ast.SwitchStmt:
 		if nn.Tag == nil || nn.Body == nil {
 			return s // recurse
@@ -159,37 +219,13 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 		return s // recurse
 	}
 
-	// TODO: handle map index expressions (especially useful for strings).
-	// E.g. when code matches a read in identifier against a set of known identifiers.
-	// For the record, it looks as follows. However, it is tricky to distinguish
-	// from slice/array index and map assignments...
-	//.  .  .  .  .  .  .  *ast.IndexExpr {
-	//.  .  .  .  .  .  .  .  X: *ast.Ident {
-	//.  .  .  .  .  .  .  .  .  Name: "m"
-	//.  .  .  .  .  .  .  .  }
-	//.  .  .  .  .  .  .  .  Index: *ast.Ident {
-	//.  .  .  .  .  .  .  .  .  Name: "s"
-	//.  .  .  .  .  .  .  .  }
-	//.  .  .  .  .  .  .  }
-
-	// TODO: transform expressions so that lhs expression contains a variable
-	// and rhs contains all constant operands. For example, for (real code from vp8 codec):
-	//	cf := (b[0]>>4)&7 == 5
-	// we would like to transform it to:
-	//	b[0] & (7<<4) == 5<<4
-	// and then to:
-	//	b[0] == 5<<4 | b & ^(7<<4)
-	// and emit:
-	//	Sonar(b[0], 5<<4 | b & ^(7<<4), SonarEQL)
-	// This will allow the fuzzer to figure out what bytes it needs to replace
-	// with what bytes in order to crack this condition.
-	// Similarly, for:
+	// TODO: transform arithmetic expressions so that lhs expression contains a variable
+	// and rhs contains all constant operands (bitfield comparisons are handled by instrumentBitfield).
+	// For example, for:
 	//	x/3 == 100
 	// we would like to emit:
 	//	Sonar(x, 100*3, SonarEQL)
 
-	// TODO: intercept strings.Index/HasPrefix and similar functions.
-
 	nn := n.(*ast.BinaryExpr)
 	var flags uint8
 	switch nn.Op {
@@ -272,11 +308,25 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 	if flags&SonarConst1 != 0 && flags&SonarConst2 != 0 {
 		return nil
 	}
-	id := int(flags) | sonarSeq<<8
-	startPos := s.fset.Position(nn.Pos())
-	endPos := s.fset.Position(nn.End())
-	*s.blocks = append(*s.blocks, CoverBlock{sonarSeq, s.fullName, startPos.Line, startPos.Column, endPos.Line, endPos.Column, int(flags)})
-	sonarSeq++
+	var id int
+	if s.valueProfile {
+		// Only integers and strings have a meaningful notion of partial match.
+		basic, ok := tv.Type.Underlying().(*types.Basic)
+		if !ok || basic.Info()&(types.IsInteger|types.IsString) == 0 || isWeirdShift(s.info, v1) || isWeirdShift(s.info, v2) {
+			return nil
+		}
+		id = valueProfileSeq
+		valueProfileSeq++
+		x, y, op := nn.X, nn.Y, nn.Op
+		s.restore = append(s.restore, func() {
+			nn.X, nn.Y, nn.Op = x, y, op
+		})
+	} else {
+		if s.instrumentBitfield(nn, flags) {
+			return nil
+		}
+		id = s.newSite(nn, flags)
+	}
 	block := &ast.BlockStmt{}
 
 	typstr := tv.Type.String()
@@ -322,15 +372,208 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 	v1 = conv("__gofuzz_v1", v1)
 	v2 = conv("__gofuzz_v2", v2)
 
+	dep := func(name string) ast.Expr {
+		return &ast.SelectorExpr{X: ast.NewIdent(fuzzdepPkg), Sel: ast.NewIdent(name)}
+	}
+	call := &ast.CallExpr{
+		Fun:  dep("Sonar"),
+		Args: []ast.Expr{v1, v2, &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(id)}},
+	}
+	if s.valueProfile {
+		// Integers:
+		//	go-fuzz-dep.ValueProfile(go-fuzz-dep.Uint64(v1 ^ v2), id)
+		// Strings:
+		//	go-fuzz-dep.ValueProfileString(go-fuzz-dep.String(v1), go-fuzz-dep.String(v2), id)
+		if tv.Type.Underlying().(*types.Basic).Info()&types.IsString != 0 {
+			call.Fun = dep("ValueProfileString")
+			call.Args[0] = &ast.CallExpr{Fun: dep("String"), Args: []ast.Expr{v1}}
+			call.Args[1] = &ast.CallExpr{Fun: dep("String"), Args: []ast.Expr{v2}}
+		} else {
+			call.Fun = dep("ValueProfile")
+			call.Args = []ast.Expr{
+				&ast.CallExpr{Fun: dep("Uint64"), Args: []ast.Expr{&ast.BinaryExpr{X: v1, Op: token.XOR, Y: v2}}},
+				call.Args[2],
+			}
+		}
+	}
 	block.List = append(block.List,
+		&ast.ExprStmt{X: call},
+		&ast.ReturnStmt{Results: []ast.Expr{&ast.BinaryExpr{Op: nn.Op, X: v1, Y: v2, OpPos: nn.Pos()}}},
+	)
+	nn.X = &ast.CallExpr{
+		Fun: &ast.FuncLit{
+			Type: &ast.FuncType{Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("_go_fuzz_dep_.Bool")}}}},
+			Body: block,
+		},
+	}
+	nn.Y = &ast.BasicLit{Kind: token.INT, Value: "true"}
+	nn.Op = token.EQL
+	return nil
+}
+
+// instrumentBitfield instruments comparisons of bitfields with constants
+// that are common in binary decoders, e.g. (real code from vp8 codec):
+//
+//	cf := (b[0]>>4)&7 == 5
+//
+// The comparison is equivalent to:
+//
+//	b[0] & (7<<4) == 5<<4
+//
+// so instead of the shifted and masked value we report the original
+// variable and the value it needs to have for the condition to be true:
+//
+//	Sonar(b[0], 5<<4 | b[0] &^ (7<<4), SonarEQL)
+//
+// This allows the fuzzer to figure out what bytes it needs to replace
+// with what bytes in order to crack this condition.
+// Handled forms are x&m, x>>k, (x>>k)&m and (x&m)>>k compared with == or != to a constant.
+// It returns false if nn is not such comparison.
+func (s *Sonar) instrumentBitfield(nn *ast.BinaryExpr, flags uint8) bool {
+	if nn.Op != token.EQL && nn.Op != token.NEQ || flags&SonarLength != 0 {
+		return false
+	}
+	bf, cexpr := nn.X, nn.Y
+	if flags&SonarConst1 != 0 {
+		bf, cexpr = nn.Y, nn.X
+	}
+	basic, ok := s.info.Types[bf].Type.Underlying().(*types.Basic)
+	if !ok || basic.Info()&types.IsInteger == 0 {
+		return false
+	}
+	sizes := types.SizesFor("gc", build.Default.GOARCH)
+	if sizes == nil {
+		return false
+	}
+	width := uint(sizes.Sizeof(basic) * 8)
+	c := constant.ToInt(s.info.Types[cexpr].Value)
+	if c.Kind() != constant.Int {
+		return false
+	}
+	// Decompose bf into leaf, shift and mask, so that
+	// bf == c is equivalent to leaf&mask == c<<shift.
+	// Constants are converted to unsigned two's complement representation.
+	ones := constant.BinaryOp(constant.Shift(constant.MakeInt64(1), token.SHL, width), token.SUB, constant.MakeInt64(1))
+	unsigned := func(v constant.Value) constant.Value {
+		return constant.BinaryOp(v, token.AND, ones)
+	}
+	constInt := func(e ast.Expr) (constant.Value, bool) {
+		if !isConstExpr(s.info, e) {
+			return nil, false
+		}
+		v := constant.ToInt(s.info.Types[e].Value)
+		return v, v.Kind() == constant.Int
+	}
+	var leafParent *ast.BinaryExpr // leaf is leafParent.X or leafParent.Y
+	var shift uint
+	mask := ones
+	splitAnd := func(e ast.Expr) (*ast.BinaryExpr, constant.Value, bool) {
+		and, ok := unparen(e).(*ast.BinaryExpr)
+		if !ok || and.Op != token.AND {
+			return nil, nil, false
+		}
+		if m, ok := constInt(and.Y); ok {
+			return and, m, true
+		}
+		if m, ok := constInt(and.X); ok {
+			and.X, and.Y = and.Y, and.X
+			return and, m, true
+		}
+		return nil, nil, false
+	}
+	splitShift := func(e ast.Expr) (*ast.BinaryExpr, uint, bool) {
+		shr, ok := unparen(e).(*ast.BinaryExpr)
+		if !ok || shr.Op != token.SHR {
+			return nil, 0, false
+		}
+		k, ok := constInt(shr.Y)
+		if !ok {
+			return nil, 0, false
+		}
+		k64, ok := constant.Uint64Val(k)
+		if !ok || k64 >= uint64(width) {
+			return nil, 0, false
+		}
+		return shr, uint(k64), true
+	}
+	if and, m, ok := splitAnd(bf); ok {
+		// (x>>k)&m or x&m
+		leafParent = and
+		mask = unsigned(m)
+		if shr, k, ok := splitShift(and.X); ok {
+			leafParent = shr
+			shift = k
+			mask = unsigned(constant.Shift(mask, token.SHL, k))
+		}
+	} else if shr, k, ok := splitShift(bf); ok {
+		// (x&m)>>k or x>>k
+		leafParent = shr
+		shift = k
+		mask = unsigned(constant.Shift(ones, token.SHL, k))
+		if and, m, ok := splitAnd(shr.X); ok {
+			leafParent = and
+			mask = constant.BinaryOp(mask, token.AND, unsigned(m))
+		}
+	} else {
+		return false
+	}
+	leaf := leafParent.X
+	if isConstExpr(s.info, leaf) || isWeirdShift(s.info, leaf) || !types.Identical(s.info.Types[leaf].Type, s.info.Types[bf].Type) {
+		return false
+	}
+	// If c<<k does not fit into the type or has bits outside of the mask,
+	// the condition is constant (or we don't understand it).
+	signed := basic.Info()&types.IsUnsigned == 0
+	lo, hi := constant.MakeInt64(0), ones
+	if signed {
+		hi = constant.Shift(constant.MakeInt64(1), token.SHL, width-1)
+		lo = constant.UnaryOp(token.SUB, hi, 0)
+		hi = constant.BinaryOp(hi, token.SUB, constant.MakeInt64(1))
+	}
+	cval := constant.Shift(c, token.SHL, shift)
+	if constant.Compare(cval, token.LSS, lo) || constant.Compare(cval, token.GTR, hi) {
+		return false
+	}
+	cval = unsigned(cval)
+	if constant.Compare(constant.BinaryOp(cval, token.AND_NOT, mask), token.NEQ, constant.MakeInt64(0)) {
+		return false
+	}
+	lit := func(v constant.Value) ast.Expr {
+		if signed && constant.Compare(v, token.GTR, hi) {
+			// Convert back to signed representation so that the constant fits into the type.
+			v = constant.BinaryOp(v, token.SUB, constant.BinaryOp(ones, token.ADD, constant.MakeInt64(1)))
+		}
+		return &ast.BasicLit{Kind: token.INT, Value: v.ExactString()}
+	}
+	conv := func(v ast.Expr) ast.Expr {
+		if _, ok := s.info.Types[leaf].Type.(*types.Basic); ok {
+			return v
+		}
+		// go-fuzz-dep.Sonar understands only basic types.
+		return &ast.CallExpr{Fun: ast.NewIdent(basic.Name()), Args: []ast.Expr{v}}
+	}
+	// Replace:
+	//	(x>>k)&m == c
+	// with:
+	//	func() _go_fuzz_dep_.Bool { v1 := x; go-fuzz-dep.Sonar(v1, c<<k | v1 &^ (m<<k), flags); return (v1>>k)&m == c }() == true
+	id := s.newSite(nn, flags|SonarConst2)
+	tmp := ast.NewIdent("__gofuzz_v1")
+	s.info.Types[tmp] = s.info.Types[leaf]
+	block := &ast.BlockStmt{List: []ast.Stmt{
+		&ast.AssignStmt{Tok: token.DEFINE, Lhs: []ast.Expr{tmp}, Rhs: []ast.Expr{leaf}},
 		&ast.ExprStmt{
 			X: &ast.CallExpr{
-				Fun:  &ast.SelectorExpr{X: ast.NewIdent(fuzzdepPkg), Sel: ast.NewIdent("Sonar")},
-				Args: []ast.Expr{v1, v2, &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(id)}},
+				Fun: &ast.SelectorExpr{X: ast.NewIdent(fuzzdepPkg), Sel: ast.NewIdent("Sonar")},
+				Args: []ast.Expr{
+					conv(tmp),
+					conv(&ast.BinaryExpr{X: lit(cval), Op: token.OR, Y: &ast.BinaryExpr{X: tmp, Op: token.AND_NOT, Y: lit(mask)}}),
+					&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(id)},
+				},
 			},
 		},
-		&ast.ReturnStmt{Results: []ast.Expr{&ast.BinaryExpr{Op: nn.Op, X: v1, Y: v2, OpPos: nn.Pos()}}},
-	)
+	}}
+	leafParent.X = tmp
+	block.List = append(block.List, &ast.ReturnStmt{Results: []ast.Expr{&ast.BinaryExpr{Op: nn.Op, X: nn.X, Y: nn.Y, OpPos: nn.Pos()}}})
 	nn.X = &ast.CallExpr{
 		Fun: &ast.FuncLit{
 			Type: &ast.FuncType{Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("_go_fuzz_dep_.Bool")}}}},
@@ -339,7 +582,238 @@ func (s *Sonar) Visit(n ast.Node) ast.Visitor {
 	}
 	nn.Y = &ast.BasicLit{Kind: token.INT, Value: "true"}
 	nn.Op = token.EQL
-	return nil
+	return true
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+// newSite registers a new sonar site and returns its id with flags.
+func (s *Sonar) newSite(n ast.Node, flags uint8) int {
+	id := int(flags) | sonarSeq<<8
+	startPos := s.fset.Position(n.Pos())
+	endPos := s.fset.Position(n.End())
+	*s.blocks = append(*s.blocks, CoverBlock{sonarSeq, s.fullName, startPos.Line, startPos.Column, endPos.Line, endPos.Column, int(flags)})
+	sonarSeq++
+	return id
+}
+
+// walkStore walks the left side of an assignment without instrumenting it as a map lookup.
+func (s *Sonar) walkStore(n ast.Expr) {
+	if idx, ok := n.(*ast.IndexExpr); ok {
+		ast.Walk(s, idx.X)
+		ast.Walk(s, idx.Index)
+		return
+	}
+	ast.Walk(s, n)
+}
+
+// sonarMapKeys is the max number of map keys reported for a single map lookup.
+const sonarMapKeys = 8
+
+// instrumentMapIndex instruments map lookups with string and integer keys,
+// which are frequently used to match input against a set of known tokens:
+//
+//	keywords[ident]
+//
+// The lookup is replaced with:
+//
+//	keywords[func() K {
+//		k := ident
+//		if go-fuzz-dep.SonarEnabled() {
+//			n := 0
+//			for mk := range keywords {
+//				go-fuzz-dep.Sonar(k, mk, flags)
+//				if n++; n == sonarMapKeys { break }
+//			}
+//		}
+//		return k
+//	}()]
+//
+// The check of SonarEnabled keeps lookups cheap in binaries built with -single
+// when comparisons are not recorded.
+//
+// Map iteration order is random, so different executions report different keys
+// (the site is marked with SonarMapKey and ignored in -deterministic mode).
+// The map expression is evaluated twice, so only side-effect-free expressions are handled.
+func (s *Sonar) instrumentMapIndex(nn *ast.IndexExpr) {
+	tv := s.info.Types[nn.X]
+	if tv.Type == nil {
+		return
+	}
+	mt, ok := tv.Type.Underlying().(*types.Map)
+	if !ok || !isSimpleExpr(nn.X) || isConstExpr(s.info, nn.Index) {
+		return
+	}
+	basic, ok := mt.Key().Underlying().(*types.Basic)
+	if !ok || basic.Info()&(types.IsString|types.IsInteger) == 0 {
+		return
+	}
+	// The key type needs to be referenced in the instrumented code,
+	// named key types are also converted to the underlying basic type.
+	// Skip the lookup if these names are shadowed at this position (e.g. a parameter named string).
+	var typ ast.Expr
+	switch kt := mt.Key().(type) {
+	case *types.Basic:
+		if !s.resolvesTo(nn, kt.Name(), types.Universe.Lookup(kt.Name())) {
+			return
+		}
+		typ = ast.NewIdent(kt.Name())
+	case *types.Named:
+		if kt.Obj().Pkg() == nil || kt.Obj().Pkg().Path() != s.pkg ||
+			!s.resolvesTo(nn, kt.Obj().Name(), kt.Obj()) ||
+			!s.resolvesTo(nn, basic.Name(), types.Universe.Lookup(basic.Name())) {
+			return
+		}
+		typ = ast.NewIdent(kt.Obj().Name())
+	default:
+		return
+	}
+	conv := func(v ast.Expr) ast.Expr {
+		if _, ok := mt.Key().(*types.Basic); ok {
+			return v
+		}
+		// go-fuzz-dep.Sonar understands only basic types.
+		return &ast.CallExpr{Fun: ast.NewIdent(basic.Name()), Args: []ast.Expr{v}}
+	}
+	id := s.newSite(nn, SonarEQL)
+	(*s.blocks)[len(*s.blocks)-1].NumStmt |= SonarMapKey
+	key := ast.NewIdent("__gofuzz_k")
+	mkey := ast.NewIdent("__gofuzz_mk")
+	n := ast.NewIdent("__gofuzz_n")
+	loop := &ast.BlockStmt{List: []ast.Stmt{
+		&ast.AssignStmt{Lhs: []ast.Expr{n}, Tok: token.DEFINE, Rhs: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "0"}}},
+		&ast.RangeStmt{
+			Key: mkey,
+			Tok: token.DEFINE,
+			X:   nn.X,
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				&ast.ExprStmt{
+					X: &ast.CallExpr{
+						Fun:  &ast.SelectorExpr{X: ast.NewIdent(fuzzdepPkg), Sel: ast.NewIdent("Sonar")},
+						Args: []ast.Expr{conv(key), conv(mkey), &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(id)}},
+					},
+				},
+				&ast.IfStmt{
+					Init: &ast.IncDecStmt{X: n, Tok: token.INC},
+					Cond: &ast.BinaryExpr{X: n, Op: token.EQL, Y: &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(sonarMapKeys)}},
+					Body: &ast.BlockStmt{List: []ast.Stmt{&ast.BranchStmt{Tok: token.BREAK}}},
+				},
+			}},
+		},
+	}}
+	body := &ast.BlockStmt{List: []ast.Stmt{
+		&ast.AssignStmt{Lhs: []ast.Expr{key}, Tok: token.DEFINE, Rhs: []ast.Expr{nn.Index}},
+		&ast.IfStmt{
+			Cond: &ast.CallExpr{Fun: &ast.SelectorExpr{X: ast.NewIdent(fuzzdepPkg), Sel: ast.NewIdent("SonarEnabled")}},
+			Body: loop,
+		},
+		&ast.ReturnStmt{Results: []ast.Expr{key}},
+	}}
+	nn.Index = &ast.CallExpr{
+		Fun: &ast.FuncLit{
+			Type: &ast.FuncType{Results: &ast.FieldList{List: []*ast.Field{{Type: typ}}}},
+			Body: body,
+		},
+	}
+}
+
+// resolvesTo returns true if name refers to obj at the position of n.
+func (s *Sonar) resolvesTo(n ast.Node, name string, obj types.Object) bool {
+	scope := s.info.Scopes[s.astFile]
+	if scope == nil || obj == nil {
+		return false
+	}
+	if inner := scope.Innermost(n.Pos()); inner != nil {
+		scope = inner
+	}
+	_, found := scope.LookupParent(name, n.Pos())
+	return found == obj
+}
+
+// sonarLibraryFuncs are bytes and strings package functions intercepted by sonar.
+var sonarLibraryFuncs = map[string]int{
+	"Equal":     SonarCallEqual,
+	"EqualFold": SonarCallEqual,
+	"Compare":   SonarCallEqual,
+	"HasPrefix": SonarCallPrefix,
+	"HasSuffix": SonarCallSuffix,
+	"Index":     SonarCallIndex,
+	"LastIndex": SonarCallIndex,
+	"Contains":  SonarCallIndex,
+}
+
+// instrumentLibraryCall instruments calls of bytes/strings comparison functions.
+// It replaces:
+//
+//	bytes.HasPrefix(x, y)
+//
+// with:
+//
+//	bytes.HasPrefix(go-fuzz-dep.SonarBytes(x, y, id, SonarCallPrefix))
+//
+// SonarBytes reports the operands and returns them unchanged.
+// It returns false if n is not such call.
+func (s *Sonar) instrumentLibraryCall(n *ast.CallExpr) bool {
+	sel, ok := n.Fun.(*ast.SelectorExpr)
+	if !ok || len(n.Args) != 2 || n.Ellipsis.IsValid() {
+		return false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	pkgName, ok := s.info.Uses[id].(*types.PkgName)
+	if !ok {
+		return false
+	}
+	var wrapper string
+	switch pkgName.Imported().Path() {
+	case "bytes":
+		wrapper = "SonarBytes"
+	case "strings":
+		wrapper = "SonarStrings"
+	default:
+		return false
+	}
+	kind, ok := sonarLibraryFuncs[sel.Sel.Name]
+	if !ok {
+		return false
+	}
+	ast.Walk(s, n.Args[0])
+	ast.Walk(s, n.Args[1])
+	if isConstExpr(s.info, n.Args[0]) && isConstExpr(s.info, n.Args[1]) {
+		return true
+	}
+	siteID := s.newSite(n, SonarEQL)
+	n.Args = []ast.Expr{&ast.CallExpr{
+		Fun: &ast.SelectorExpr{X: ast.NewIdent(fuzzdepPkg), Sel: ast.NewIdent(wrapper)},
+		Args: []ast.Expr{n.Args[0], n.Args[1],
+			&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(siteID)},
+			&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(kind)}},
+	}}
+	return true
+}
+
+// isSimpleExpr returns true if n is a variable or a field selector chain (e.g. p.tab.keywords),
+// these can be evaluated twice without side effects.
+func isSimpleExpr(n ast.Expr) bool {
+	switch nn := n.(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		return isSimpleExpr(nn.X)
+	case *ast.ParenExpr:
+		return isSimpleExpr(nn.X)
+	}
+	return false
 }
 
 func isWeirdShift(info *types.Info, n ast.Expr) bool {
@@ -0,0 +1,377 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+	. "github.com/dvyukov/go-fuzz/internal/go-fuzz-types"
+)
+
+// instrumentSonar instruments src for sonar and returns the result without spaces.
+func instrumentSonar(t *testing.T, src string) string {
+	_, sonar := instrumentSource(t, src, false)
+	return sonar
+}
+
+// instrumentSource instruments src for coverage and then for sonar (the same way go-fuzz-build does)
+// and returns both results without spaces.
+func instrumentSource(t *testing.T, src string, valueProfile bool) (string, string) {
+	fset, f, info := parseSource(t, src)
+	var blocks, sonar []CoverBlock
+	cover := new(bytes.Buffer)
+	instrument("p", "test.go", fset, f, info, cover, &blocks, nil, valueProfile)
+	buf := new(bytes.Buffer)
+	instrument("p", "test.go", fset, f, info, buf, nil, &sonar, valueProfile)
+	return compact(cover.String()), compact(buf.String())
+}
+
+// parseSource parses and typechecks src.
+func parseSource(t *testing.T, src string) (*token.FileSet, *ast.File, *types.Info) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "test.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:  make(map[ast.Expr]types.TypeAndValue),
+		Defs:   make(map[*ast.Ident]types.Object),
+		Uses:   make(map[*ast.Ident]types.Object),
+		Scopes: make(map[ast.Node]*types.Scope),
+	}
+	conf := &types.Config{Importer: importer.Default()}
+	if _, err := conf.Check("p", fset, []*ast.File{f}, info); err != nil {
+		t.Fatal(err)
+	}
+	return fset, f, info
+}
+
+// fuzzDepStub declares go-fuzz-dep API used by instrumented code.
+const fuzzDepStub = `package gofuzzdep
+
+type Bool = bool
+
+type (
+	Uint64 = uint64
+	String = string
+)
+
+var CoverTab = new([65536]byte)
+
+func ValueProfile(v uint64, id uint32)                                 {}
+func ValueProfileString(v1, v2 string, id uint32)                      {}
+func SonarEnabled() bool                                               { return false }
+func Sonar(v1, v2 interface{}, id uint32)                              {}
+func SonarBytes(v1, v2 []byte, id uint32, kind int) ([]byte, []byte)   { return v1, v2 }
+func SonarStrings(v1, v2 string, id uint32, kind int) (string, string) { return v1, v2 }
+`
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// instrumentAndCheck instruments src for coverage and sonar in a single pass
+// and checks that the result compiles. It returns the result without spaces.
+func instrumentAndCheck(t *testing.T, src string) string {
+	fset, f, info := parseSource(t, src)
+	var blocks, sonar []CoverBlock
+	buf := new(bytes.Buffer)
+	instrument("p", "test.go", fset, f, info, buf, &blocks, &sonar, false)
+	fset = token.NewFileSet()
+	dep, err := parser.ParseFile(fset, "dep.go", fuzzDepStub, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depPkg, err := new(types.Config).Check("go-fuzz-dep", fset, []*ast.File{dep}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := importer.Default()
+	conf := &types.Config{Importer: importerFunc(func(path string) (*types.Package, error) {
+		if path == "go-fuzz-dep" {
+			return depPkg, nil
+		}
+		return std.Import(path)
+	})}
+	f, err = parser.ParseFile(fset, "test.go", buf.Bytes(), 0)
+	if err == nil {
+		_, err = conf.Check("p", fset, []*ast.File{f}, nil)
+	}
+	if err != nil {
+		t.Fatalf("instrumented code does not compile: %v\n%s", err, buf.Bytes())
+	}
+	return compact(buf.String())
+}
+
+func compact(res string) string {
+	for _, line := range strings.Split(res, "\n") {
+		if strings.HasPrefix(line, "//line ") {
+			res = strings.Replace(res, line+"\n", "", 1)
+		}
+	}
+	return strings.Join(strings.Fields(res), "")
+}
+
+func TestSonarBitfield(t *testing.T) {
+	tests := []struct {
+		expr  string
+		sonar string // expected Sonar operands
+	}{
+		// vp8 frame header: color space bits.
+		{"(b[0]>>4)&7 == 5", "Sonar(__gofuzz_v1,80|__gofuzz_v1&^112,"},
+		// zlib header: compression method.
+		{"b[0]&0x0f != 8", "Sonar(__gofuzz_v1,8|__gofuzz_v1&^15,"},
+		// UTF-8 two-byte sequence lead byte.
+		{"b[1]&0xe0 == 0xc0", "Sonar(__gofuzz_v1,192|__gofuzz_v1&^224,"},
+		// Constant on the left side.
+		{"5 == (b[0]>>4)&7", "Sonar(__gofuzz_v1,80|__gofuzz_v1&^112,"},
+		// Flag test.
+		{"b[2]>>7 == 1", "Sonar(__gofuzz_v1,128|__gofuzz_v1&^128,"},
+		// MPEG audio frame sync.
+		{"(hdr>>21)&0x7ff == 0x7ff", "Sonar(__gofuzz_v1,4292870144|__gofuzz_v1&^4292870144,"},
+		// Mask before shift.
+		{"(hdr&0xf000)>>12 == 4", "Sonar(__gofuzz_v1,16384|__gofuzz_v1&^61440,"},
+		// Signed values.
+		{"s>>4 == -1", "Sonar(__gofuzz_v1,-16|__gofuzz_v1&^-16,"},
+		{"s&-16 == -32", "Sonar(__gofuzz_v1,-32|__gofuzz_v1&^-16,"},
+		// The condition is always false, not normalized.
+		{"b[0]&0x0f == 0x10", "Sonar(__gofuzz_v1,0x10,"},
+		{"b[0]>>4 == 0x10", "Sonar(__gofuzz_v1,0x10,"},
+		// Not a bitfield.
+		{"b[0]+1 == 5", "Sonar(__gofuzz_v1,5,"},
+		{"b[0]&b[1] == 1", "Sonar(__gofuzz_v1,1,"},
+		{"b[0]>>n == 1", "Sonar(__gofuzz_v1,1,"},
+		{"b[0]&3 < 2", "Sonar(__gofuzz_v1,2,"},
+	}
+	for _, test := range tests {
+		src := `package p
+
+func f(b []byte, hdr uint32, s int8, n uint) bool {
+	return ` + test.expr + `
+}
+`
+		res := instrumentSonar(t, src)
+		if !strings.Contains(res, test.sonar) {
+			t.Errorf("%v: instrumented code does not contain %q:\n%v", test.expr, test.sonar, res)
+		}
+	}
+}
+
+func TestSonarBitfieldSideEffects(t *testing.T) {
+	// The masked expression must be evaluated only once.
+	res := instrumentSonar(t, `package p
+
+func f(next func() byte) bool {
+	return (next()>>4)&7 == 5
+}
+`)
+	if n := strings.Count(res, "next()"); n != 1 {
+		t.Fatalf("masked expression is evaluated %v times:\n%v", n, res)
+	}
+	if !strings.Contains(res, "return(__gofuzz_v1>>4)&7==5") {
+		t.Fatalf("original comparison is not preserved:\n%v", res)
+	}
+}
+
+func TestSonarLibraryCall(t *testing.T) {
+	src := `package p
+
+import (
+	"bytes"
+	str "strings"
+)
+
+type matcher struct{}
+
+func (matcher) HasPrefix(s, prefix string) bool { return false }
+
+func f(b, magic []byte, s string) bool {
+	if bytes.HasPrefix(b, magic) || bytes.Equal(b[1:], []byte("IHDR")) || bytes.Contains(b, magic) {
+		return true
+	}
+	if str.HasSuffix(s, ".png") || str.EqualFold(str.TrimSpace(s), "GIF") || str.LastIndex(s, "/") > 0 {
+		return true
+	}
+	// Not instrumented: both operands are constant, not a comparison function, not a package.
+	var strings matcher
+	return str.HasPrefix("abc", "a") || str.Repeat(s, 2) == "" || strings.HasPrefix(s, "x")
+}
+`
+	res := instrumentAndCheck(t, src)
+	for _, want := range []struct {
+		call string
+		kind int
+	}{
+		{"bytes.HasPrefix(_go_fuzz_dep_.SonarBytes(b,magic,", SonarCallPrefix},
+		{`bytes.Equal(_go_fuzz_dep_.SonarBytes(b[1:],[]byte("IHDR"),`, SonarCallEqual},
+		{"bytes.Contains(_go_fuzz_dep_.SonarBytes(b,magic,", SonarCallIndex},
+		{`str.HasSuffix(_go_fuzz_dep_.SonarStrings(s,".png",`, SonarCallSuffix},
+		{`str.EqualFold(_go_fuzz_dep_.SonarStrings(str.TrimSpace(s),"GIF",`, SonarCallEqual},
+		{`str.LastIndex(_go_fuzz_dep_.SonarStrings(s,"/",`, SonarCallIndex},
+	} {
+		i := strings.Index(res, want.call)
+		if i == -1 {
+			t.Errorf("instrumented code does not contain %q:\n%v", want.call, res)
+			continue
+		}
+		// The operands are followed by site id and kind.
+		rest := res[i+len(want.call):]
+		if args := rest[:strings.Index(rest, ")")]; !strings.HasSuffix(args, fmt.Sprintf(",%v", want.kind)) {
+			t.Errorf("%q: bad sonar kind %q, want %v", want.call, args, want.kind)
+		}
+	}
+	for _, want := range []string{`str.HasPrefix("abc","a")`, "str.Repeat(s,2)", `strings.HasPrefix(s,"x")`} {
+		if !strings.Contains(res, want) {
+			t.Errorf("instrumented code does not contain %q:\n%v", want, res)
+		}
+	}
+	if n := strings.Count(res, "_go_fuzz_dep_.SonarBytes(") + strings.Count(res, "_go_fuzz_dep_.SonarStrings("); n != 6 {
+		t.Errorf("got %v instrumented calls, want 6:\n%v", n, res)
+	}
+}
+
+func TestValueProfile(t *testing.T) {
+	src := `package p
+
+type Name string
+
+func f(b []byte, x uint32, s string, n Name, fl float64) bool {
+	if x == 0xdeadbeef || s != "magic" || n == "name" || int8(b[0]) < -5 {
+		return true
+	}
+	return fl == 1.5
+}
+`
+	cover, sonar := instrumentSource(t, src, true)
+	for _, want := range []string{
+		"_go_fuzz_dep_.ValueProfile(_go_fuzz_dep_.Uint64(__gofuzz_v1^0xdeadbeef),",
+		`_go_fuzz_dep_.ValueProfileString(_go_fuzz_dep_.String(__gofuzz_v1),_go_fuzz_dep_.String("magic"),`,
+		`_go_fuzz_dep_.ValueProfileString(_go_fuzz_dep_.String(__gofuzz_v1),_go_fuzz_dep_.String("name"),`,
+		"_go_fuzz_dep_.ValueProfile(_go_fuzz_dep_.Uint64(__gofuzz_v1^-5),",
+		"returnfl==1.5",
+	} {
+		if !strings.Contains(cover, want) {
+			t.Errorf("cover code does not contain %q:\n%v", want, cover)
+		}
+	}
+	// Sonar must see the original comparisons.
+	if strings.Contains(sonar, "ValueProfile") || strings.Count(sonar, "_go_fuzz_dep_.Sonar(") != 5 {
+		t.Errorf("bad sonar code:\n%v", sonar)
+	}
+	cover, _ = instrumentSource(t, src, false)
+	if strings.Contains(cover, "ValueProfile") {
+		t.Errorf("value profile instrumentation is not disabled:\n%v", cover)
+	}
+}
+
+func TestSingleBinary(t *testing.T) {
+	src := `package p
+
+func f(x uint32, s string) bool {
+	if x == 0xdeadbeef {
+		return true
+	}
+	return s == "magic"
+}
+`
+	_, separate := instrumentSource(t, src, false)
+	fset, f, info := parseSource(t, src)
+	var blocks, sonar []CoverBlock
+	buf := new(bytes.Buffer)
+	instrument("p", "test.go", fset, f, info, buf, &blocks, &sonar, false)
+	single := compact(buf.String())
+	if len(blocks) == 0 || len(sonar) != 2 {
+		t.Fatalf("got %v cover blocks and %v sonar sites", len(blocks), len(sonar))
+	}
+	// The sonar binary is built on top of the coverage instrumentation,
+	// so a single pass must produce the same code.
+	if !strings.Contains(single, "CoverTab[") || strings.Count(single, "_go_fuzz_dep_.Sonar(") != 2 {
+		t.Fatalf("bad instrumented code:\n%v", single)
+	}
+	if strings.Count(single, "CoverTab[") != strings.Count(separate, "CoverTab[") {
+		t.Fatalf("coverage instrumentation differs:\n%v\n%v", single, separate)
+	}
+}
+
+func TestSonarMapIndex(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		instrumented bool
+	}{
+		{"string key", `package p
+
+var keywords = map[string]int{"if": 1}
+
+func f(s string) int {
+	return keywords[s]
+}
+`, true},
+		{"named key", `package p
+
+type keyword string
+
+var keywords = map[keyword]int{"if": 1}
+
+func f(s string) int {
+	return keywords[keyword(s)]
+}
+`, true},
+		{"shadowed basic type", `package p
+
+var m = map[string]int{"if": 1}
+
+func g(string int, s2 string) int {
+	return m[s2] + string
+}
+`, false},
+		{"shadowed named type", `package p
+
+type keyword string
+
+var keywords = map[keyword]int{"if": 1}
+
+func f(s string) int {
+	keyword := keyword(s)
+	return keywords[keyword]
+}
+`, false},
+		{"shadowed underlying type", `package p
+
+type keyword string
+
+var keywords = map[keyword]int{"if": 1}
+
+func f(k keyword, string int) int {
+	return keywords[k] + string
+}
+`, false},
+	}
+	for _, test := range tests {
+		res := instrumentAndCheck(t, test.src)
+		if got := strings.Contains(res, "__gofuzz_mk"); got != test.instrumented {
+			t.Errorf("%v: map lookup instrumented: %v, want %v:\n%v", test.name, got, test.instrumented, res)
+		}
+		// Map keys are iterated only if comparisons are recorded.
+		if test.instrumented && !strings.Contains(res, "if_go_fuzz_dep_.SonarEnabled(){__gofuzz_n:=0") {
+			t.Errorf("%v: map keys iteration is not guarded:\n%v", test.name, res)
+		}
+	}
+	// Map lookup sites are marked in metadata, go-fuzz ignores them in -deterministic mode.
+	fset, f, info := parseSource(t, tests[0].src)
+	var blocks, sonar []CoverBlock
+	instrument("p", "test.go", fset, f, info, new(bytes.Buffer), &blocks, &sonar, false)
+	if len(sonar) != 1 || sonar[0].NumStmt&SonarMapKey == 0 {
+		t.Errorf("map lookup site is not marked: %+v", sonar)
+	}
+}
@@ -31,15 +31,19 @@ import (
 )
 
 var (
-	flagTag       = flag.String("tags", "", "a space-separated list of build tags to consider satisfied during the build")
-	flagOut       = flag.String("o", "", "output file")
-	flagFunc      = flag.String("func", "", "preferred entry function")
-	flagWork      = flag.Bool("work", false, "don't remove working directory")
-	flagRace      = flag.Bool("race", false, "enable race detector")
-	flagCPU       = flag.Bool("cpuprofile", false, "generate cpu profile in cpu.pprof")
-	flagLibFuzzer = flag.Bool("libfuzzer", false, "output static archive for use with libFuzzer")
-	flagBuildX    = flag.Bool("x", false, "print the commands if build fails")
-	flagPreserve  = flag.String("preserve", "", "a comma-separated list of import paths not to instrument")
+	flagTag          = flag.String("tags", "", "a space-separated list of build tags to consider satisfied during the build")
+	flagOut          = flag.String("o", "", "output file")
+	flagFunc         = flag.String("func", "", "preferred entry function")
+	flagWork         = flag.Bool("work", false, "don't remove working directory")
+	flagRace         = flag.Bool("race", false, "enable race detector")
+	flagCPU          = flag.Bool("cpuprofile", false, "generate cpu profile in cpu.pprof")
+	flagLibFuzzer    = flag.Bool("libfuzzer", false, "output static archive for use with libFuzzer")
+	flagBuildX       = flag.Bool("x", false, "print the commands if build fails")
+	flagPreserve     = flag.String("preserve", "", "a comma-separated list of import paths not to instrument")
+	flagTestCorpus   = flag.String("testcorpus", "", "run package tests and save arguments of -testfuncs into this dir as seed corpus")
+	flagTestFuncs    = flag.String("testfuncs", "", "a comma-separated list of functions in the package whose arguments are captured with -testcorpus (default: fuzz functions)")
+	flagValueProfile = flag.Bool("valueprofile", false, "instrument comparisons in the coverage binary to reward partial progress on them (slows down execution)")
+	flagSingle       = flag.Bool("single", false, "build one binary with both coverage and sonar instrumentation (halves the number of test processes, but slows down execution)")
 )
 
 func makeTags() string {
@@ -107,6 +111,9 @@ func main() {
 	if *flagLibFuzzer && *flagRace {
 		c.failf("-race and -libfuzzer are incompatible")
 	}
+	if *flagSingle && *flagValueProfile {
+		c.failf("-single and -valueprofile are incompatible")
+	}
 	if checkModVendor() {
 		// We don't support -mod=vendor with modules.
 		// Part of the issue is go-fuzz-dep and go-fuzz-defs
@@ -123,6 +130,11 @@ func main() {
 	defer c.cleanup()   // delete workdir as needed, etc.
 	c.populateWorkdir() // copy tools and packages to workdir as needed
 
+	if *flagTestCorpus != "" {
+		// Capture seed corpus from package tests.
+		c.captureTestCorpus(pkg)
+	}
+
 	if *flagOut == "" {
 		ext := ".zip"
 		if *flagLibFuzzer {
@@ -156,12 +168,19 @@ func main() {
 		return
 	}
 
-	coverBin := c.buildInstrumentedBinary(&blocks, nil)
-	sonarBin := c.buildInstrumentedBinary(nil, &sonar)
+	var coverBin, sonarBin, fuzzBin string
+	if *flagSingle {
+		// Sonar recording is toggled by go-fuzz per execution.
+		fuzzBin = c.buildInstrumentedBinary(&blocks, &sonar)
+	} else {
+		coverBin = c.buildInstrumentedBinary(&blocks, nil)
+		sonarBin = c.buildInstrumentedBinary(nil, &sonar)
+	}
 	metaData := c.createMeta(lits, blocks, sonar)
 	defer func() {
 		os.Remove(coverBin)
 		os.Remove(sonarBin)
+		os.Remove(fuzzBin)
 		os.Remove(metaData)
 	}()
 
@@ -186,8 +205,12 @@ func main() {
 		f.Close()
 		os.Remove(datafile)
 	}
-	zipFile("cover.exe", coverBin)
-	zipFile("sonar.exe", sonarBin)
+	if *flagSingle {
+		zipFile("fuzz.exe", fuzzBin)
+	} else {
+		zipFile("cover.exe", coverBin)
+		zipFile("sonar.exe", sonarBin)
+	}
 	zipFile("metadata", metaData)
 	if err := zipw.Close(); err != nil {
 		c.failf("failed to close zip file: %v", err)
@@ -207,6 +230,9 @@ type Context struct {
 
 	allFuncs []string // all fuzz functions found in package
 
+	customMutator   bool // package has FuzzMutate function
+	customCrossOver bool // package has FuzzCrossOver function
+
 	workdir string
 	GOROOT  string
 	GOPATH  string
@@ -348,6 +374,14 @@ func (c *Context) loadPkg(pkg string) {
 	if len(c.allFuncs) == 0 {
 		c.failf("could not find any fuzz functions in %v", c.fuzzpkg.PkgPath)
 	}
+
+	// Find custom mutators.
+	if !*flagLibFuzzer {
+		var err error
+		if c.customMutator, c.customCrossOver, err = findCustomMutators(s); err != nil {
+			c.failf("%v", err)
+		}
+	}
 	if len(c.allFuncs) > 255 {
 		c.failf("go-fuzz-build supports a maximum of 255 fuzz functions, found %v; please file an issue", len(c.allFuncs))
 	}
@@ -372,6 +406,26 @@ func (c *Context) loadPkg(pkg string) {
 	}
 }
 
+// findCustomMutators reports whether package scope s has FuzzMutate and FuzzCrossOver
+// functions, and checks their signatures.
+func findCustomMutators(s *types.Scope) (mutator, crossOver bool, err error) {
+	if obj := s.Lookup("FuzzMutate"); obj != nil {
+		sig, ok := obj.Type().(*types.Signature)
+		if !ok || !tupleHasTypes(sig.Params(), "[]byte", "uint64", "int") || !tupleHasTypes(sig.Results(), "[]byte") {
+			return false, false, fmt.Errorf("FuzzMutate must have signature func(data []byte, seed uint64, maxSize int) []byte")
+		}
+		mutator = true
+	}
+	if obj := s.Lookup("FuzzCrossOver"); obj != nil {
+		sig, ok := obj.Type().(*types.Signature)
+		if !ok || !tupleHasTypes(sig.Params(), "[]byte", "[]byte", "uint64", "int") || !tupleHasTypes(sig.Results(), "[]byte") {
+			return false, false, fmt.Errorf("FuzzCrossOver must have signature func(data1, data2 []byte, seed uint64, maxSize int) []byte")
+		}
+		crossOver = true
+	}
+	return mutator, crossOver, nil
+}
+
 // isFuzzSig reports whether sig is of the form
 //   func FuzzFunc(data []byte) int
 func isFuzzSig(sig *types.Signature) bool {
@@ -491,7 +545,18 @@ func (c *Context) populateWorkdir() {
 }
 
 func (c *Context) createMeta(lits map[Literal]struct{}, blocks []CoverBlock, sonar []CoverBlock) string {
-	meta := MetaData{Blocks: blocks, Sonar: sonar, Funcs: c.allFuncs, DefaultFunc: *flagFunc}
+	meta := MetaData{
+		Blocks:      blocks,
+		Sonar:       sonar,
+		Funcs:       c.allFuncs,
+		DefaultFunc: *flagFunc,
+		Race:        *flagRace,
+		PkgPath:     c.fuzzpkg.PkgPath,
+		PkgName:     c.fuzzpkg.Name,
+
+		CustomMutator:   c.customMutator,
+		CustomCrossOver: c.customCrossOver,
+	}
 	for k := range lits {
 		meta.Literals = append(meta.Literals, k)
 	}
@@ -620,7 +685,13 @@ func (c *Context) funcMain() []byte {
 	if *flagLibFuzzer {
 		t = mainSrcLibFuzzer
 	}
-	dot := map[string]interface{}{"Pkg": c.fuzzpkg.PkgPath, "AllFuncs": c.allFuncs, "DefaultFunc": *flagFunc}
+	dot := map[string]interface{}{
+		"Pkg":             c.fuzzpkg.PkgPath,
+		"AllFuncs":        c.allFuncs,
+		"DefaultFunc":     *flagFunc,
+		"CustomMutator":   c.customMutator,
+		"CustomCrossOver": c.customCrossOver,
+	}
 	buf := new(bytes.Buffer)
 	if err := t.Execute(buf, dot); err != nil {
 		c.failf("could not execute template: %v", err)
@@ -722,7 +793,7 @@ func (c *Context) instrumentPackages(blocks *[]CoverBlock, sonar *[]CoverBlock)
 			buf := new(bytes.Buffer)
 			content := c.readFile(fullName)
 			buf.Write(initialComments(content)) // Retain '// +build' directives.
-			instrument(pkg.PkgPath, fullName, pkg.Fset, f, pkg.TypesInfo, buf, blocks, sonar)
+			instrument(pkg.PkgPath, fullName, pkg.Fset, f, pkg.TypesInfo, buf, blocks, sonar, *flagValueProfile)
 			tmp := c.tempFile()
 			c.writeFile(tmp, buf.Bytes())
 			outpath := filepath.Join(path, fname)
@@ -834,6 +905,12 @@ func main() {
 			target.{{.}},
 		{{end}}
 	}
+	{{if .CustomMutator}}
+	dep.CustomMutator = target.FuzzMutate
+	{{end}}
+	{{if .CustomCrossOver}}
+	dep.CustomCrossOver = target.FuzzCrossOver
+	{{end}}
 	dep.Main(fns)
 }
 `))
@@ -0,0 +1,83 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+func TestFindCustomMutators(t *testing.T) {
+	tests := []struct {
+		src       string
+		mutator   bool
+		crossOver bool
+		err       bool
+	}{
+		{src: ``},
+		{
+			src:     `func FuzzMutate(data []byte, seed uint64, maxSize int) []byte { return data }`,
+			mutator: true,
+		},
+		{
+			src:       `func FuzzCrossOver(data1, data2 []byte, seed uint64, maxSize int) []byte { return data1 }`,
+			crossOver: true,
+		},
+		{
+			src: `func FuzzMutate(data []byte, seed uint64, maxSize int) []byte { return data }
+				func FuzzCrossOver(data1, data2 []byte, seed uint64, maxSize int) []byte { return data1 }`,
+			mutator:   true,
+			crossOver: true,
+		},
+		{
+			// Unexported and differently named functions are not mutators.
+			src: `func fuzzMutate(data []byte, seed uint64, maxSize int) []byte { return data }
+				func FuzzMutator(data []byte, seed uint64, maxSize int) []byte { return data }`,
+		},
+		{
+			src: `func FuzzMutate(data []byte, seed int64, maxSize int) []byte { return data }`,
+			err: true,
+		},
+		{
+			src: `func FuzzMutate(data []byte) []byte { return data }`,
+			err: true,
+		},
+		{
+			src: `func FuzzCrossOver(data1, data2 []byte, seed uint64, maxSize int) string { return "" }`,
+			err: true,
+		},
+		{
+			src: `var FuzzMutate = 1`,
+			err: true,
+		},
+	}
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "test.go", "package p\n"+test.src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := new(types.Config).Check("p", fset, []*ast.File{f}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mutator, crossOver, err := findCustomMutators(pkg.Scope())
+		if test.err {
+			if err == nil {
+				t.Errorf("%v: no error", test.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.src, err)
+			continue
+		}
+		if mutator != test.mutator || crossOver != test.crossOver {
+			t.Errorf("%v: got mutator=%v crossover=%v, want %v/%v", test.src, mutator, crossOver, test.mutator, test.crossOver)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// captureTestCorpus runs tests of the fuzz package with the target functions
+// rewritten to save all their []byte and string arguments into -testcorpus dir.
+// The saved inputs can be used as the initial go-fuzz corpus.
+// Rewritten files are passed to go test with -overlay,
+// so the user's source files are not modified.
+func (c *Context) captureTestCorpus(pkg string) {
+	outDir, err := filepath.Abs(*flagTestCorpus)
+	if err != nil {
+		c.failf("bad -testcorpus dir: %v", err)
+	}
+	c.mkdirAll(outDir)
+
+	funcs := c.allFuncs
+	if *flagTestFuncs != "" {
+		funcs = strings.Split(*flagTestFuncs, ",")
+	}
+	// Group target functions by files, so that every file is rewritten once.
+	files := make(map[string][]string)
+	var pkgDir string
+	for _, name := range funcs {
+		name = strings.TrimSpace(name)
+		obj, ok := c.fuzzpkg.Types.Scope().Lookup(name).(*types.Func)
+		if !ok {
+			c.failf("could not find function %v in %v", name, c.fuzzpkg.PkgPath)
+		}
+		file := c.fuzzpkg.Fset.Position(obj.Pos()).Filename
+		files[file] = append(files[file], name)
+		pkgDir = filepath.Dir(file)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "go-fuzz-testcorpus")
+	if err != nil {
+		c.failf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	overlay := make(map[string]string)
+	for file, names := range files {
+		src := c.rewriteTestCorpusFile(file, names)
+		tmp := filepath.Join(tmpDir, fmt.Sprintf("%v.%v", len(overlay), filepath.Base(file)))
+		c.writeFile(tmp, src)
+		overlay[file] = tmp
+	}
+	helper := filepath.Join(tmpDir, "go.fuzz.testcorpus.go")
+	c.writeFile(helper, []byte(fmt.Sprintf(testCorpusHelperSrc, c.fuzzpkg.Name)))
+	overlay[filepath.Join(pkgDir, "go.fuzz.testcorpus.go")] = helper
+	overlayData, err := json.Marshal(map[string]interface{}{"Replace": overlay})
+	if err != nil {
+		c.failf("failed to serialize overlay: %v", err)
+	}
+	overlayFile := filepath.Join(tmpDir, "overlay.json")
+	c.writeFile(overlayFile, overlayData)
+
+	tags := "gofuzz"
+	if len(*flagTag) > 0 {
+		tags += " " + *flagTag
+	}
+	cmd := exec.Command("go", "test", "-count=1", "-tags", tags, "-overlay", overlayFile, pkg)
+	cmd.Env = append(os.Environ(), "GO_FUZZ_TEST_CORPUS="+outDir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		// Failing tests still produce useful inputs.
+		fmt.Fprintf(os.Stderr, "go test failed, test corpus may be incomplete: %v\n%s\n", err, out)
+	}
+	seeds, _ := filepath.Glob(filepath.Join(outDir, "seed-*"))
+	fmt.Printf("captured %v test inputs into %v\n", len(seeds), outDir)
+}
+
+// rewriteTestCorpusFile inserts calls to goFuzzCapture into the functions names in file.
+func (c *Context) rewriteTestCorpusFile(file string, names []string) []byte {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+	if err != nil {
+		c.failf("failed to parse %v: %v", file, err)
+	}
+	if err := rewriteTestCorpus(f, c.fuzzpkg.Types.Scope(), names); err != nil {
+		c.failf("%v: %v", file, err)
+	}
+	buf := new(bytes.Buffer)
+	if err := format.Node(buf, fset, f); err != nil {
+		c.failf("failed to format %v: %v", file, err)
+	}
+	return buf.Bytes()
+}
+
+// rewriteTestCorpus inserts calls to goFuzzCapture for all arguments of the functions names
+// that have string or []byte underlying type (including named types and aliases).
+// Types of arguments are taken from the package scope.
+// Arguments are passed to goFuzzCapture as is, so that the inserted code
+// does not refer to any type names that can be shadowed in the function.
+func rewriteTestCorpus(f *ast.File, scope *types.Scope, names []string) error {
+	for _, name := range names {
+		var fn *ast.FuncDecl
+		for _, decl := range f.Decls {
+			if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil && d.Name.Name == name && d.Body != nil {
+				fn = d
+			}
+		}
+		obj, ok := scope.Lookup(name).(*types.Func)
+		if fn == nil || !ok {
+			return fmt.Errorf("could not find function %v", name)
+		}
+		params := obj.Type().(*types.Signature).Params()
+		var capture []ast.Stmt
+		idx := 0
+		for i, field := range fn.Type.Params.List {
+			if len(field.Names) == 0 {
+				// Parameters are either all named or all unnamed.
+				field.Names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("goFuzzArg%v", i))}
+			}
+			for j, id := range field.Names {
+				typ := params.At(idx).Type()
+				idx++
+				if !isCapturedType(typ) {
+					continue
+				}
+				if id.Name == "_" {
+					id.Name = fmt.Sprintf("goFuzzArg%v_%v", i, j)
+				}
+				capture = append(capture, &ast.ExprStmt{X: &ast.CallExpr{
+					Fun:  ast.NewIdent("goFuzzCapture"),
+					Args: []ast.Expr{ast.NewIdent(id.Name)},
+				}})
+			}
+		}
+		if len(capture) == 0 {
+			return fmt.Errorf("function %v has no []byte or string arguments", name)
+		}
+		fn.Body.List = append(capture, fn.Body.List...)
+	}
+	return nil
+}
+
+// isCapturedType reports whether arguments of type typ are captured into test corpus.
+func isCapturedType(typ types.Type) bool {
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		return t.Info()&types.IsString != 0
+	case *types.Slice:
+		elem, ok := t.Elem().Underlying().(*types.Basic)
+		return ok && elem.Kind() == types.Byte
+	}
+	return false
+}
+
+// testCorpusHelperSrc is added to the fuzz package during test corpus capturing.
+// Imports are renamed to not collide with package-level names.
+// goFuzzCapture accepts values of any type with string or []byte underlying type.
+var testCorpusHelperSrc = `package %v
+
+import (
+	gofuzzsha1 "crypto/sha1"
+	gofuzzhex "encoding/hex"
+	gofuzzioutil "io/ioutil"
+	gofuzzos "os"
+	gofuzzfilepath "path/filepath"
+	gofuzzreflect "reflect"
+)
+
+func goFuzzCapture(arg interface{}) {
+	dir := gofuzzos.Getenv("GO_FUZZ_TEST_CORPUS")
+	if dir == "" {
+		return
+	}
+	v := gofuzzreflect.ValueOf(arg)
+	var data []byte
+	if v.Kind() == gofuzzreflect.String {
+		data = []byte(v.String())
+	} else {
+		data = v.Bytes()
+	}
+	sum := gofuzzsha1.Sum(data)
+	name := gofuzzfilepath.Join(dir, "seed-"+gofuzzhex.EncodeToString(sum[:]))
+	gofuzzioutil.WriteFile(name, data, 0660)
+}
+`
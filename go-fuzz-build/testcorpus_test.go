@@ -0,0 +1,118 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestRewriteTestCorpus(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // rewritten body of F, empty if the rewrite fails
+	}{
+		{
+			src:  `func F(data []byte) int { return len(data) }`,
+			want: `goFuzzCapture(data); return len(data)`,
+		},
+		{
+			src:  `func F(s string, n int, b []byte) {}`,
+			want: `goFuzzCapture(s); goFuzzCapture(b)`,
+		},
+		{
+			src:  `func F(a, _ string, _ int) {}`,
+			want: `goFuzzCapture(a); goFuzzCapture(goFuzzArg0_1)`,
+		},
+		{
+			src:  `func F([]byte, int, string) {}`,
+			want: `goFuzzCapture(goFuzzArg0); goFuzzCapture(goFuzzArg2)`,
+		},
+		{
+			// Named types and aliases.
+			src: `type Str string
+				type Bytes []byte
+				type MyByte byte
+				type Alias = []byte
+				func F(s Str, b Bytes, m []MyByte, a Alias, r []rune, p *string) {}`,
+			want: `goFuzzCapture(s); goFuzzCapture(b); goFuzzCapture(m); goFuzzCapture(a)`,
+		},
+		{
+			// Shadowed type names.
+			src: `func F(string []byte, byte int, s2 string) {}
+				type string = int`,
+			want: `goFuzzCapture(string)`,
+		},
+		{
+			src:  `func F(n int, s ...string) {}`,
+			want: ``,
+		},
+		{
+			src:  `func G(data []byte) {}`,
+			want: ``,
+		},
+	}
+	for _, test := range tests {
+		src := "package p\n" + test.src + "\n"
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "test.go", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := new(types.Config).Check("p", fset, []*ast.File{f}, nil)
+		if err != nil {
+			t.Fatalf("%v: %v", test.src, err)
+		}
+		err = rewriteTestCorpus(f, pkg.Scope(), []string{"F"})
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%v: no error", test.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.src, err)
+			continue
+		}
+		var body []string
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "F" {
+				for _, stmt := range fn.Body.List {
+					buf := new(bytes.Buffer)
+					format.Node(buf, fset, stmt)
+					body = append(body, buf.String())
+				}
+			}
+		}
+		if got := strings.Join(body, "; "); got != test.want {
+			t.Errorf("%v:\ngot:  %v\nwant: %v", test.src, got, test.want)
+		}
+		// The rewritten file must build together with the helper.
+		buf := new(bytes.Buffer)
+		if err := format.Node(buf, fset, f); err != nil {
+			t.Fatal(err)
+		}
+		fset = token.NewFileSet()
+		f1, err := parser.ParseFile(fset, "test.go", buf.Bytes(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		helper, err := parser.ParseFile(fset, "helper.go", fmt.Sprintf(testCorpusHelperSrc, "p"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := &types.Config{Importer: importer.Default()}
+		if _, err := conf.Check("p", fset, []*ast.File{f1, helper}, nil); err != nil {
+			t.Errorf("%v: rewritten source does not build: %v\n%s", test.src, err, buf.Bytes())
+		}
+	}
+}
@@ -16,6 +16,14 @@ const (
 	SonarRegionSize = 1 << 20
 )
 
+// Commands sent by go-fuzz to the test binary.
+const (
+	CmdFuzz      = iota // run fuzz function on the input
+	CmdMutate           // run custom FuzzMutate function on the input
+	CmdCrossOver        // run custom FuzzCrossOver function on the two inputs
+	CmdSonar            // run fuzz function on the input and record sonar data
+)
+
 const (
 	SonarEQL = iota
 	SonarNEQ
@@ -31,6 +39,26 @@ const (
 	SonarConst1 = 1 << 6
 	SonarConst2 = 1 << 7
 
-	SonarHdrLen = 6
-	SonarMaxLen = 20
+	// SonarMapKey marks sites that compare a map key against keys of the map.
+	// Keys are visited in random order, so the site is not reproducible.
+	// It is stored only in sonar metadata, records carry the low 8 bits of flags.
+	SonarMapKey = 1 << 8
+
+	SonarHdrLen = 8       // id with flags (4 bytes), operand lengths (2 bytes each)
+	SonarMaxLen = 1 << 10 // longer operands are reported partially
+)
+
+// Periods of checks done by go-fuzz-dep, in milliseconds.
+// Regression tests generated by go-fuzz -gentest use the same values.
+const (
+	LeakGracePeriodMs = 100 // how long goroutines started by the fuzz function may run after it returns
+	MemCheckPeriodMs  = 10  // how often heap growth is checked while the fuzz function runs
+)
+
+// Kinds of bytes/strings package calls intercepted by sonar.
+const (
+	SonarCallEqual  = iota // Equal, EqualFold, Compare: operands are compared as a whole
+	SonarCallPrefix        // HasPrefix: v1 starts with v2
+	SonarCallSuffix        // HasSuffix: v1 ends with v2
+	SonarCallIndex         // Index, Contains: v2 is searched in v1
 )
@@ -20,3 +20,47 @@ type Bool = bool
 // It is replaced by a newly initialized array when it is
 // time for actual instrumentation to commence.
 var CoverTab = new([CoverSize]byte)
+
+// Uint64 and String are used by value profile instrumentation code
+// for the same reason as Bool.
+type (
+	Uint64 = uint64
+	String = string
+)
+
+// ValueProfile is called by instrumentation code in value profile mode
+// (go-fuzz-build -valueprofile) for comparisons of integers.
+// v is xor of the operands, id is unique id of the comparison.
+// Every number of differing bits gives a separate coverage counter,
+// so that inputs that make progress on the comparison are considered interesting.
+func ValueProfile(v uint64, id uint32) {
+	n := 0
+	for ; v != 0; v &= v - 1 {
+		n++
+	}
+	coverValue(id, n)
+}
+
+// ValueProfileString is the same as ValueProfile, but for strings.
+// Length of the common prefix of the operands is used as progress.
+func ValueProfileString(v1, v2 string, id uint32) {
+	n := 0
+	for n < len(v1) && n < len(v2) && n < valueProfileMax {
+		if v1[n] != v2[n] {
+			break
+		}
+		n++
+	}
+	coverValue(id, n)
+}
+
+const valueProfileMax = 63
+
+func coverValue(id uint32, v int) {
+	if v > valueProfileMax {
+		v = valueProfileMax
+	}
+	// Spread counters of all comparisons over CoverTab, like counters of basic blocks.
+	h := (id<<6 | uint32(v)) * 2654435761
+	CoverTab[h>>16%CoverSize]++
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// +build gofuzz
+// +build !gofuzz_libfuzzer
+
+package gofuzzdep
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// leakGracePeriod is how long we wait for goroutines started by the fuzz function
+// to finish before declaring them leaked.
+const leakGracePeriod = LeakGracePeriodMs * time.Millisecond
+
+// leakChecker detects goroutines leaked by the fuzz function.
+// It is enabled by go-fuzz with GO_FUZZ_LEAK_CHECK=1 environment variable.
+type leakChecker struct {
+	enabled bool
+	known   map[uint64]bool // goroutines that were running before fuzzing started
+	before  int             // number of goroutines before the current call
+	buf     []byte
+}
+
+func newLeakChecker() *leakChecker {
+	v, _ := syscall.Getenv("GO_FUZZ_LEAK_CHECK")
+	lc := &leakChecker{enabled: v == "1"}
+	if lc.enabled {
+		lc.known = make(map[uint64]bool)
+		stacks := lc.stacks()
+		for len(stacks) != 0 {
+			var g []byte
+			g, stacks = nextGoroutine(stacks)
+			lc.known[goroutineID(g)] = true
+		}
+	}
+	return lc
+}
+
+// start is called before each fuzz function invocation.
+func (lc *leakChecker) start() {
+	if !lc.enabled {
+		return
+	}
+	lc.before = runtime.NumGoroutine()
+}
+
+// check is called after each fuzz function invocation.
+// If the invocation leaked goroutines, it prints their stacks and exits.
+func (lc *leakChecker) check() {
+	if !lc.enabled || runtime.NumGoroutine() <= lc.before {
+		return
+	}
+	// Give the goroutines a chance to finish.
+	for t0 := time.Now(); time.Since(t0) < leakGracePeriod; {
+		runtime.Gosched()
+		if runtime.NumGoroutine() <= lc.before {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var leaked [][]byte
+	stacks := lc.stacks()
+	for len(stacks) != 0 {
+		var g []byte
+		g, stacks = nextGoroutine(stacks)
+		if !lc.known[goroutineID(g)] {
+			leaked = append(leaked, g)
+		}
+	}
+	if len(leaked) == 0 {
+		// Goroutines have finished in the meantime.
+		return
+	}
+	// The header line is used by go-fuzz to recognize the crash,
+	// and the first goroutine stack to build crash suppression.
+	print("goroutine leak: fuzz function returned leaving running goroutines\n")
+	print("leaked goroutines: ", len(leaked), "\n")
+	for _, g := range leaked {
+		print("\n", string(g), "\n")
+	}
+	syscall.Exit(1)
+}
+
+// stacks returns stacks of all goroutines except the current one.
+func (lc *leakChecker) stacks() []byte {
+	if lc.buf == nil {
+		lc.buf = make([]byte, 64<<10)
+	}
+	for {
+		n := runtime.Stack(lc.buf, true)
+		if n < len(lc.buf) {
+			_, others := nextGoroutine(lc.buf[:n])
+			return others
+		}
+		lc.buf = make([]byte, 2*len(lc.buf))
+	}
+}
+
+// nextGoroutine splits runtime.Stack output into the first goroutine stack and the rest.
+func nextGoroutine(stacks []byte) (g, rest []byte) {
+	for i := 0; i+1 < len(stacks); i++ {
+		if stacks[i] == '\n' && stacks[i+1] == '\n' {
+			return stacks[:i], stacks[i+2:]
+		}
+	}
+	return stacks, nil
+}
+
+// goroutineID parses goroutine id from goroutine stack header of the form:
+//	goroutine 18 [chan receive]:
+func goroutineID(g []byte) uint64 {
+	const prefix = "goroutine "
+	if len(g) < len(prefix) || string(g[:len(prefix)]) != prefix {
+		return 0
+	}
+	var id uint64
+	for _, c := range g[len(prefix):] {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uint64(c-'0')
+	}
+	return id
+}
@@ -8,6 +8,7 @@ package gofuzzdep
 
 import (
 	"runtime"
+	"runtime/metrics"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -16,33 +17,91 @@ import (
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
 )
 
+// CustomMutator and CustomCrossOver are set by go-fuzz-build generated main
+// to FuzzMutate and FuzzCrossOver functions of the fuzz package, if present.
+var (
+	CustomMutator   func(data []byte, seed uint64, maxSize int) []byte
+	CustomCrossOver func(data1, data2 []byte, seed uint64, maxSize int) []byte
+)
+
 func Main(fns []func([]byte) int) {
 	mem, inFD, outFD := setupCommFile()
 	CoverTab = (*[CoverSize]byte)(unsafe.Pointer(&mem[0]))
 	input := mem[CoverSize : CoverSize+MaxInputSize]
 	sonarRegion = mem[CoverSize+MaxInputSize:]
 	runtime.GOMAXPROCS(1) // makes coverage more deterministic, we parallelize on higher level
+	memLimit := newMemChecker()
+	leaks := newLeakChecker()
+	allocStats, _ := syscall.Getenv("GO_FUZZ_ALLOC_STATS")
+	// Unlike runtime.ReadMemStats, reading metrics does not stop the world.
+	allocSample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
 	for {
-		fnidx, n := read(inFD)
-		if n > uint64(len(input)) {
+		cmd, fnidx, n, n2, seed, maxSize := read(inFD)
+		if n+n2 > uint64(len(input)) || maxSize > uint64(len(input)) {
 			println("invalid input length")
 			syscall.Exit(1)
 		}
+		if cmd != CmdFuzz && cmd != CmdSonar {
+			res := mutate(cmd, input, n, n2, seed, maxSize)
+			write(outFD, res, 0, 0, 0)
+			continue
+		}
 		for i := range CoverTab {
 			CoverTab[i] = 0
 		}
 		atomic.StoreUint32(&sonarPos, 0)
+		// A binary built with go-fuzz-build -single contains both coverage and sonar
+		// instrumentation, comparisons are recorded only when go-fuzz asks for them.
+		sonar := uint32(0)
+		if cmd == CmdSonar {
+			sonar = 1
+		}
+		atomic.StoreUint32(&sonarEnabled, sonar)
+		memLimit.start()
+		leaks.start()
+		var alloc uint64
+		if allocStats == "1" {
+			metrics.Read(allocSample)
+			alloc = allocSample[0].Value.Uint64()
+		}
 		t0 := time.Now()
 		res := fns[fnidx](input[:n:n])
 		ns := time.Since(t0)
-		write(outFD, uint64(res), uint64(ns), uint64(atomic.LoadUint32(&sonarPos)))
+		if allocStats == "1" {
+			metrics.Read(allocSample)
+			alloc = allocSample[0].Value.Uint64() - alloc
+		}
+		memLimit.check()
+		leaks.check()
+		write(outFD, uint64(res), uint64(ns), uint64(atomic.LoadUint32(&sonarPos)), alloc)
+	}
+}
+
+// mutate runs custom mutator on the input and stores the result into input.
+// Returns length of the result.
+func mutate(cmd uint8, input []byte, n, n2, seed, maxSize uint64) uint64 {
+	var res []byte
+	switch {
+	case cmd == CmdMutate && CustomMutator != nil:
+		res = CustomMutator(input[:n:n], seed, int(maxSize))
+	case cmd == CmdCrossOver && CustomCrossOver != nil:
+		res = CustomCrossOver(input[:n:n], input[n:n+n2:n+n2], seed, int(maxSize))
+	default:
+		println("unsupported command", cmd)
+		syscall.Exit(1)
+	}
+	if uint64(len(res)) > maxSize {
+		res = res[:maxSize]
 	}
+	return uint64(copy(input, res))
 }
 
-// read reads little-endian-encoded uint8+uint64 from fd.
-func read(fd FD) (uint8, uint64) {
+// read reads little-endian-encoded command header from fd:
+// uint8 command, uint8 function index, uint64 input length, uint64 second input length,
+// uint64 random seed and uint64 max result size (the last three are used only by mutators).
+func read(fd FD) (cmd, fnidx uint8, n, n2, seed, maxSize uint64) {
 	rd := 0
-	var buf [9]byte
+	var buf [34]byte
 	for rd != len(buf) {
 		n, err := fd.read(buf[rd:])
 		if err == syscall.EINTR {
@@ -57,12 +116,12 @@ func read(fd FD) (uint8, uint64) {
 		}
 		rd += n
 	}
-	return buf[0], deserialize64(buf[1:])
+	return buf[0], buf[1], deserialize64(buf[2:]), deserialize64(buf[10:]), deserialize64(buf[18:]), deserialize64(buf[26:])
 }
 
 // write writes little-endian-encoded vals... to fd.
 func write(fd FD, vals ...uint64) {
-	var tmp [3 * 8]byte
+	var tmp [4 * 8]byte
 	buf := tmp[:len(vals)*8]
 	for i, v := range vals {
 		serialize64(buf[i*8:], v)
@@ -0,0 +1,131 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// +build gofuzz
+// +build !gofuzz_libfuzzer
+
+package gofuzzdep
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// memCheckPeriod is how often heap size is checked while the fuzz function runs.
+const memCheckPeriod = MemCheckPeriodMs * time.Millisecond
+
+// heapMetric is size of heap objects (including not yet swept garbage).
+// Unlike runtime.ReadMemStats, reading metrics does not stop the world.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// memChecker enforces heap growth limit passed by go-fuzz in GO_FUZZ_MEM_LIMIT
+// environment variable (in bytes). Heap growth since the start of the current input
+// is checked after every input and periodically in background, to catch inputs
+// that allocate in a loop. Heap retained by previous inputs is not accounted
+// to the current input.
+type memChecker struct {
+	base   uint64 // heap size at the start of the current input, accessed atomically
+	limit  uint64
+	sample []metrics.Sample
+}
+
+func newMemChecker() *memChecker {
+	mc := &memChecker{sample: []metrics.Sample{{Name: heapMetric}}}
+	v, _ := syscall.Getenv("GO_FUZZ_MEM_LIMIT")
+	for _, c := range []byte(v) {
+		if c < '0' || c > '9' {
+			println("bad GO_FUZZ_MEM_LIMIT value:", v)
+			syscall.Exit(1)
+		}
+		mc.limit = mc.limit*10 + uint64(c-'0')
+	}
+	if mc.limit != 0 {
+		go func() {
+			sample := []metrics.Sample{{Name: heapMetric}}
+			for {
+				time.Sleep(memCheckPeriod)
+				mc.checkHeap(sample)
+			}
+		}()
+	}
+	return mc
+}
+
+// start is called before each fuzz function invocation.
+func (mc *memChecker) start() {
+	if mc.limit == 0 {
+		return
+	}
+	atomic.StoreUint64(&mc.base, heapSize(mc.sample))
+}
+
+// check is called after each fuzz function invocation.
+func (mc *memChecker) check() {
+	if mc.limit == 0 {
+		return
+	}
+	mc.checkHeap(mc.sample)
+}
+
+func (mc *memChecker) checkHeap(sample []metrics.Sample) {
+	base := atomic.LoadUint64(&mc.base)
+	if heapSize(sample) <= base+mc.limit {
+		return
+	}
+	// The heap includes garbage, see if it still grew too much after GC.
+	runtime.GC()
+	heap := heapSize(sample)
+	if heap <= base+mc.limit {
+		return
+	}
+	// The header line is used by go-fuzz to recognize the crash,
+	// and the first allocation site to build crash suppression.
+	print("out of memory: heap growth exceeds -memlimit\n")
+	print("heap growth: ", (heap-base)>>20, " MB, limit: ", mc.limit>>20, " MB\n")
+	printMemProfile()
+	syscall.Exit(1)
+}
+
+func heapSize(sample []metrics.Sample) uint64 {
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// printMemProfile prints stacks of allocation sites with the largest in-use heap size.
+func printMemProfile() {
+	const maxSites = 10
+	var records []runtime.MemProfileRecord
+	for {
+		n, ok := runtime.MemProfile(records, false)
+		if ok {
+			records = records[:n]
+			break
+		}
+		records = make([]runtime.MemProfileRecord, n+50)
+	}
+	for i := 0; i < maxSites && i < len(records); i++ {
+		// Selection sort is fine, we need only few top records.
+		max := i
+		for j := i + 1; j < len(records); j++ {
+			if records[j].InUseBytes() > records[max].InUseBytes() {
+				max = j
+			}
+		}
+		records[i], records[max] = records[max], records[i]
+		r := &records[i]
+		print("\n", r.InUseBytes(), " bytes in ", r.InUseObjects(), " objects:\n")
+		frames := runtime.CallersFrames(r.Stack())
+		for {
+			f, more := frames.Next()
+			print(f.Function, "(...)\n\t", f.File, ":", f.Line, "\n")
+			if !more {
+				break
+			}
+		}
+	}
+}
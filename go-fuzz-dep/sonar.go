@@ -13,27 +13,38 @@ import (
 )
 
 var (
-	sonarRegion []byte
-	sonarPos    uint32
+	sonarRegion  []byte
+	sonarPos     uint32
+	sonarEnabled uint32 // set for CmdSonar executions
 )
 
-const failure = ^uint8(0)
+// sonarBufLen is the max size of serialized numbers and byte arrays.
+const sonarBufLen = 20
 
 type iface struct {
 	typ unsafe.Pointer
 	val unsafe.Pointer
 }
 
+// SonarEnabled says whether comparisons are recorded in the current execution.
+// Instrumentation code checks it before doing extra work to report comparisons.
+func SonarEnabled() bool {
+	return atomic.LoadUint32(&sonarEnabled) != 0
+}
+
 // Sonar is called by instrumentation code to notify go-fuzz about comparisons.
 // Low 8 bits of id are flags, the rest is unique id of a comparison.
 func Sonar(v1, v2 interface{}, id uint32) {
-	var buf [SonarHdrLen + 2*SonarMaxLen]byte
-	n1, f1 := serialize(v1, v2, buf[SonarHdrLen:])
-	if n1 == failure {
+	if atomic.LoadUint32(&sonarEnabled) == 0 {
 		return
 	}
-	n2, f2 := serialize(v2, v1, buf[SonarHdrLen+n1:])
-	if n2 == failure {
+	var buf1, buf2 [sonarBufLen]byte
+	s1, f1, ok := serialize(v1, v2, buf1[:])
+	if !ok {
+		return
+	}
+	s2, f2, ok := serialize(v2, v1, buf2[:])
+	if !ok {
 		return
 	}
 	// Ideal const operands are converted to signed int,
@@ -45,14 +56,91 @@ func Sonar(v1, v2 interface{}, id uint32) {
 	if id&SonarConst2 != 0 {
 		f2 &^= SonarSigned
 	}
-	id |= uint32(f1 | f2)
-	serialize32(buf[:], id)
-	buf[4] = n1
-	buf[5] = n2
-	n := uint32(SonarHdrLen + n1 + n2)
+	sonarRecord(s1, s2, id|uint32(f1|f2))
+}
+
+// SonarBytes is called by instrumentation code to notify go-fuzz about
+// comparisons done by bytes package functions (bytes.Equal(v1, v2), bytes.HasPrefix(v1, v2), etc).
+// kind is one of SonarCall* constants. It returns the operands unchanged,
+// so that the instrumented call looks as:
+//
+//	bytes.Equal(go-fuzz-dep.SonarBytes(v1, v2, id, kind))
+func SonarBytes(v1, v2 []byte, id uint32, kind int) ([]byte, []byte) {
+	sonarCall(*(*string)(unsafe.Pointer(&v1)), *(*string)(unsafe.Pointer(&v2)), id, kind)
+	return v1, v2
+}
+
+// SonarStrings is the same as SonarBytes, but for strings package functions.
+func SonarStrings(v1, v2 string, id uint32, kind int) (string, string) {
+	sonarCall(v1, v2, id, kind)
+	return v1, v2
+}
+
+// sonarIndexMatch is the max prefix of the searched string we try to match in sonarCall.
+const sonarIndexMatch = 64
+
+func sonarCall(v1, v2 string, id uint32, kind int) {
+	if atomic.LoadUint32(&sonarEnabled) == 0 {
+		return
+	}
+	switch kind {
+	case SonarCallPrefix:
+		if len(v1) > len(v2) {
+			v1 = v1[:len(v2)]
+		}
+	case SonarCallSuffix:
+		if len(v1) > len(v2) {
+			v1 = v1[len(v1)-len(v2):]
+		}
+	case SonarCallIndex:
+		// v2 is searched in v1. Report the part of v1 that matches the longest prefix of v2.
+		if len(v2) == 0 {
+			return
+		}
+		best, bestLen := 0, -1
+		for i := 0; i < len(v1) && bestLen < len(v2) && bestLen < sonarIndexMatch; i++ {
+			n := 0
+			for n < len(v2) && i+n < len(v1) && n < sonarIndexMatch && v1[i+n] == v2[n] {
+				n++
+			}
+			if n > bestLen {
+				best, bestLen = i, n
+			}
+		}
+		v1 = v1[best:]
+		if len(v1) > len(v2) {
+			v1 = v1[:len(v2)]
+		}
+	}
+	sonarRecord(v1, v2, id|SonarString)
+}
+
+// sonarRecord writes a comparison record to the sonar region.
+// Record format: id with flags (4 bytes), length of v1 and v2 (2 bytes each), v1, v2.
+// Operands longer than SonarMaxLen are reported as a window around the first difference.
+// Long records can use only first half of the region, so that they don't crowd out
+// short records (which are more frequent and are cheaper to process).
+func sonarRecord(v1, v2 string, id uint32) {
+	if len(v1) > SonarMaxLen || len(v2) > SonarMaxLen {
+		i := 0
+		for i < len(v1) && i < len(v2) && v1[i] == v2[i] {
+			i++
+		}
+		start := i - SonarMaxLen/2
+		if start < 0 {
+			start = 0
+		}
+		v1 = sonarWindow(v1, start)
+		v2 = sonarWindow(v2, start)
+	}
+	n := uint32(SonarHdrLen + len(v1) + len(v2))
+	limit := uint32(len(sonarRegion))
+	if n > SonarHdrLen+2*sonarBufLen {
+		limit /= 2
+	}
 	pos := atomic.LoadUint32(&sonarPos)
 	for {
-		if pos+n > uint32(len(sonarRegion)) {
+		if pos+n > limit {
 			return
 		}
 		if atomic.CompareAndSwapUint32(&sonarPos, pos, pos+n) {
@@ -60,86 +148,104 @@ func Sonar(v1, v2 interface{}, id uint32) {
 		}
 		pos = atomic.LoadUint32(&sonarPos)
 	}
-	copy(sonarRegion[pos:pos+n], buf[:])
+	rec := sonarRegion[pos : pos+n]
+	serialize32(rec, id)
+	serialize16(rec[4:], uint16(len(v1)))
+	serialize16(rec[6:], uint16(len(v2)))
+	copy(rec[SonarHdrLen:], v1)
+	copy(rec[SonarHdrLen+len(v1):], v2)
+}
+
+func sonarWindow(v string, start int) string {
+	if start > len(v) {
+		start = len(v)
+	}
+	v = v[start:]
+	if len(v) > SonarMaxLen {
+		v = v[:SonarMaxLen]
+	}
+	return v
 }
 
-func serialize(v, v2 interface{}, buf []byte) (n, flags uint8) {
+// serialize serializes comparison operand v (v2 is the other operand) into buf.
+// Strings are not copied, the result refers to the string data.
+func serialize(v, v2 interface{}, buf []byte) (res string, flags uint8, ok bool) {
+	str := func(b []byte) string {
+		return *(*string)(unsafe.Pointer(&b))
+	}
 	switch vv := v.(type) {
 	case int8:
 		buf[0] = byte(vv)
-		return 1, SonarSigned
+		return str(buf[:1]), SonarSigned, true
 	case uint8:
 		buf[0] = byte(vv)
-		return 1, 0
+		return str(buf[:1]), 0, true
 	case int16:
-		return serialize16(buf, uint16(vv)), SonarSigned
+		return str(buf[:serialize16(buf, uint16(vv))]), SonarSigned, true
 	case uint16:
-		return serialize16(buf, vv), 0
+		return str(buf[:serialize16(buf, vv)]), 0, true
 	case int32:
-		return serialize32(buf, uint32(vv)), SonarSigned
+		return str(buf[:serialize32(buf, uint32(vv))]), SonarSigned, true
 	case uint32:
-		return serialize32(buf, vv), 0
+		return str(buf[:serialize32(buf, vv)]), 0, true
 	case int64:
-		return serialize64(buf, uint64(vv)), SonarSigned
+		return str(buf[:serialize64(buf, uint64(vv))]), SonarSigned, true
 	case uint64:
-		return serialize64(buf, vv), 0
+		return str(buf[:serialize64(buf, vv)]), 0, true
 	case int:
 		if unsafe.Sizeof(vv) == 4 {
-			return serialize32(buf, uint32(vv)), SonarSigned
+			return str(buf[:serialize32(buf, uint32(vv))]), SonarSigned, true
 		} else {
-			return serialize64(buf, uint64(vv)), SonarSigned
+			return str(buf[:serialize64(buf, uint64(vv))]), SonarSigned, true
 		}
 	case uint:
 		if unsafe.Sizeof(vv) == 4 {
-			return serialize32(buf, uint32(vv)), 0
+			return str(buf[:serialize32(buf, uint32(vv))]), 0, true
 		} else {
-			return serialize64(buf, uint64(vv)), 0
+			return str(buf[:serialize64(buf, uint64(vv))]), 0, true
 		}
 	case string:
-		if len(vv) > SonarMaxLen {
-			return failure, 0
-		}
-		return uint8(copy(buf, vv)), SonarString
+		return vv, SonarString, true
 	case [1]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [2]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [3]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [4]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [5]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [6]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [7]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [8]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [9]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [10]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [11]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [12]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [13]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [14]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [15]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [16]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [17]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [18]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [19]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	case [20]byte:
-		return uint8(copy(buf, vv[:])), SonarString
+		return str(buf[:copy(buf, vv[:])]), SonarString, true
 	default:
 		// Special case: string literal is compared with a variable of
 		// user type with string underlying type:
@@ -148,11 +254,9 @@ func serialize(v, v2 interface{}, buf []byte) (n, flags uint8) {
 		//	if name == "foo" { ... }
 		if _, ok := v2.(string); ok {
 			s := *(*string)((*iface)(unsafe.Pointer(&v)).val)
-			if len(s) <= SonarMaxLen {
-				return uint8(copy(buf[:], s)), SonarString
-			}
+			return s, SonarString, true
 		}
-		return failure, 0
+		return "", 0, false
 	}
 }
 
@@ -0,0 +1,153 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// +build gofuzz
+
+package gofuzzdep
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+type sonarRec struct {
+	id     uint32
+	v1, v2 string
+}
+
+// resetSonar sets up an empty sonar region of the given size.
+func resetSonar(size int) {
+	sonarRegion = make([]byte, size)
+	atomic.StoreUint32(&sonarPos, 0)
+	atomic.StoreUint32(&sonarEnabled, 1)
+}
+
+// sonarRecords returns records written to the sonar region.
+func sonarRecords() []sonarRec {
+	var recs []sonarRec
+	data := sonarRegion[:atomic.LoadUint32(&sonarPos)]
+	for len(data) != 0 {
+		id := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+		n1 := int(data[4]) | int(data[5])<<8
+		n2 := int(data[6]) | int(data[7])<<8
+		data = data[SonarHdrLen:]
+		recs = append(recs, sonarRec{id, string(data[:n1]), string(data[n1 : n1+n2])})
+		data = data[n1+n2:]
+	}
+	return recs
+}
+
+func TestSonarCall(t *testing.T) {
+	long := strings.Repeat("a", 2*sonarIndexMatch)
+	tests := []struct {
+		kind   int
+		v1, v2 string
+		want1  string // reported v1, v2 is reported as is
+	}{
+		{SonarCallEqual, "foo", "foobar", "foo"},
+		{SonarCallEqual, "foobar", "foo", "foobar"},
+		{SonarCallPrefix, "PNGabcdef", "PNG\x89", "PNGa"},
+		{SonarCallPrefix, "PN", "PNG\x89", "PN"},
+		{SonarCallSuffix, "image.jpeg", ".png", "jpeg"},
+		{SonarCallSuffix, "png", ".png", "png"},
+		// The window starts at the longest match of a prefix of v2.
+		{SonarCallIndex, "xxabcyyabcdzz", "abcde", "abcdz"},
+		{SonarCallIndex, "xxabyyabc", "abcde", "abc"},
+		{SonarCallIndex, "xyz", "abc", "xyz"},
+		{SonarCallIndex, "xyzxyz", "abc", "xyz"},
+		// The first full match of sonarIndexMatch bytes wins.
+		{SonarCallIndex, "b" + long + "c", long, long},
+	}
+	for _, test := range tests {
+		resetSonar(SonarRegionSize)
+		sonarCall(test.v1, test.v2, 1<<8, test.kind)
+		recs := sonarRecords()
+		want := []sonarRec{{1<<8 | SonarString, test.want1, test.v2}}
+		if len(recs) != 1 || recs[0] != want[0] {
+			t.Errorf("kind %v, %q, %q: got %+v, want %+v", test.kind, test.v1, test.v2, recs, want)
+		}
+	}
+	// Empty pattern matches anything, nothing to report.
+	resetSonar(SonarRegionSize)
+	sonarCall("foo", "", 1<<8, SonarCallIndex)
+	if recs := sonarRecords(); len(recs) != 0 {
+		t.Errorf("empty pattern is reported: %+v", recs)
+	}
+	// Nothing is reported for non-sonar executions.
+	resetSonar(SonarRegionSize)
+	atomic.StoreUint32(&sonarEnabled, 0)
+	SonarStrings("foo", "bar", 1<<8, SonarCallEqual)
+	SonarBytes([]byte("foo"), []byte("bar"), 1<<8, SonarCallEqual)
+	if recs := sonarRecords(); len(recs) != 0 {
+		t.Errorf("disabled sonar reported: %+v", recs)
+	}
+}
+
+var flagUpdate = flag.Bool("update", false, "update testdata/sonar.golden")
+
+// TestSonarRecord writes records to a small sonar region and compares the region
+// with testdata/sonar.golden, go-fuzz tests parse the same file with parseSonarData.
+// The region is 4096 bytes: a short string record (site 1), a long record (site 2)
+// with operands that differ at offset 3000, a long record (site 3) that does not fit
+// into the first half of the region, and string records "k%04d"/"v%04d" (sites 4, 5, ...)
+// until the region is full.
+func TestSonarRecord(t *testing.T) {
+	const regionSize = 4096
+	resetSonar(regionSize)
+	sonarRecord("abc", "abd", 1<<8|SonarString)
+	long1 := strings.Repeat("a", 3000) + "X" + strings.Repeat("b", 1000)
+	long2 := strings.Repeat("a", 3000) + "Y" + strings.Repeat("c", 10)
+	sonarRecord(long1, long2, 2<<8|SonarString)
+	sonarRecord(long1, long2, 3<<8|SonarString)
+	short := 0
+	for id := uint32(4); ; id++ {
+		pos := atomic.LoadUint32(&sonarPos)
+		sonarRecord(fmt.Sprintf("k%04d", id), fmt.Sprintf("v%04d", id), id<<8|SonarString)
+		if atomic.LoadUint32(&sonarPos) == pos {
+			break
+		}
+		short++
+	}
+	recs := sonarRecords()
+	if len(recs) != 2+short {
+		t.Fatalf("got %v records, want %v", len(recs), 2+short)
+	}
+	if recs[0] != (sonarRec{1<<8 | SonarString, "abc", "abd"}) {
+		t.Errorf("bad short record: %+v", recs[0])
+	}
+	// The window starts SonarMaxLen/2 bytes before the first difference.
+	start := 3000 - SonarMaxLen/2
+	if want := (sonarRec{2<<8 | SonarString, long1[start : start+SonarMaxLen], long2[start:]}); recs[1] != want {
+		t.Errorf("bad long record: id=%x len=%v/%v", recs[1].id, len(recs[1].v1), len(recs[1].v2))
+	}
+	for i, rec := range recs[2:] {
+		if id := uint32(i + 4); rec.id != id<<8|SonarString || rec.v1 != fmt.Sprintf("k%04d", id) {
+			t.Fatalf("bad record #%v: %+v", i+2, rec)
+		}
+	}
+	if free := regionSize - atomic.LoadUint32(&sonarPos); free >= SonarHdrLen+10 {
+		t.Errorf("region is not full: %v bytes free", free)
+	}
+	data := sonarRegion[:atomic.LoadUint32(&sonarPos)]
+	golden := filepath.Join("testdata", "sonar.golden")
+	if *flagUpdate {
+		if err := ioutil.WriteFile(golden, data, 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("sonar region differs from %v, run go test -tags gofuzz -update to update it", golden)
+	}
+}
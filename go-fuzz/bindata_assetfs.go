@@ -4,7 +4,7 @@
 // assets/bootstrap.min.css (122.54kB)
 // assets/bootstrap.min.js (36.816kB)
 // assets/jquery.min.js (95.992kB)
-// assets/stats.html (3.868kB)
+// assets/stats.html (4.621kB)
 
 package main
 
@@ -155,7 +155,7 @@ func assetsJqueryMinJs() (*asset, error) {
 	return a, nil
 }
 
-var _assetsStatsHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xbc\x57\xff\x6f\xdb\xb6\x12\xff\xd9\xfa\x2b\x2e\xea\x03\x2c\xa1\x91\x14\xa7\xe9\x43\x91\xc8\x7e\x7d\x48\xdd\x2d\x43\xbf\x61\xc9\x56\x0c\xeb\x7e\xa0\xc5\xb3\xc5\x46\x22\x35\xf2\x64\xc7\x0d\xf2\xbf\x0f\xa4\x24\x47\x76\x9a\x76\x19\x86\x00\x06\x7c\xbc\xfb\xdc\xf1\x73\xc7\x2f\x47\xa5\x7b\xaf\xde\x9f\x5e\xfc\xf6\x61\x0a\x39\x95\xc5\xc4\x4b\xdb\xbf\x42\xc8\x4b\xd0\x58\x8c\x7d\x43\xeb\x02\x4d\x8e\x48\x3e\xe4\x1a\xe7\x63\x3f\x99\x29\x45\x86\x34\xab\xe2\x52\xc8\x38\x33\xc6\xff\xdb\x1e\x11\xe5\x58\x62\xcf\xcf\x4b\x67\x8a\xaf\x27\x1e\x40\xca\xc5\x12\xb2\x82\x19\x33\xf6\x33\x25\x89\x09\x89\x3a\x9a\x17\xb5\xe0\xbe\xb5\x6f\x23\xb4\x5a\xb5\xda\x5d\xcf\x22\x32\x65\x34\x3a\x04\x2b\x95\xdc\x4a\x25\x13\x72\x03\x06\x48\xf3\x51\x87\xae\xd8\x02\xa3\x1c\x19\x47\xed\x4f\x7e\x50\xf0\xba\xfe\xf2\x25\x4d\xf2\x51\x0f\xbc\x3d\x27\x54\x05\xcb\x30\x57\x05\x47\x6d\x7a\x31\xef\x92\xb8\x32\xd1\x33\xe8\xd8\xf4\xdd\xb6\xbc\x2c\x9b\x23\x10\x7c\xec\xaf\x94\xbe\x74\x31\xd3\x24\x3f\xda\x81\x98\x8a\xc9\x2e\x36\xe1\x15\x45\x65\x4d\xc8\xfd\xc9\xc7\xc6\x27\x4d\x2c\x60\x8b\x4c\xc2\xc5\xf2\xdf\x64\x97\x29\x5d\xd5\x0f\x23\x77\xea\x5c\x1e\x83\x9b\x66\x26\x7f\x68\xe9\x4e\x5b\xa7\x47\xe0\xa7\xd1\x10\xd3\xf4\x30\x7e\x3f\xb7\x4e\xff\x8c\xdf\xd1\x43\xf8\xe1\x15\x66\x0f\x23\x37\xb5\x1e\x8f\xc0\x2c\x53\x4b\x6b\x7b\xd0\xa6\x5b\xa2\x7e\x04\x66\x75\x45\xa2\xc4\x07\x51\xfb\xc5\xb9\x7c\x97\x5b\x3b\xec\xdd\x56\x87\x5d\x34\x53\xcf\x36\x97\xd5\x8f\xc2\x90\xd2\xeb\x34\xc9\x0f\xbf\x7e\x59\x11\x9b\x15\x18\x69\x34\x95\x92\x46\x2c\x71\xfb\xb2\x72\xd6\x2d\x28\x34\x0e\x86\xb4\xa8\x90\xef\xa6\x4d\x76\xde\x6d\x9d\xd5\xea\x5d\x95\x83\xde\xde\x4b\x94\x7f\x1d\xd0\xdd\x0d\xf7\xda\x37\xa7\xf3\x3e\xc4\xed\xf9\xb8\x0f\xd1\x6e\xd2\xfb\x29\xb8\x9d\x72\x9f\xb9\x5b\xad\xbb\xf6\x34\xd9\x4d\xdb\xa2\x5c\x79\x06\x8d\xb7\xeb\x68\x69\xd2\xfc\x5b\x65\x9a\xb8\xe2\xde\x59\xe4\x3b\x83\x8d\xd8\x0a\xdd\x66\xf0\x52\x93\x69\x51\x11\x18\x9d\x8d\xfd\xe4\xf3\x9f\x35\xea\xb5\xeb\xa2\x9f\xdd\xc9\x6d\xac\x93\x1d\xd8\x76\x9f\xde\x46\x7a\x5e\xba\x17\x45\x70\x91\x23\xcc\x55\x51\xa8\x95\x90\x0b\x48\x5d\xeb\x9e\x00\x93\x1c\xda\x50\x13\x98\x15\x2a\xbb\x34\x60\xfb\x13\x30\xad\x6a\xc9\x81\x81\xa9\x30\x13\x73\x91\xc1\xac\x5e\xc0\x4a\x50\x0e\x2b\xc1\x29\xf7\x84\x84\xb3\x29\x8c\x0e\x40\x48\xf8\x28\x24\x57\x2b\x03\x2f\x5c\xbc\x6e\xf4\x21\x57\x12\xe1\x45\x0c\xe7\x88\xc7\x5e\x4e\x54\x1d\x27\xc9\x02\xe9\x96\x6c\xa6\x4a\xab\x20\x21\x17\x91\x5b\x64\xe4\xc9\x13\x53\x57\x95\xd2\x14\x09\x1c\x1d\x44\x6e\x2e\x88\x22\x9b\xb0\x63\xec\xbd\x8c\x56\x38\xbb\x14\x14\x2d\x05\xae\x2c\x10\x00\xae\x1b\x4e\xc7\xc0\x71\x29\x32\x6c\xbc\x4e\xe0\xc6\x7b\x19\x95\xea\x4b\x1f\xf9\x1d\xb0\xd9\xc1\x7e\x0b\xac\x76\xb1\xdf\x00\xef\x22\xbf\x05\x4e\x93\x36\xd3\x6e\x5d\xbc\x24\x81\x53\x55\xad\xb5\x58\xe4\x04\x87\x07\xa3\xa3\xe8\xf0\x60\xf4\x1c\x2e\x56\x82\x08\xf5\x3e\x9c\xc9\x2c\xb6\xa0\x37\x22\x43\x69\x90\x43\x2d\x39\x6a\x78\x7b\x76\x01\x81\x2d\xbb\xb1\x75\x17\x94\xd7\x33\x57\x71\x5a\xcd\xcc\xed\x8e\x49\x66\x85\x9a\x25\x25\x33\x84\x3a\x79\x73\x76\x3a\x7d\x77\x3e\x0d\x3d\x31\x87\x40\xb2\xa5\x58\x30\x52\x3a\xae\x0d\xea\xff\x2f\x50\x52\x5c\x32\xca\xf2\x20\x39\x9b\xbe\x55\x33\x51\xe0\xa7\x64\x74\xf0\x29\x3e\x48\xc2\x10\xae\xbd\xc1\x92\x69\x28\xcd\xaf\x6d\xae\xe7\x36\x0b\x18\x03\x57\x59\x5d\x5a\xdf\x4c\x23\x23\x9c\x16\x68\x47\xc1\xd0\x65\x39\x0c\xbd\xc1\x8e\x4b\xcc\xaa\x0a\x25\x3f\xcd\x45\xc1\x03\x6f\x30\xd8\xf1\xbf\xc0\x2b\x7a\xa7\x38\x5a\xd3\x60\xb8\xb5\x66\xd7\x4d\x45\x59\x4d\x6a\x4f\x94\x56\xc3\x24\xdd\x0c\xbd\xc1\x20\xf4\xec\x6f\x13\xc9\x1d\xaa\x73\x2c\x30\x23\xa5\x83\xa1\x3d\xd2\xc3\x70\x6b\xde\x1d\x4e\xa1\xe7\xd6\xa5\x3b\x51\xfd\x95\x79\x2d\xb4\xa1\x7d\xc8\x72\xb4\x67\x47\xcc\x41\x10\x08\x23\x87\x04\xa2\xac\x9a\x5c\x91\xc3\x1a\x29\x76\x45\xdd\x3b\x27\x2d\xe4\x22\xae\xb4\x22\x45\xeb\x0a\xe3\xb9\xd2\x25\x23\x57\xc0\x7b\x6c\x30\x86\x79\x2d\x33\x12\x4a\x06\x0e\xe7\x2a\xcd\xf4\xc2\xc0\xd8\xfe\xb9\xa4\xcc\x89\x37\x18\x68\xa4\x5a\x4b\xa0\x5c\x98\x58\xa3\x6b\x6e\x41\x72\x1d\x7c\xe2\x4f\xc3\x9b\x64\xb1\x7f\x1b\xc6\xad\xe3\x3e\xc8\xba\x9c\xa1\x6e\x62\x6e\x9c\xd7\x15\xaa\xb9\x0b\xff\x7b\x63\xff\x03\xf6\xc6\x30\xb4\x9b\x6a\x2e\x24\x72\x5b\xd0\xc1\xff\xb6\x00\x56\x73\x0c\x2e\xa8\x15\x2d\x95\x9b\xf0\xc4\x1b\xdc\x9c\x78\x37\x9e\x67\xd9\x6a\xb5\x7a\x5d\xda\x4c\x7c\xdb\x4b\x52\xe2\x93\xeb\x83\x9b\x34\x21\xde\xc8\xa3\x9e\x7c\xd8\x93\x9f\xf5\xe4\xa3\x9e\xfc\xbc\x27\xff\xb7\x95\xed\x6d\xed\x37\xb3\xe1\x92\xce\x55\xad\x33\xbb\xff\x24\xae\x60\xba\x44\xd9\x6a\x02\x3f\x41\x3b\x32\x6e\xe4\x87\x27\xde\x06\x1c\x33\xce\x1d\xf2\x8d\x30\x84\x12\x75\xe0\x57\x42\x2e\xfc\x5e\xdd\x70\xb3\xd1\x39\x23\x06\x63\xf8\xe9\xfc\xfd\xbb\xb8\x62\xda\x60\x80\xb1\xd5\xd9\xb4\xff\x13\xf8\xae\x25\xf8\x61\x5c\x69\xb4\xbb\x2a\x68\xf2\x6f\x17\xd4\x6d\x6b\x46\x2c\x6e\xdb\xe7\x7e\x37\x6e\xba\xe5\xed\xb0\x6d\x8e\x56\xe1\x8f\x12\x1f\x9e\xba\x69\xe3\xae\x25\xbe\x42\xa9\xca\x0d\xda\xb5\xc1\x5e\xa8\x25\xea\xcd\xa8\x69\x72\xde\x20\x0c\x4f\x3c\xc7\xef\x49\xf7\x15\x12\xc6\xf6\xe9\x12\xf4\xe9\x84\x0d\xa2\xfd\x12\xe8\x03\x1a\x7e\x9d\xbd\x7b\x8d\x6f\x21\x5a\x65\x8b\xd9\xbc\x88\x5b\xcc\xbd\x59\xb4\xf8\xe6\x85\xda\x0f\xe8\xb2\xda\x30\xb2\xaf\xc4\x6d\x42\x4b\xd4\xad\xb5\x7d\xa9\xf5\xcd\x4d\xda\xa1\x67\x37\x63\xef\x00\xa7\x49\xd3\xb0\xd3\xa4\xf9\x08\xfe\x2b\x00\x00\xff\xff\x1b\x17\x31\x00\x1c\x0f\x00\x00")
+var _assetsStatsHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xcd\x58\x6d\x6f\xdb\x36\x10\xfe\x6c\xfd\x8a\x8b\x3a\xc0\xf2\x6a\x49\x71\x9a\x16\x45\xea\x64\x1b\x52\x67\xcb\xd0\xa4\x45\x93\xad\x18\xda\x7e\xa0\xa5\xb3\xc5\x46\x12\x35\x92\xb2\x93\xa6\xf9\xef\x3b\x52\x92\x2d\xbb\x75\x5b\x77\x43\x31\x20\x50\x28\xde\x73\xc7\xe7\x5e\x48\x1d\x3d\xdc\x79\xfa\xfc\xf8\xf2\xaf\x17\x23\x48\x74\x96\x1e\x39\xc3\xfa\x5f\xca\xf3\x2b\x90\x98\x1e\xba\x4a\xdf\xa4\xa8\x12\x44\xed\x42\x22\x71\x72\xe8\x86\x63\x21\xb4\xd2\x92\x15\x41\xc6\xf3\x20\x52\xca\xfd\x6a\x0d\x5f\x27\x98\x61\x4b\xcf\x19\x8e\x45\x7c\x73\xe4\x00\x0c\x63\x3e\x83\x28\x65\x4a\x1d\xba\x91\xc8\x35\xe3\x39\x4a\x7f\x92\x96\x3c\x76\x8d\x7c\x15\x21\xc5\xbc\x9e\x5d\xd7\x4c\x7d\x95\xf9\x83\x3d\x30\xa3\x2c\x36\xa3\x8c\x4c\x2d\xc0\x04\x4f\x06\x0d\xba\x60\x53\xf4\x13\x64\x31\x4a\xf7\xe8\x57\x01\x27\xe5\xfb\xf7\xc3\x30\x19\xb4\xc0\xab\x6b\x42\x91\xb2\x08\x13\x91\x92\x86\x6a\xd9\xfc\x98\xc4\xb5\xf2\x1f\x40\xc3\xa6\xad\xb6\xa2\x65\xd8\xec\x03\x8f\x0f\xdd\xb9\x90\x57\xd6\x26\xad\xbf\xbf\x06\x51\x05\xcb\x1b\xdb\x1a\xaf\xb5\x9f\x95\x1a\x29\x2a\xaf\x2a\x9d\x61\x68\x00\x2b\x64\x42\x62\xf3\x5f\xb2\x8b\x84\x2c\xca\xed\xc8\x1d\x5b\x95\xef\xc1\x4d\x32\xaa\xb6\x2d\x43\x77\x5c\x2b\x7d\x07\x7e\x12\x95\x66\x52\x6f\xc7\xef\x65\xad\xf4\x6d\xfc\xf6\xb7\xe1\x87\xd7\x18\x6d\x47\x6e\x64\x34\xbe\x03\xb3\x48\xcc\x8c\x6c\xab\xa2\x23\x8d\xef\xc0\xac\x2c\x34\xcf\x70\x2b\x6a\x7f\x58\x95\x2f\x72\xab\x5f\x5b\xa7\xd5\x5e\x63\x4d\x95\xe3\xc5\x61\xf5\x1b\x57\x5a\xc8\x1b\x5a\x7f\xef\xd3\x87\x95\x66\xe3\x14\x7d\xaa\xbd\x42\xe4\x8a\xcf\x70\xf5\xb0\xb2\xd2\x15\x28\x54\x0a\x74\x4a\xf3\x02\xe3\x75\xb7\xb5\x59\x77\x75\xce\xcc\xca\xf5\x29\x0b\x5d\x9e\x4b\x34\xfe\x24\xa0\x39\x1b\x36\xca\x17\xbb\x73\x13\x62\xb9\x3f\x36\x21\xea\x22\xdd\x4c\xc1\x56\xca\x26\x71\x93\xad\x8f\xe5\x34\xb7\xe6\xb6\x41\xd9\xf0\x74\x2a\x6d\xf3\x45\xb3\x55\x92\x54\x49\x32\x65\xa2\xab\xcf\x5c\xc7\xa2\x4d\xa4\xb7\xce\xf8\x59\xa9\x99\xe6\x94\xcc\xff\x67\xce\x9f\x17\x28\x19\x79\xfb\xcd\x09\x39\xe1\x79\xfc\x25\x31\xd0\x22\x30\x38\x03\xdc\x64\x6a\x8b\xe4\x64\x4d\x3c\xbf\x2e\x3d\x1f\xbd\x2c\x86\xf5\xa0\x49\xa3\x33\x54\x11\xc5\x53\x83\x92\x11\xb5\x3e\xef\xfe\x2e\x51\xde\xd8\x8e\xe7\x9d\x5d\xaa\x92\x1e\xad\xc1\x56\x7b\xaa\x55\x24\x99\xdc\xf1\x7d\xb8\x4c\x10\x26\x22\x4d\xc5\x9c\xe7\x53\x3a\x67\x4c\x9b\x75\x04\x2c\x8f\xa1\x36\x75\x04\xe3\x54\x44\x57\x0a\x4c\x2f\x01\x4c\x8a\x92\x64\x0c\x54\x81\x11\x9f\xf0\x08\xc6\xe5\x14\xe6\x5c\x27\xf4\x88\x75\xe2\xf0\x1c\x4e\x47\x30\xd8\x05\x1a\xbc\xa2\xe8\x8a\xb9\x82\xc7\xd6\x5e\xf3\xf6\x22\x11\x39\xc2\xe3\x00\x2e\x10\x0f\x9c\x44\xeb\xe2\x20\x0c\xa7\xa8\x97\x64\x23\x91\x99\x09\x4d\x8c\x7c\xbb\x21\x31\x0e\xef\xa9\xb2\x28\x84\xd4\x3e\xc7\xc1\xae\x6f\xd7\x02\xdf\x37\x0e\x5b\xc6\xce\xcf\xfe\x1c\xc7\x57\x5c\xfb\x33\x8e\x73\x03\xa4\x60\xde\x56\x9c\x0e\x20\xc6\x19\x8f\xb0\xd2\x7a\x02\x77\x04\xce\xc4\xfb\x36\xf2\x0b\x60\xb5\x86\xfd\x1c\x58\xac\x63\x3f\x03\x5e\x47\x7e\x0e\x4c\x99\xab\x3c\x6d\xf2\xe2\x84\x21\x1c\x8b\xe2\x46\xf2\x69\xa2\x61\x6f\x77\xb0\xef\xd3\xe3\x21\x5c\x52\x36\x34\xca\x3e\x9c\xe6\x51\x60\x40\xcf\xc8\x4e\xae\x30\x06\xca\x1c\x55\xfa\xd9\xe9\x25\x78\x26\xec\xca\xc4\x9d\x32\x57\x8e\x6d\xc4\xf5\x7c\xac\x96\x15\x13\x52\xd6\xc7\x61\xc6\x14\x99\x0a\x9f\x9d\x1e\x8f\xce\x2f\x46\x3d\x87\x4f\xc0\xcb\xd9\x8c\x4f\xcd\xa6\x0c\x4a\x85\xf2\x97\x29\xe6\x3a\xc8\x98\x8e\x12\x2f\x3c\x1d\x9d\x89\x31\x4f\xf1\x4d\x38\xd8\x7d\x13\xec\x86\xbd\x1e\xdc\x3a\x9d\x19\x93\x90\xa9\x3f\x6b\x5f\x2f\x8c\x17\x70\x08\xb1\x88\xca\xcc\xe8\x46\x12\x99\xc6\x51\x8a\xe6\xcd\xeb\x5a\x2f\xbb\x3d\xa7\xb3\xa6\x12\xb0\xa2\xc0\x3c\x3e\x4e\x78\x1a\x7b\x4e\xa7\xb3\xa6\x7f\x49\x1f\xc5\x73\x11\xa3\x11\x75\xba\x2b\x39\xbb\xad\x22\xca\x4a\x2d\x76\x78\x66\x66\x58\xae\xef\xba\x04\xa4\x55\xe8\x6f\x61\xc9\x6e\xaa\x0b\x4c\x31\x22\xef\xbc\xae\xd9\xe1\xdd\xde\xca\xba\x6b\x9c\x7a\x8e\xcd\x4b\xb3\xa3\xda\x99\x39\xe1\x52\xe9\x3e\x44\x09\x9a\xbd\x43\x71\xe3\x1a\xb8\xca\xbb\xf4\xcc\x8a\xca\x57\xca\xc8\x0d\xea\xc0\x06\x75\xe7\x82\x8e\xcb\x7c\x1a\x14\x52\x68\xa1\x6f\x0a\x0c\x26\x42\x52\x54\x6d\x00\x37\xc8\x28\x88\x93\x32\x8f\xcc\x71\xe3\x59\x9c\x8d\x34\x93\x53\x45\x12\xfa\x67\x9d\x52\x4f\x68\x5e\xa2\x2e\x65\x0e\x9a\x3e\x1d\x81\x44\xdb\x88\x78\xe1\xad\xf7\x26\xbe\xdf\xbb\x0b\xa7\xfd\xa5\x19\x9b\xc7\x3e\xe4\x65\x36\x46\x59\xd9\x5c\x28\xd3\xc2\x62\x62\xcd\xbf\xae\xe4\x6f\x61\xe7\x10\xba\xa6\xa8\x26\x74\xab\x8a\x4d\x40\x3b\x3f\xad\x00\xcc\xcc\x01\x58\xa3\x66\x68\xa8\xdc\xf5\xe8\x79\xf7\x84\x02\xe7\x18\xb6\x74\xfb\x39\xc9\x8c\x27\xae\xf9\x06\x0c\x75\x7c\x74\xbb\x7b\x47\xa7\x65\x5c\x8d\x07\xad\xf1\x5e\x6b\xfc\xa0\x35\xde\x6f\x8d\x1f\xb6\xc6\x8f\xea\xb1\x39\xbc\x5d\xbb\x58\x73\x38\xbf\xfc\x77\x8b\x56\x06\xad\x45\x9c\xe9\x0b\x51\xca\xc8\x14\x74\x8e\x73\x18\xcd\x28\xe4\xd5\x8c\xe7\x86\x68\xde\x94\x7d\x73\xc9\xed\x05\x38\x60\x71\x6c\x91\xcf\xe8\x53\x8e\x74\x21\xf5\xdc\x82\x12\xec\xb6\x12\x81\x8b\x9d\x13\x33\xcd\xc8\xfa\xef\x17\xcf\xcf\x83\x82\x49\x85\x1e\x06\x66\xce\xc4\xf1\x07\xcf\xbd\xd7\xb4\x03\x3d\xaa\x0f\x34\x95\xea\x55\x31\xad\x8b\xc4\x6e\x15\x82\x07\x75\xfb\xd4\x6f\xde\xab\x6e\x69\xf9\x5a\x37\x47\x66\xc2\x1d\x84\x2e\xdc\xb7\x2b\x07\x4d\x4b\xf4\x14\x73\x91\x2d\xd0\xf6\xab\xdb\x32\x45\x5d\xcf\xe2\xad\x6a\x72\x68\x67\x11\xc3\x8a\x62\x73\x0b\xed\x05\xa6\x75\xf5\xda\x74\x7a\x15\xa2\xbe\x09\xb6\x01\x15\xbf\x46\xde\xdc\xc6\x56\x10\xf5\x64\x8d\x59\xdc\x88\x6a\xcc\x46\x2f\x6a\x7c\x75\x43\x69\x1b\xb4\x5e\x2d\x18\x99\x5b\xc2\x2a\x21\x9a\xa9\xa5\x75\xa7\xde\x16\x57\x6e\xf7\x9c\xfa\xbc\x6b\xfa\x00\x53\x65\x2e\x29\x05\xc8\xe8\x84\xb4\xc8\x45\xcf\x05\x1f\x3e\xc0\xeb\xb7\xad\xac\xf3\x3e\x64\xcb\x9d\x4c\x9d\x8f\xa9\xab\xac\xe2\x05\x3f\x81\x97\x05\x55\xc3\xf2\x23\x0c\xf0\x11\x84\x8d\x88\x68\x88\x13\x7e\x8d\xb1\x37\xe8\xc1\x01\xb8\x3e\x2d\xd8\x59\x32\xb8\x7f\xb8\x56\xf9\x4d\x69\x64\xc1\x39\xcb\xb0\xdf\x98\x31\x03\x6b\xbf\x6f\x97\x26\x57\xef\x9a\x22\x5b\xb6\x35\xbd\xc0\xfc\x98\xe3\x2d\x26\xe8\x08\x34\x79\x6e\x75\x20\x61\xd5\xf5\x50\x43\x69\x7f\xf5\xf9\x07\x44\xed\xee\x48\x0d\x12\x00\x00")
 
 func assetsStatsHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -170,8 +170,8 @@ func assetsStatsHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "assets/stats.html", size: 3868, mode: os.FileMode(0644), modTime: time.Unix(1550787301, 0)}
-	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x80, 0x86, 0xc3, 0x62, 0xb1, 0xd1, 0x40, 0x2b, 0x2c, 0x13, 0x5a, 0xa9, 0xd, 0x6a, 0xa6, 0x46, 0x67, 0x7e, 0xc7, 0x19, 0xed, 0x5b, 0xf5, 0xc8, 0xb0, 0x7c, 0x3b, 0x88, 0x9e, 0xfa, 0xaa, 0x6f}}
+	info := bindataFileInfo{name: "assets/stats.html", size: 4621, mode: os.FileMode(0644), modTime: time.Unix(1792360008, 0)}
+	a := &asset{bytes: bytes, info: info, digest: [32]uint8{0x9e, 0xfd, 0x13, 0xa9, 0xfc, 0x82, 0xe, 0x8b, 0x74, 0xf9, 0x5c, 0xd6, 0x1, 0x6, 0x3d, 0xde, 0xd, 0x59, 0x37, 0x96, 0x76, 0x53, 0xcd, 0xa4, 0x5, 0x1, 0xf3, 0x24, 0x92, 0x89, 0x68, 0xf2}}
 	return a, nil
 }
 
@@ -0,0 +1,291 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+	"log"
+	"sort"
+)
+
+/*
+Checksum bypass.
+Sonar reports comparisons with both operands non-constant. If one operand is
+a checksum (CRC32, Adler32, byte sum) of an input region and the other operand
+is stored in the input, we remember where the checksum is stored and what
+region it covers. Then checksums of newly generated inputs are recomputed
+before execution, so that the mutated data gets past the integrity check.
+*/
+
+const (
+	maxChecksumData    = 1 << 14 // don't search for checksums in larger inputs
+	maxChecksumRegion  = 1 << 10 // max size of regions with arbitrary start
+	maxChecksumTries   = 3       // max number of checksum searches per sonar site
+	maxChecksumFixups  = 16      // max number of checksums the hub remembers
+	maxChecksumMatches = 4       // max number of places to look for the stored value
+)
+
+type checksumAlg int
+
+const (
+	checksumCRC32 checksumAlg = iota
+	checksumCRC32C
+	checksumAdler32
+	checksumSum16
+	checksumSum32
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (alg checksumAlg) String() string {
+	return [...]string{"crc32", "crc32c", "adler32", "sum16", "sum32"}[alg]
+}
+
+func (alg checksumAlg) width() int {
+	if alg == checksumSum16 {
+		return 2
+	}
+	return 4
+}
+
+func (alg checksumAlg) compute(data []byte) uint32 {
+	switch alg {
+	case checksumCRC32:
+		return crc32.ChecksumIEEE(data)
+	case checksumCRC32C:
+		return crc32.Checksum(data, castagnoliTable)
+	case checksumAdler32:
+		return adler32.Checksum(data)
+	}
+	var sum uint32
+	for _, c := range data {
+		sum += uint32(c)
+	}
+	if alg == checksumSum16 {
+		sum &= 0xffff
+	}
+	return sum
+}
+
+// anchor is a position in an input, relative either to the beginning or to the end,
+// so that checksums can be fixed in inputs of different size.
+type anchor struct {
+	off     int
+	fromEnd bool
+}
+
+func makeAnchor(pos, size int) anchor {
+	if pos > size/2 {
+		return anchor{size - pos, true}
+	}
+	return anchor{pos, false}
+}
+
+func (a anchor) resolve(size int) int {
+	if a.fromEnd {
+		return size - a.off
+	}
+	return a.off
+}
+
+func (a anchor) String() string {
+	if a.fromEnd {
+		return fmt.Sprintf("end-%v", a.off)
+	}
+	return fmt.Sprint(a.off)
+}
+
+// Checksum describes a checksum stored in inputs.
+type Checksum struct {
+	alg        checksumAlg
+	big        bool   // stored in big-endian byte order
+	pos        anchor // position of the stored checksum
+	start, end anchor // checksummed region
+}
+
+func (cs Checksum) String() string {
+	order := "le"
+	if cs.big {
+		order = "be"
+	}
+	return fmt.Sprintf("%v/%v at %v over [%v:%v]", cs.alg, order, cs.pos, cs.start, cs.end)
+}
+
+// fix recomputes the checksum in data. It returns false if the checksum does not fit into data.
+func (cs Checksum) fix(data []byte) bool {
+	pos := cs.pos.resolve(len(data))
+	start := cs.start.resolve(len(data))
+	end := cs.end.resolve(len(data))
+	w := cs.alg.width()
+	if pos < 0 || pos+w > len(data) || start < 0 || start > end || end > len(data) ||
+		pos < end && pos+w > start {
+		return false
+	}
+	v := cs.alg.compute(data[start:end])
+	putChecksum(data[pos:], v, w, cs.big)
+	return true
+}
+
+func putChecksum(buf []byte, v uint32, width int, big bool) {
+	switch {
+	case width == 2 && big:
+		binary.BigEndian.PutUint16(buf, uint16(v))
+	case width == 2:
+		binary.LittleEndian.PutUint16(buf, uint16(v))
+	case big:
+		binary.BigEndian.PutUint32(buf, v)
+	default:
+		binary.LittleEndian.PutUint32(buf, v)
+	}
+}
+
+// detectChecksums finds checksums in data that can explain comparison of
+// the computed value with the stored value.
+func detectChecksums(data []byte, computed, stored uint64) []Checksum {
+	if len(data) > maxChecksumData {
+		return nil
+	}
+	var res []Checksum
+	for alg := checksumCRC32; alg <= checksumSum32; alg++ {
+		w := alg.width()
+		if computed == 0 || computed>>uint(w*8) != 0 || stored>>uint(w*8) != 0 {
+			continue
+		}
+		if alg >= checksumSum16 && computed < 0x100 {
+			// Small sums match too many regions by coincidence.
+			continue
+		}
+		for _, big := range []bool{false, true} {
+			enc := make([]byte, w)
+			putChecksum(enc, uint32(stored), w, big)
+			matches := 0
+			for pos := 0; pos+w <= len(data) && matches < maxChecksumMatches; pos++ {
+				if string(data[pos:pos+w]) != string(enc) {
+					continue
+				}
+				matches++
+				for _, r := range checksumRegions(data, alg, uint32(computed), pos) {
+					res = append(res, Checksum{
+						alg:   alg,
+						big:   big,
+						pos:   makeAnchor(pos, len(data)),
+						start: makeAnchor(r[0], len(data)),
+						end:   makeAnchor(r[1], len(data)),
+					})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// checksumRegions returns regions of data with checksum v that does not overlap
+// with the checksum itself stored at pos. Considered regions are:
+// regions that end right before the checksum (of limited size, or starting at 0),
+// and regions that start right after the checksum and end at the end of data.
+func checksumRegions(data []byte, alg checksumAlg, v uint32, pos int) [][2]int {
+	var res [][2]int
+	starts := []int{0}
+	if alg < checksumSum16 {
+		// Sums of short regions match by coincidence too often.
+		for start := pos - maxChecksumRegion; start < pos; start++ {
+			if start > 0 {
+				starts = append(starts, start)
+			}
+		}
+	}
+	for _, start := range starts {
+		if start < pos && alg.compute(data[start:pos]) == v {
+			res = append(res, [2]int{start, pos})
+		}
+	}
+	if end := pos + alg.width(); end < len(data) && alg.compute(data[end:]) == v {
+		res = append(res, [2]int{end, len(data)})
+	}
+	return res
+}
+
+// noteChecksums looks for checksums for a comparison of non-constant operands.
+// A candidate checksum is confirmed before passing it to the hub:
+// a byte of the checksummed region is changed, the checksum is fixed and
+// the modified input must make the site compare equal operands.
+// Otherwise a numeric coincidence would make us corrupt most of the following mutants.
+func (w *Worker) noteChecksums(site *SonarSite, data, v1, v2 []byte, depth int) {
+	site.Lock()
+	site.checksumTries++
+	tries := site.checksumTries
+	site.Unlock()
+	if tries > maxChecksumTries || len(v1) > 8 || len(v2) > 8 {
+		return
+	}
+	var u1, u2 uint64
+	for i := range v1 {
+		u1 |= uint64(v1[i]) << uint(i*8)
+	}
+	for i := range v2 {
+		u2 |= uint64(v2[i]) << uint(i*8)
+	}
+	ro := w.hub.ro.Load().(*ROData)
+	// We don't know which operand is computed and which one is stored, try both.
+	found := append(detectChecksums(data, u1, u2), detectChecksums(data, u2, u1)...)
+	for _, cs := range found {
+		if ro.hasChecksum(cs) {
+			continue
+		}
+		tmp, ok := cs.probe(data)
+		if !ok || !checksumConfirmed(site, w.parseSonarData(w.testInputSonar(tmp, depth))) {
+			continue
+		}
+		if *flagV >= 1 {
+			log.Printf("worker %v: detected checksum %v at sonar site %v", w.id, cs, site.loc)
+		}
+		w.hub.newChecksum(cs)
+	}
+}
+
+// probe returns a copy of data with a changed byte in the checksummed region and fixed checksum.
+func (cs Checksum) probe(data []byte) ([]byte, bool) {
+	tmp := makeCopy(data)
+	start := cs.start.resolve(len(tmp))
+	end := cs.end.resolve(len(tmp))
+	if start < 0 || start >= end || end > len(tmp) {
+		return nil, false
+	}
+	tmp[start+(end-start)/2] ^= 0xff
+	return tmp, cs.fix(tmp)
+}
+
+// checksumConfirmed returns true if the site compared equal operands in the sonar samples.
+func checksumConfirmed(site *SonarSite, samples []SonarSample) bool {
+	for _, sam := range samples {
+		if sam.site == site && bytes.Equal(sam.val[0], sam.val[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixChecksums recomputes all known checksums in a generated input in place.
+// Checksums are fixed from shorter to longer regions, so that checksums
+// that cover other checksums are computed last.
+// Some inputs are left intact to test handling of corrupted checksums.
+func (w *Worker) fixChecksums(ro *ROData, data []byte) []byte {
+	if len(ro.checksums) == 0 || w.mutator.rand(10) == 0 {
+		return data
+	}
+	checksums := append([]Checksum{}, ro.checksums...)
+	sort.SliceStable(checksums, func(i, j int) bool {
+		ci, cj := checksums[i], checksums[j]
+		return ci.end.resolve(len(data))-ci.start.resolve(len(data)) <
+			cj.end.resolve(len(data))-cj.start.resolve(len(data))
+	})
+	for _, cs := range checksums {
+		cs.fix(data)
+	}
+	return data
+}
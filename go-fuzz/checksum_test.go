@@ -0,0 +1,145 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"hash/adler32"
+	"hash/crc32"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	payload := []byte("some payload protected by a checksum")
+	tests := []struct {
+		name     string
+		build    func(payload []byte) []byte
+		computed func(data []byte) uint64
+		stored   func(data []byte) uint64
+	}{
+		{
+			"crc32 trailer",
+			func(payload []byte) []byte {
+				data := append([]byte("HDR"), payload...)
+				data = append(data, 0, 0, 0, 0)
+				binary.BigEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(data[3:len(data)-4]))
+				return data
+			},
+			func(data []byte) uint64 { return uint64(crc32.ChecksumIEEE(data[3 : len(data)-4])) },
+			func(data []byte) uint64 { return uint64(binary.BigEndian.Uint32(data[len(data)-4:])) },
+		},
+		{
+			"adler32 header",
+			func(payload []byte) []byte {
+				data := append(make([]byte, 4), payload...)
+				binary.LittleEndian.PutUint32(data, adler32.Checksum(payload))
+				return data
+			},
+			func(data []byte) uint64 { return uint64(adler32.Checksum(data[4:])) },
+			func(data []byte) uint64 { return uint64(binary.LittleEndian.Uint32(data)) },
+		},
+		{
+			"sum16",
+			func(payload []byte) []byte {
+				var sum uint16
+				for _, c := range payload {
+					sum += uint16(c)
+				}
+				data := append(append([]byte{}, payload...), 0, 0)
+				binary.BigEndian.PutUint16(data[len(data)-2:], sum)
+				return data
+			},
+			func(data []byte) uint64 {
+				var sum uint16
+				for _, c := range data[:len(data)-2] {
+					sum += uint16(c)
+				}
+				return uint64(sum)
+			},
+			func(data []byte) uint64 { return uint64(binary.BigEndian.Uint16(data[len(data)-2:])) },
+		},
+	}
+	for _, test := range tests {
+		data := test.build(payload)
+		found := detectChecksums(data, test.computed(data), test.stored(data))
+		if len(found) == 0 {
+			t.Errorf("%v: checksum not detected", test.name)
+			continue
+		}
+		// Mutate the payload and check that the checksum is fixed.
+		mutated := test.build(append(payload, "and more"...))
+		copy(mutated[len(mutated)-20:], "garbage")
+		if test.computed(mutated) == test.stored(mutated) {
+			t.Fatalf("%v: bad test: mutation does not break checksum", test.name)
+		}
+		for _, cs := range found {
+			if !cs.fix(mutated) {
+				t.Errorf("%v: failed to fix checksum %v", test.name, cs)
+			}
+		}
+		if test.computed(mutated) != test.stored(mutated) {
+			t.Errorf("%v: checksum %v is not fixed", test.name, found)
+		}
+	}
+}
+
+func TestChecksumsUnrelated(t *testing.T) {
+	data := []byte("\x00\x00\x00\x01some data\x00\x00\x00\x02")
+	if found := detectChecksums(data, 1, 2); len(found) != 0 {
+		t.Fatalf("detected bogus checksums: %v", found)
+	}
+	if found := detectChecksums(data, 0, 0); len(found) != 0 {
+		t.Fatalf("detected bogus checksums: %v", found)
+	}
+}
+
+func TestChecksumConfirmation(t *testing.T) {
+	data := append([]byte("HDR"), "some payload protected by a checksum"...)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(data[3:len(data)-4]))
+	site := &SonarSite{}
+	// run emulates the program: it compares the computed checksum with the stored one.
+	run := func(data []byte) []SonarSample {
+		v1, v2 := make([]byte, 4), make([]byte, 4)
+		binary.LittleEndian.PutUint32(v1, crc32.ChecksumIEEE(data[3:len(data)-4]))
+		binary.LittleEndian.PutUint32(v2, binary.BigEndian.Uint32(data[len(data)-4:]))
+		return []SonarSample{{site: &SonarSite{}}, {site: site, val: [2][]byte{v1, v2}}}
+	}
+	good := Checksum{checksumCRC32, true, anchor{4, true}, anchor{3, false}, anchor{4, true}}
+	// A candidate with a wrong region, as if it was detected due to a coincidence.
+	bad := good
+	bad.start = anchor{0, false}
+	for _, test := range []struct {
+		cs   Checksum
+		want bool
+	}{{good, true}, {bad, false}} {
+		tmp, ok := test.cs.probe(data)
+		if !ok {
+			t.Fatalf("%v: probe failed", test.cs)
+		}
+		if string(tmp) == string(data) {
+			t.Fatalf("%v: probe does not change data", test.cs)
+		}
+		if got := checksumConfirmed(site, run(tmp)); got != test.want {
+			t.Errorf("%v: confirmed %v, want %v", test.cs, got, test.want)
+		}
+	}
+}
+
+func TestAddChecksum(t *testing.T) {
+	hub := &Hub{}
+	hub.ro.Store(&ROData{})
+	for i := 0; i < maxChecksumFixups+2; i++ {
+		hub.addChecksum(Checksum{pos: anchor{i, false}})
+		hub.addChecksum(Checksum{pos: anchor{i, false}})
+	}
+	checksums := hub.ro.Load().(*ROData).checksums
+	if len(checksums) != maxChecksumFixups {
+		t.Fatalf("got %v checksums, want %v", len(checksums), maxChecksumFixups)
+	}
+	// The oldest checksums are dropped.
+	if checksums[0].pos.off != 2 || checksums[maxChecksumFixups-1].pos.off != maxChecksumFixups+1 {
+		t.Errorf("wrong checksums are kept: %v", checksums)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"net/rpc"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,11 +31,13 @@ type Coordinator struct {
 	corpus       *PersistentSet
 	suppressions *PersistentSet
 	crashers     *PersistentSet
+	slow         *PersistentSet // inputs that run much longer than average, meta is exec time in ns
 
 	startTime     time.Time
 	lastInput     time.Time
 	statExecs     uint64
 	statRestarts  uint64
+	statMutations MutationStats
 	coverFullness int
 
 	statsWriters *writerset.WriterSet
@@ -57,12 +60,16 @@ func coordinatorMain(ln net.Listener) {
 	m.suppressions = newPersistentSet(filepath.Join(*flagWorkdir, "suppressions"))
 	m.crashers = newPersistentSet(filepath.Join(*flagWorkdir, "crashers"))
 	m.corpus = newPersistentSet(filepath.Join(*flagWorkdir, "corpus"))
+	m.slow = newPersistentSet(filepath.Join(*flagWorkdir, "slow"))
 	if len(m.corpus.m) == 0 {
 		m.corpus.add(Artifact{[]byte{}, 0, false})
 	}
 
 	m.workers = make(map[int]*CoordinatorWorker)
 	coordinatorListen(m)
+	if *flagGen != "" {
+		go m.runGenerator()
+	}
 
 	go coordinatorLoop(m)
 
@@ -92,8 +99,10 @@ func coordinatorLoop(c *Coordinator) {
 		}
 		c.mu.Lock()
 		// Nuke dead workers.
+		// In -deterministic mode the only worker runs in this process
+		// and syncs after a fixed number of executions, which may take long.
 		for id, s := range c.workers {
-			if time.Since(s.lastSync) < syncDeadline {
+			if *flagDeterministic || time.Since(s.lastSync) < syncDeadline {
 				continue
 			}
 			log.Printf("worker %v died", s.id)
@@ -157,6 +166,10 @@ func (c *Coordinator) coordinatorStats() coordinatorStats {
 		stats.Workers += uint64(w.procs)
 	}
 
+	for i, st := range c.statMutations {
+		stats.Mutations = append(stats.Mutations, mutationOpStats{mutationOpNames[i], st.Execs, st.Finds})
+	}
+
 	return stats
 }
 
@@ -164,6 +177,13 @@ type coordinatorStats struct {
 	Workers, Corpus, Crashers, Execs, Cover, RestartsDenom uint64
 	LastNewInputTime, StartTime                            time.Time
 	Uptime                                                 string
+	Mutations                                              []mutationOpStats
+}
+
+// mutationOpStats is statistics of a mutation operator shown on the stats page.
+type mutationOpStats struct {
+	Name         string
+	Execs, Finds uint64
 }
 
 func (s coordinatorStats) String() string {
@@ -224,6 +244,10 @@ func (c *Coordinator) Connect(a *ConnectArgs, r *ConnectRes) error {
 	for _, a := range c.corpus.m {
 		r.Corpus = append(r.Corpus, CoordinatorInput{a.data, a.meta, execCorpus, !a.user, true})
 	}
+	// Map iteration order is random, but triage order must be reproducible for -deterministic.
+	sort.Slice(r.Corpus, func(i, j int) bool {
+		return bytes.Compare(r.Corpus[i].Data, r.Corpus[j].Data) < 0
+	})
 	return nil
 }
 
@@ -261,6 +285,9 @@ type NewCrasherArgs struct {
 	Error       []byte
 	Suppression []byte
 	Hanging     bool
+	Type        string // crash, hang, oom, race or leak
+	PkgName     string // name of the package with fuzz function
+	Func        string // fuzz function name
 }
 
 // NewCrasher saves new crasher input on coordinator.
@@ -276,21 +303,51 @@ func (c *Coordinator) NewCrasher(a *NewCrasherArgs, r *int) error {
 	}
 
 	// Prepare quoted version of input to simplify creation of standalone reproducers.
+	c.crashers.addDescription(a.Data, quoteData(a.Data, "\t"), "quoted")
+	c.crashers.addDescription(a.Data, a.Error, "output")
+	c.crashers.addDescription(a.Data, []byte(a.Type+"\n"), "type")
+	if *flagGenTest != "" {
+		writeCrasherTest(a)
+	}
+
+	return nil
+}
+
+// quoteData formats data as a Go string literal split into lines of 20 bytes.
+func quoteData(data []byte, indent string) []byte {
 	var buf bytes.Buffer
-	for i := 0; i < len(a.Data); i += 20 {
+	for i := 0; i < len(data); i += 20 {
 		e := i + 20
-		if e > len(a.Data) {
-			e = len(a.Data)
+		if e > len(data) {
+			e = len(data)
 		}
-		fmt.Fprintf(&buf, "\t%q", a.Data[i:e])
-		if e != len(a.Data) {
+		fmt.Fprintf(&buf, "%v%q", indent, data[i:e])
+		if e != len(data) {
 			fmt.Fprintf(&buf, " +")
 		}
 		fmt.Fprintf(&buf, "\n")
 	}
-	c.crashers.addDescription(a.Data, buf.Bytes(), "quoted")
-	c.crashers.addDescription(a.Data, a.Error, "output")
+	return buf.Bytes()
+}
+
+type NewSlowInputArgs struct {
+	Data        []byte
+	ExecTime    uint64
+	AvgExecTime uint64 // average exec time of corpus inputs
+	Cover       Sig    // signature of covered edges, see coverSig
+}
 
+// NewSlowInput saves new slow input on coordinator.
+func (c *Coordinator) NewSlowInput(a *NewSlowInputArgs, r *int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.slow.m) >= maxSlowInputs || !c.slow.add(Artifact{a.Data, a.ExecTime, false}) {
+		return nil // Already have this.
+	}
+	desc := fmt.Sprintf("exec time %v, corpus average %v\n", time.Duration(a.ExecTime), time.Duration(a.AvgExecTime))
+	c.slow.addDescription(a.Data, []byte(desc), "time")
+	log.Printf("new slow input: exec time %v, corpus average %v", time.Duration(a.ExecTime), time.Duration(a.AvgExecTime))
 	return nil
 }
 
@@ -299,6 +356,7 @@ type SyncArgs struct {
 	Execs         uint64
 	Restarts      uint64
 	CoverFullness int
+	Mutations     MutationStats // per-operator statistics since the last sync
 }
 
 type SyncRes struct {
@@ -319,6 +377,7 @@ func (c *Coordinator) Sync(a *SyncArgs, r *SyncRes) error {
 	}
 	c.statExecs += a.Execs
 	c.statRestarts += a.Restarts
+	c.statMutations.add(&a.Mutations)
 	if c.coverFullness < a.CoverFullness {
 		c.coverFullness = a.CoverFullness
 	}
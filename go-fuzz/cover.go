@@ -6,6 +6,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"math/bits"
 	"os"
 
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
@@ -79,6 +80,90 @@ func roundUpCover(x byte) byte {
 	return 255
 }
 
+// Resources contains per-edge maxima of resource usage: exec time and allocated bytes.
+// Values are quantized to log2 buckets, see timeBucket and allocBucket.
+// Inputs that set a new maximum for any covered edge are considered interesting,
+// this steers fuzzing towards algorithmic complexity and memory blowup bugs.
+type Resources struct {
+	time  []byte
+	alloc []byte
+}
+
+func newResources() *Resources {
+	return &Resources{
+		time:  make([]byte, CoverSize),
+		alloc: make([]byte, CoverSize),
+	}
+}
+
+func (r *Resources) copy() *Resources {
+	return &Resources{
+		time:  makeCopy(r.time),
+		alloc: makeCopy(r.alloc),
+	}
+}
+
+// timeBucket quantizes exec time, times below 1us are ignored as noise.
+func timeBucket(ns uint64) byte {
+	return byte(bits.Len64(ns >> 10))
+}
+
+func allocBucket(alloc uint64) byte {
+	return byte(bits.Len64(alloc))
+}
+
+// improves says whether an input with the given cover and resource usage
+// sets a new maximum for any edge.
+func (r *Resources) improves(cover []byte, ns, alloc uint64) bool {
+	tb, ab := timeBucket(ns), allocBucket(alloc)
+	if tb == 0 && ab == 0 {
+		return false
+	}
+	for i, c := range cover {
+		if c != 0 && (r.time[i] < tb || r.alloc[i] < ab) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Resources) update(cover []byte, ns, alloc uint64) {
+	tb, ab := timeBucket(ns), allocBucket(alloc)
+	for i, c := range cover {
+		if c == 0 {
+			continue
+		}
+		if r.time[i] < tb {
+			r.time[i] = tb
+		}
+		if r.alloc[i] < ab {
+			r.alloc[i] = ab
+		}
+	}
+}
+
+// holdsMax says whether the input holds the maximum for any edge.
+func (r *Resources) holdsMax(cover []byte, ns, alloc uint64) bool {
+	tb, ab := timeBucket(ns), allocBucket(alloc)
+	for i, c := range cover {
+		if c != 0 && (tb != 0 && r.time[i] == tb || ab != 0 && r.alloc[i] == ab) {
+			return true
+		}
+	}
+	return false
+}
+
+// coverSig returns signature of the set of covered edges, hit counts are ignored.
+func coverSig(cover []byte) Sig {
+	edges := make([]byte, (len(cover)+7)/8)
+	for i, c := range cover {
+		if c != 0 {
+			edges[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return hash(edges)
+}
+
 func findNewCover(base, cover []byte) (res []byte, notEmpty bool) {
 	res = make([]byte, CoverSize)
 	for i, b := range base {
@@ -4,9 +4,9 @@ package main
 
 import "strconv"
 
-const _execType_name = "BootstrapCorpusMinimizeInputMinimizeCrasherTriageInputFuzzVersifierSmashSonarSonarHintTotalCount"
+const _execType_name = "BootstrapCorpusMinimizeInputMinimizeCrasherTriageInputFuzzVersifierSmashGrammarSonarSonarHintTotalCount"
 
-var _execType_index = [...]uint8{0, 9, 15, 28, 43, 54, 58, 67, 72, 77, 86, 91, 96}
+var _execType_index = [...]uint8{0, 9, 15, 28, 43, 54, 58, 67, 72, 79, 84, 93, 98, 103}
 
 func (i execType) String() string {
 	if i >= execType(len(_execType_index)-1) {
@@ -0,0 +1,75 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	. "github.com/dvyukov/go-fuzz/internal/go-fuzz-types"
+)
+
+// runGenerator runs -gen generator and adds inputs that it streams to corpus.
+// The generator is built with go-fuzz/gen package, -stream flag makes it
+// write gob-encoded GenRecord's to stdout.
+func (c *Coordinator) runGenerator() {
+	args := strings.Fields(*flagGen)
+	cmd := exec.Command(args[0], append(args[1:], "-stream")...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Fatalf("failed to create generator pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("failed to start generator: %v", err)
+	}
+	total, added := c.readGenerated(stdout)
+	if err := cmd.Wait(); err != nil {
+		log.Printf("generator failed: %v", err)
+	}
+	log.Printf("generator produced %v inputs, %v new", total, added)
+}
+
+// readGenerated adds gob-encoded GenRecord's from r to corpus
+// and returns the total number of records and the number of new inputs.
+func (c *Coordinator) readGenerated(r io.Reader) (total, added int) {
+	dec := gob.NewDecoder(r)
+	for {
+		var rec GenRecord
+		if err := dec.Decode(&rec); err != nil {
+			if err != io.EOF {
+				log.Printf("failed to decode generator output: %v", err)
+			}
+			return
+		}
+		total++
+		if c.addGenerated(rec) {
+			added++
+		}
+	}
+}
+
+// addGenerated adds generated input to corpus as if it was put into corpus dir by user.
+// Workers that are already connected receive it for triage, the rest receive it
+// with the rest of the corpus when they connect.
+func (c *Coordinator) addGenerated(rec GenRecord) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prio := parseHint(rec.Hint)
+	if !c.corpus.add(Artifact{rec.Data, prio, true}) {
+		return false
+	}
+	c.lastInput = time.Now()
+	// Queue the input for sending to every worker.
+	for _, w := range c.workers {
+		w.pending = append(w.pending, CoordinatorInput{rec.Data, prio, execCorpus, false, true})
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/internal/go-fuzz-types"
+)
+
+func TestReadGenerated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-fuzz-gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &Coordinator{
+		corpus:  newPersistentSet(dir),
+		workers: map[int]*CoordinatorWorker{1: {id: 1}, 2: {id: 2}, 3: {id: 3}},
+	}
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	recs := []GenRecord{
+		{Data: []byte("foo"), Hint: []byte("10")},
+		{Data: []byte("bar")},
+		{Data: []byte("foo"), Hint: []byte("20")},
+		{Data: []byte("baz"), Hint: []byte(" 5\n")},
+	}
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total, added := c.readGenerated(&buf)
+	if total != 4 || added != 3 {
+		t.Fatalf("got %v/%v inputs, want 4/3", total, added)
+	}
+	want := map[string]uint64{"foo": 10, "bar": 0, "baz": 5}
+	for data, prio := range want {
+		a, ok := c.corpus.m[hash([]byte(data))]
+		if !ok || a.meta != prio || !a.user {
+			t.Errorf("input %q: not in corpus or bad artifact %+v", data, a)
+		}
+	}
+	// Every worker must receive every new input.
+	for id, w := range c.workers {
+		if len(w.pending) != len(want) {
+			t.Fatalf("worker %v got %v inputs, want %v", id, len(w.pending), len(want))
+		}
+		for _, inp := range w.pending {
+			if prio, ok := want[string(inp.Data)]; !ok || inp.Prio != prio || inp.Minimized {
+				t.Errorf("worker %v: bad input %+v", id, inp)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+// writeCrasherTest writes a Go test that reproduces the crasher into -gentest dir.
+func writeCrasherTest(a *NewCrasherArgs) {
+	if a.PkgName == "" || a.Func == "" {
+		log.Printf("can't generate test for crasher: unknown fuzz function (test binary is built with old go-fuzz-build)")
+		return
+	}
+	if err := os.MkdirAll(*flagGenTest, 0770); err != nil {
+		log.Printf("failed to create test dir: %v", err)
+		return
+	}
+	name, src := formatCrasherTest(a)
+	fname := filepath.Join(*flagGenTest, fmt.Sprintf("fuzz_crasher_%v_test.go", name))
+	if err := ioutil.WriteFile(fname, src, 0660); err != nil {
+		log.Printf("failed to write file: %v", err)
+	}
+}
+
+// formatCrasherTest returns name and source of a Go test that calls the fuzz function
+// with the crasher input and fails if the function misbehaves the same way:
+// panics, hangs, leaks goroutines or grows heap more than -memlimit.
+// Tests for data races have race build tag and rely on the race detector.
+// The test is placed into the package with the fuzz function and requires gofuzz build tag,
+// since fuzz functions are usually excluded from normal builds with it.
+func formatCrasherTest(a *NewCrasherArgs) (string, []byte) {
+	sig := hash(a.Data)
+	name := hex.EncodeToString(sig[:8])
+	typ := a.Type
+	if a.Hanging {
+		typ = "hang"
+	}
+	imports := []string{"testing"}
+	tags := []string{"gofuzz"}
+	var body bytes.Buffer
+	switch {
+	case typ == "hang":
+		imports = append(imports, "time")
+		fmt.Fprintf(&body, "\tdone := make(chan bool)\n")
+		fmt.Fprintf(&body, "\tgo func() {\n")
+		fmt.Fprintf(&body, "\t\tdefer close(done)\n")
+		fmt.Fprintf(&body, "\t\t%v(data)\n", a.Func)
+		fmt.Fprintf(&body, "\t}()\n")
+		fmt.Fprintf(&body, "\tselect {\n")
+		fmt.Fprintf(&body, "\tcase <-done:\n")
+		fmt.Fprintf(&body, "\tcase <-time.After(%v * time.Millisecond):\n", flagTimeout.Milliseconds())
+		fmt.Fprintf(&body, "\t\tt.Fatalf(\"%v hanged\")\n", a.Func)
+		fmt.Fprintf(&body, "\t}\n")
+	case typ == "race":
+		tags = append(tags, "race")
+		fmt.Fprintf(&body, "\t// The data race is detected by the race detector (go test -race).\n")
+		fmt.Fprintf(&body, "\t%v(data)\n", a.Func)
+	case typ == "leak":
+		imports = append(imports, "runtime", "time")
+		fmt.Fprintf(&body, "\tbefore := runtime.NumGoroutine()\n")
+		fmt.Fprintf(&body, "\t%v(data)\n", a.Func)
+		fmt.Fprintf(&body, "\t// Give the goroutines a chance to finish.\n")
+		fmt.Fprintf(&body, "\tfor start := time.Now(); runtime.NumGoroutine() > before; time.Sleep(time.Millisecond) {\n")
+		fmt.Fprintf(&body, "\t\tif time.Since(start) > %v*time.Millisecond {\n", LeakGracePeriodMs)
+		fmt.Fprintf(&body, "\t\t\tbuf := make([]byte, 1<<20)\n")
+		fmt.Fprintf(&body, "\t\t\tt.Fatalf(\"%v leaked goroutines:\\n%%s\", buf[:runtime.Stack(buf, true)])\n", a.Func)
+		fmt.Fprintf(&body, "\t\t}\n")
+		fmt.Fprintf(&body, "\t}\n")
+	case typ == "oom" && *flagMemLimit != 0:
+		imports = append(imports, "runtime", "runtime/metrics", "time")
+		fmt.Fprintf(&body, "\t// Heap growth is checked periodically and after the call, garbage is not accounted.\n")
+		fmt.Fprintf(&body, "\tconst limit = %v << 20 // -memlimit\n", *flagMemLimit)
+		fmt.Fprintf(&body, "\theapSize := func() uint64 {\n")
+		fmt.Fprintf(&body, "\t\tsample := []metrics.Sample{{Name: \"/memory/classes/heap/objects:bytes\"}}\n")
+		fmt.Fprintf(&body, "\t\tmetrics.Read(sample)\n")
+		fmt.Fprintf(&body, "\t\treturn sample[0].Value.Uint64()\n")
+		fmt.Fprintf(&body, "\t}\n")
+		fmt.Fprintf(&body, "\truntime.GC()\n")
+		fmt.Fprintf(&body, "\tbase := heapSize()\n")
+		fmt.Fprintf(&body, "\tdone := make(chan bool)\n")
+		fmt.Fprintf(&body, "\tpeak := make(chan uint64)\n")
+		fmt.Fprintf(&body, "\tgo func() {\n")
+		fmt.Fprintf(&body, "\t\ttop := base\n")
+		fmt.Fprintf(&body, "\t\tfor stop := false; !stop; {\n")
+		fmt.Fprintf(&body, "\t\t\tselect {\n")
+		fmt.Fprintf(&body, "\t\t\tcase <-done:\n")
+		fmt.Fprintf(&body, "\t\t\t\tstop = true\n")
+		fmt.Fprintf(&body, "\t\t\tcase <-time.After(%v * time.Millisecond):\n", MemCheckPeriodMs)
+		fmt.Fprintf(&body, "\t\t\t}\n")
+		fmt.Fprintf(&body, "\t\t\tif heapSize() > base+limit {\n")
+		fmt.Fprintf(&body, "\t\t\t\truntime.GC()\n")
+		fmt.Fprintf(&body, "\t\t\t\tif v := heapSize(); v > top {\n")
+		fmt.Fprintf(&body, "\t\t\t\t\ttop = v\n")
+		fmt.Fprintf(&body, "\t\t\t\t}\n")
+		fmt.Fprintf(&body, "\t\t\t}\n")
+		fmt.Fprintf(&body, "\t\t}\n")
+		fmt.Fprintf(&body, "\t\tpeak <- top\n")
+		fmt.Fprintf(&body, "\t}()\n")
+		fmt.Fprintf(&body, "\t%v(data)\n", a.Func)
+		fmt.Fprintf(&body, "\tclose(done)\n")
+		fmt.Fprintf(&body, "\tif top := <-peak; top > base+limit {\n")
+		fmt.Fprintf(&body, "\t\tt.Fatalf(\"%v grew heap by %%v MB, limit: %%v MB\", (top-base)>>20, limit>>20)\n", a.Func)
+		fmt.Fprintf(&body, "\t}\n")
+	case typ == "oom":
+		fmt.Fprintf(&body, "\t// Runtime out of memory error crashes the test.\n")
+		fmt.Fprintf(&body, "\t%v(data)\n", a.Func)
+	default:
+		fmt.Fprintf(&body, "\tdefer func() {\n")
+		fmt.Fprintf(&body, "\t\tif err := recover(); err != nil {\n")
+		fmt.Fprintf(&body, "\t\t\tt.Fatalf(\"%v panicked: %%v\", err)\n", a.Func)
+		fmt.Fprintf(&body, "\t\t}\n")
+		fmt.Fprintf(&body, "\t}()\n")
+		fmt.Fprintf(&body, "\t%v(data)\n", a.Func)
+	}
+	sort.Strings(imports)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by go-fuzz -gentest. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "//go:build %v\n// +build %v\n\n", strings.Join(tags, " && "), strings.Join(tags, ","))
+	fmt.Fprintf(&buf, "package %v\n\n", a.PkgName)
+	if len(imports) == 1 {
+		fmt.Fprintf(&buf, "import %q\n\n", imports[0])
+	} else {
+		fmt.Fprintf(&buf, "import (\n")
+		for _, imp := range imports {
+			fmt.Fprintf(&buf, "\t%q\n", imp)
+		}
+		fmt.Fprintf(&buf, ")\n\n")
+	}
+	fmt.Fprintf(&buf, "// TestFuzzCrasher_%v reproduces go-fuzz crasher %v (%v).\n",
+		name, hex.EncodeToString(sig[:]), a.Type)
+	fmt.Fprintf(&buf, "func TestFuzzCrasher_%v(t *testing.T) {\n", name)
+	if len(a.Data) == 0 {
+		fmt.Fprintf(&buf, "\tdata := []byte{}\n")
+	} else {
+		fmt.Fprintf(&buf, "\tdata := []byte(\"\" +\n%s)\n", bytes.TrimSuffix(quoteData(a.Data, "\t\t"), []byte("\n")))
+	}
+	buf.Write(body.Bytes())
+	fmt.Fprintf(&buf, "}\n")
+	return name, buf.Bytes()
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestFormatCrasherTest(t *testing.T) {
+	defer func(v int) { *flagMemLimit = v }(*flagMemLimit)
+	tests := []struct {
+		a        NewCrasherArgs
+		memLimit int
+		want     []string // generated test must contain these lines
+	}{
+		{
+			a:    NewCrasherArgs{Data: []byte("0123456789abcdefghij\x00\xff\"klmnop"), PkgName: "png", Func: "Fuzz", Type: "crash"},
+			want: []string{"//go:build gofuzz\n", "\t\tif err := recover(); err != nil {\n"},
+		},
+		{
+			a:    NewCrasherArgs{Data: []byte("loop"), PkgName: "png", Func: "Fuzz", Type: "hang", Hanging: true},
+			want: []string{"\t\tt.Fatalf(\"Fuzz hanged\")\n"},
+		},
+		{
+			a:    NewCrasherArgs{Data: []byte("race"), PkgName: "png", Func: "Fuzz", Type: "race"},
+			want: []string{"//go:build gofuzz && race\n", "// +build gofuzz,race\n"},
+		},
+		{
+			a:    NewCrasherArgs{Data: []byte("leak"), PkgName: "png", Func: "FuzzDecode", Type: "leak"},
+			want: []string{"\tbefore := runtime.NumGoroutine()\n", "\t\t\tt.Fatalf(\"FuzzDecode leaked goroutines:\\n%s\", buf[:runtime.Stack(buf, true)])\n"},
+		},
+		{
+			a:        NewCrasherArgs{Data: []byte{}, PkgName: "png", Func: "FuzzDecode", Type: "oom"},
+			memLimit: 1024,
+			want:     []string{"\tconst limit = 1024 << 20 // -memlimit\n", "\tif top := <-peak; top > base+limit {\n"},
+		},
+		{
+			a:    NewCrasherArgs{Data: []byte{}, PkgName: "png", Func: "FuzzDecode", Type: "oom"},
+			want: []string{"\t// Runtime out of memory error crashes the test.\n"},
+		},
+	}
+	for _, test := range tests {
+		*flagMemLimit = test.memLimit
+		name, src := formatCrasherTest(&test.a)
+		formatted, err := format.Source(src)
+		if err != nil {
+			t.Fatalf("generated test does not parse: %v\n%s", err, src)
+		}
+		if string(formatted) != string(src) {
+			t.Errorf("generated test is not gofmt-ed:\n%s", src)
+		}
+		want := append(test.want, "func TestFuzzCrasher_"+name+"(t *testing.T) {\n", "\t"+test.a.Func+"(data)\n")
+		for _, line := range want {
+			if !strings.Contains(string(src), line) {
+				t.Errorf("generated test does not contain %q:\n%s", line, src)
+			}
+		}
+		// The test must build together with the fuzz function.
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "test.go", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fuzz, err := parser.ParseFile(fset, "fuzz.go", "package png\nfunc "+test.a.Func+"(data []byte) int { return 0 }\n", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := &types.Config{Importer: importer.Default()}
+		if _, err := conf.Check("png", fset, []*ast.File{f, fuzz}, nil); err != nil {
+			t.Errorf("generated test does not build: %v\n%s", err, src)
+		}
+	}
+}
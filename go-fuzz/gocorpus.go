@@ -0,0 +1,420 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Support for Go native fuzzing corpus format (testdata/fuzz/FuzzX dirs).
+// A corpus file looks as follows:
+//
+//	go test fuzz v1
+//	[]byte("foo")
+//	int(42)
+//
+// go-fuzz inputs are single byte slices, so multiple arguments
+// are laid out in the input one after another (see -nativeargs):
+// bool and numeric values use fixed-size little-endian encoding,
+// []byte and string values are prefixed with uint32 little-endian length,
+// except for the last argument that takes the rest of the input.
+
+const goCorpusHeader = "go test fuzz v1"
+
+// goValue is a single value of a Go native corpus file.
+type goValue struct {
+	typ  string // canonical type name: []byte, string, bool, int8, uint32, float64, etc
+	data []byte // contents of []byte and string values
+	bits uint64 // bits of bool and numeric values
+}
+
+// goTypeSize returns size of fixed-size type typ, or 0 for []byte and string.
+func goTypeSize(typ string) int {
+	switch typ {
+	case "[]byte", "string":
+		return 0
+	case "bool", "int8", "uint8":
+		return 1
+	case "int16", "uint16":
+		return 2
+	case "int32", "uint32", "float32":
+		return 4
+	case "int", "uint", "int64", "uint64", "float64":
+		return 8
+	}
+	return -1
+}
+
+// canonicalGoType maps type aliases to the underlying types.
+func canonicalGoType(typ string) string {
+	switch typ {
+	case "byte":
+		return "uint8"
+	case "rune":
+		return "int32"
+	}
+	return typ
+}
+
+// parseGoTypes parses comma-separated list of fuzz function argument types.
+func parseGoTypes(list string) ([]string, error) {
+	var types []string
+	for _, typ := range strings.Split(list, ",") {
+		typ = canonicalGoType(strings.TrimSpace(typ))
+		if goTypeSize(typ) < 0 {
+			return nil, fmt.Errorf("unsupported argument type %q", typ)
+		}
+		types = append(types, typ)
+	}
+	return types, nil
+}
+
+// parseGoCorpus parses a Go native corpus file.
+func parseGoCorpus(data []byte) ([]goValue, error) {
+	lines := strings.Split(string(data), "\n")
+	if strings.TrimSpace(lines[0]) != goCorpusHeader {
+		return nil, fmt.Errorf("missing %q header", goCorpusHeader)
+	}
+	var vals []goValue
+	for i, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		v, err := parseGoValue(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+2, err)
+		}
+		vals = append(vals, v)
+	}
+	if len(vals) == 0 {
+		return nil, fmt.Errorf("no values")
+	}
+	return vals, nil
+}
+
+func parseGoValue(line string) (goValue, error) {
+	expr, err := parser.ParseExpr(line)
+	if err != nil {
+		return goValue{}, err
+	}
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return goValue{}, fmt.Errorf("expected type conversion call")
+	}
+	arg := call.Args[0]
+	if arr, ok := call.Fun.(*ast.ArrayType); ok {
+		if elt, ok := arr.Elt.(*ast.Ident); !ok || arr.Len != nil || elt.Name != "byte" {
+			return goValue{}, fmt.Errorf("unsupported type")
+		}
+		s, err := parseGoString(arg)
+		return goValue{typ: "[]byte", data: []byte(s)}, err
+	}
+	id, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return goValue{}, fmt.Errorf("unsupported type")
+	}
+	v := goValue{typ: canonicalGoType(id.Name)}
+	switch v.typ {
+	case "string":
+		s, err := parseGoString(arg)
+		v.data = []byte(s)
+		return v, err
+	case "bool":
+		b, ok := arg.(*ast.Ident)
+		if !ok || b.Name != "true" && b.Name != "false" {
+			return goValue{}, fmt.Errorf("bad bool value")
+		}
+		if b.Name == "true" {
+			v.bits = 1
+		}
+		return v, nil
+	case "float32", "float64":
+		v.bits, err = parseGoFloat(arg, v.typ)
+		return v, err
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		v.bits, err = parseGoInt(arg, v.typ)
+		return v, err
+	}
+	return goValue{}, fmt.Errorf("unsupported type %q", id.Name)
+}
+
+func parseGoString(arg ast.Expr) (string, error) {
+	lit, ok := arg.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", fmt.Errorf("expected string literal")
+	}
+	return strconv.Unquote(lit.Value)
+}
+
+// parseGoNumber returns text of a possibly negated numeric literal.
+func parseGoNumber(arg ast.Expr) (*ast.BasicLit, string, error) {
+	neg := ""
+	if u, ok := arg.(*ast.UnaryExpr); ok && u.Op == token.SUB {
+		neg = "-"
+		arg = u.X
+	}
+	lit, ok := arg.(*ast.BasicLit)
+	if !ok {
+		return nil, "", fmt.Errorf("expected numeric literal")
+	}
+	return lit, neg + lit.Value, nil
+}
+
+func parseGoInt(arg ast.Expr, typ string) (uint64, error) {
+	lit, val, err := parseGoNumber(arg)
+	if err != nil {
+		return 0, err
+	}
+	size := uint(goTypeSize(typ)) * 8
+	switch lit.Kind {
+	case token.CHAR:
+		if val[0] == '-' {
+			return 0, fmt.Errorf("bad character literal")
+		}
+		r, _, tail, err := strconv.UnquoteChar(val[1:len(val)-1], '\'')
+		if err != nil || tail != "" {
+			return 0, fmt.Errorf("bad character literal %v", val)
+		}
+		if size < 64 && uint64(r) >= 1<<size {
+			return 0, fmt.Errorf("character %v overflows %v", val, typ)
+		}
+		return uint64(r), nil
+	case token.INT:
+		if typ[0] == 'u' {
+			return strconv.ParseUint(val, 0, int(size))
+		}
+		v, err := strconv.ParseInt(val, 0, int(size))
+		return uint64(v), err
+	}
+	return 0, fmt.Errorf("expected integer literal")
+}
+
+func parseGoFloat(arg ast.Expr, typ string) (uint64, error) {
+	if call, ok := arg.(*ast.CallExpr); ok {
+		// Special values are encoded as math.Float64frombits(0x7ff8000000000001).
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || len(call.Args) != 1 || sel.Sel.Name != "Float32frombits" && sel.Sel.Name != "Float64frombits" {
+			return 0, fmt.Errorf("expected float literal")
+		}
+		if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "math" {
+			return 0, fmt.Errorf("expected float literal")
+		}
+		bitsTyp := "uint64"
+		if typ == "float32" {
+			bitsTyp = "uint32"
+		}
+		return parseGoInt(call.Args[0], bitsTyp)
+	}
+	lit, val, err := parseGoNumber(arg)
+	if err != nil {
+		return 0, err
+	}
+	if lit.Kind != token.FLOAT && lit.Kind != token.INT {
+		return 0, fmt.Errorf("expected float literal")
+	}
+	if typ == "float32" {
+		f, err := strconv.ParseFloat(val, 32)
+		return uint64(math.Float32bits(float32(f))), err
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	return math.Float64bits(f), err
+}
+
+// marshalGoCorpus formats values as a Go native corpus file.
+func marshalGoCorpus(vals []goValue) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%v\n", goCorpusHeader)
+	for _, v := range vals {
+		size := uint(goTypeSize(v.typ)) * 8
+		switch v.typ {
+		case "[]byte":
+			fmt.Fprintf(&buf, "[]byte(%q)\n", v.data)
+		case "string":
+			fmt.Fprintf(&buf, "string(%q)\n", v.data)
+		case "bool":
+			fmt.Fprintf(&buf, "bool(%v)\n", v.bits != 0)
+		case "uint8":
+			fmt.Fprintf(&buf, "byte(%q)\n", rune(v.bits))
+		case "int32":
+			if r := rune(v.bits); utf8.ValidRune(r) {
+				fmt.Fprintf(&buf, "rune(%q)\n", r)
+			} else {
+				fmt.Fprintf(&buf, "int32(%v)\n", r)
+			}
+		case "int", "int8", "int16", "int64":
+			// Sign-extend the value.
+			fmt.Fprintf(&buf, "%v(%v)\n", v.typ, int64(v.bits<<(64-size))>>(64-size))
+		case "uint", "uint16", "uint32", "uint64":
+			fmt.Fprintf(&buf, "%v(%v)\n", v.typ, v.bits)
+		case "float32":
+			f := math.Float32frombits(uint32(v.bits))
+			if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+				fmt.Fprintf(&buf, "float32(math.Float32frombits(0x%x))\n", v.bits)
+			} else {
+				fmt.Fprintf(&buf, "float32(%v)\n", strconv.FormatFloat(float64(f), 'g', -1, 32))
+			}
+		case "float64":
+			f := math.Float64frombits(v.bits)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				fmt.Fprintf(&buf, "float64(math.Float64frombits(0x%x))\n", v.bits)
+			} else {
+				fmt.Fprintf(&buf, "float64(%v)\n", strconv.FormatFloat(f, 'g', -1, 64))
+			}
+		default:
+			panic(fmt.Sprintf("unsupported type %q", v.typ))
+		}
+	}
+	return buf.Bytes()
+}
+
+// goValuesToInput lays out values of the given types into a go-fuzz input.
+func goValuesToInput(vals []goValue, types []string) ([]byte, error) {
+	if len(vals) != len(types) {
+		return nil, fmt.Errorf("have %v values, want %v", len(vals), len(types))
+	}
+	var data []byte
+	for i, v := range vals {
+		typ := types[i]
+		if v.typ != typ && !(goTypeSize(v.typ) == 0 && goTypeSize(typ) == 0) {
+			// []byte and string are interchangeable, since go-fuzz inputs are untyped.
+			return nil, fmt.Errorf("value %v has type %v, want %v", i, v.typ, typ)
+		}
+		if size := goTypeSize(typ); size != 0 {
+			var tmp [8]byte
+			binary.LittleEndian.PutUint64(tmp[:], v.bits)
+			data = append(data, tmp[:size]...)
+			continue
+		}
+		if i != len(vals)-1 {
+			var tmp [4]byte
+			binary.LittleEndian.PutUint32(tmp[:], uint32(len(v.data)))
+			data = append(data, tmp[:]...)
+		}
+		data = append(data, v.data...)
+	}
+	return data, nil
+}
+
+// inputToGoValues splits a go-fuzz input into values of the given types.
+func inputToGoValues(data []byte, types []string) ([]goValue, error) {
+	var vals []goValue
+	for i, typ := range types {
+		v := goValue{typ: typ}
+		size := goTypeSize(typ)
+		if size == 0 && i != len(types)-1 {
+			if len(data) < 4 {
+				return nil, fmt.Errorf("input is too short")
+			}
+			size = int(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		} else if size == 0 {
+			size = len(data)
+		}
+		if len(data) < size {
+			return nil, fmt.Errorf("input is too short")
+		}
+		if goTypeSize(typ) == 0 {
+			v.data = makeCopy(data[:size])
+		} else {
+			var tmp [8]byte
+			copy(tmp[:], data[:size])
+			v.bits = binary.LittleEndian.Uint64(tmp[:])
+			if typ == "bool" {
+				v.bits &= 1
+			}
+		}
+		data = data[size:]
+		vals = append(vals, v)
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("input has %v trailing bytes", len(data))
+	}
+	return vals, nil
+}
+
+// goCorpusMain imports Go native corpus into workdir (-import)
+// and/or exports workdir crashers and corpus in the Go native format (-export).
+func goCorpusMain() {
+	types, err := parseGoTypes(*flagNativeArgs)
+	if err != nil {
+		log.Fatalf("bad -nativeargs: %v", err)
+	}
+	if *flagImport != "" {
+		corpus := newPersistentSet(filepath.Join(*flagWorkdir, "corpus"))
+		files, err := ioutil.ReadDir(*flagImport)
+		if err != nil {
+			log.Fatalf("failed to read import dir: %v", err)
+		}
+		added := 0
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			fname := filepath.Join(*flagImport, f.Name())
+			contents, err := ioutil.ReadFile(fname)
+			if err != nil {
+				log.Fatalf("failed to read file: %v", err)
+			}
+			vals, err := parseGoCorpus(contents)
+			if err != nil {
+				log.Printf("skipping %v: %v", fname, err)
+				continue
+			}
+			data, err := goValuesToInput(vals, types)
+			if err != nil {
+				log.Printf("skipping %v: %v", fname, err)
+				continue
+			}
+			if corpus.add(Artifact{data, 0, false}) {
+				added++
+			}
+		}
+		log.Printf("imported %v new inputs from %v", added, *flagImport)
+	}
+	if *flagExport != "" {
+		if err := os.MkdirAll(*flagExport, 0770); err != nil {
+			log.Fatalf("failed to create export dir: %v", err)
+		}
+		sets := []string{"crashers"}
+		if *flagExportCorpus {
+			sets = append(sets, "corpus")
+		}
+		for _, set := range sets {
+			ps := newPersistentSet(filepath.Join(*flagWorkdir, set))
+			exported := 0
+			for sig, a := range ps.m {
+				vals, err := inputToGoValues(a.data, types)
+				if err != nil {
+					log.Printf("skipping %v/%v: %v", set, hex.EncodeToString(sig[:]), err)
+					continue
+				}
+				contents := marshalGoCorpus(vals)
+				// Go names corpus files by a prefix of SHA-256 of the contents.
+				sum := sha256.Sum256(contents)
+				fname := filepath.Join(*flagExport, hex.EncodeToString(sum[:])[:16])
+				if err := ioutil.WriteFile(fname, contents, 0660); err != nil {
+					log.Fatalf("failed to write file: %v", err)
+				}
+				exported++
+			}
+			log.Printf("exported %v %v to %v", exported, set, *flagExport)
+		}
+	}
+}
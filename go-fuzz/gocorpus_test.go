@@ -0,0 +1,81 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGoCorpusRoundTrip(t *testing.T) {
+	tests := []struct {
+		types string
+		file  string
+		data  []byte
+	}{
+		{
+			"[]byte",
+			"go test fuzz v1\n[]byte(\"foo\\x00\")\n",
+			[]byte("foo\x00"),
+		},
+		{
+			"string,int,bool,[]byte",
+			"go test fuzz v1\nstring(\"ab\")\nint(-2)\nbool(true)\n[]byte(\"c\")\n",
+			[]byte("\x02\x00\x00\x00ab\xfe\xff\xff\xff\xff\xff\xff\xff\x01c"),
+		},
+		{
+			"byte,rune,uint16,float64",
+			"go test fuzz v1\nbyte('x')\nrune('Ж')\nuint16(513)\nfloat64(1.5)\n",
+			[]byte("x\x16\x04\x00\x00\x01\x02\x00\x00\x00\x00\x00\x00\xf8\x3f"),
+		},
+		{
+			"float32",
+			"go test fuzz v1\nfloat32(math.Float32frombits(0x7fc00001))\n",
+			[]byte("\x01\x00\xc0\x7f"),
+		},
+	}
+	for _, test := range tests {
+		types, err := parseGoTypes(test.types)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals, err := parseGoCorpus([]byte(test.file))
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", test.file, err)
+		}
+		data, err := goValuesToInput(vals, types)
+		if err != nil {
+			t.Fatalf("failed to convert %q: %v", test.file, err)
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Fatalf("bad input for %q: %q, want %q", test.file, data, test.data)
+		}
+		vals, err = inputToGoValues(data, types)
+		if err != nil {
+			t.Fatalf("failed to convert %q back: %v", data, err)
+		}
+		if file := marshalGoCorpus(vals); string(file) != test.file {
+			t.Fatalf("bad corpus file:\n%s\nwant:\n%s", file, test.file)
+		}
+	}
+}
+
+func TestGoCorpusErrors(t *testing.T) {
+	for _, file := range []string{
+		"[]byte(\"foo\")\n",
+		"go test fuzz v1\n",
+		"go test fuzz v1\nint8(200)\n",
+		"go test fuzz v1\nuint(-1)\n",
+		"go test fuzz v1\nmap[int]int(nil)\n",
+		"go test fuzz v1\nbool(1)\n",
+	} {
+		if _, err := parseGoCorpus([]byte(file)); err == nil {
+			t.Errorf("parsed bad corpus file %q", file)
+		}
+	}
+	types, _ := parseGoTypes("int,[]byte")
+	if _, err := inputToGoValues([]byte("short"), types); err == nil {
+		t.Errorf("converted too short input")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package grammar
+
+import (
+	"unicode/utf8"
+)
+
+// Generate generates a random derivation tree for the start symbol.
+func (g *Grammar) Generate(r Rand) *Node {
+	budget := maxNodes
+	return g.generate(r, g.start, 0, &budget)
+}
+
+// generate generates a random tree for rule rl rooted at the given depth.
+// Once either the depth or the node budget is exhausted,
+// only alternatives leading to the smallest trees are chosen.
+func (g *Grammar) generate(r Rand, rl *rule, depth int, budget *int) *Node {
+	*budget--
+	var alt int
+	if depth+rl.minDepth >= maxDepth || *budget <= 0 {
+		var best []int
+		for i, a := range rl.alts {
+			if altDepth(a) == rl.minDepth {
+				best = append(best, i)
+			}
+		}
+		alt = best[r.Intn(len(best))]
+	} else {
+		// Don't choose alternatives that won't fit into the depth limit.
+		for {
+			alt = r.Intn(len(rl.alts))
+			if depth+altDepth(rl.alts[alt]) <= maxDepth {
+				break
+			}
+		}
+	}
+	n := &Node{Rule: rl.name, Alt: alt, Children: make([]*Node, len(rl.alts[alt]))}
+	for i, sym := range rl.alts[alt] {
+		switch {
+		case sym.rule != nil:
+			n.Children[i] = g.generate(r, sym.rule, depth+1, budget)
+		case sym.isRange():
+			c := sym.lo + rune(r.Intn(int(sym.hi-sym.lo)+1))
+			buf := make([]byte, utf8.RuneLen(c))
+			utf8.EncodeRune(buf, c)
+			n.Children[i] = &Node{Text: buf}
+		default:
+			n.Children[i] = &Node{Text: sym.lit}
+		}
+	}
+	return n
+}
+
+// Mutate returns a mutated version of tree t, t itself is not modified.
+// Each mutation replaces a random nonterminal subtree of t with either a newly
+// generated subtree, or with a subtree for the same nonterminal from one of others.
+func (g *Grammar) Mutate(r Rand, t *Node, others []*Node) *Node {
+	for iter := 0; iter == 0 || r.Intn(2) == 0; iter++ {
+		var nodes []*Node
+		var depths []int
+		walk(t, 0, func(n *Node, depth int) {
+			nodes = append(nodes, n)
+			depths = append(depths, depth)
+		})
+		idx := r.Intn(len(nodes))
+		old := nodes[idx]
+		rl := g.rules[old.Rule]
+		if rl == nil {
+			// The tree does not belong to this grammar.
+			return t
+		}
+		var repl *Node
+		if r.Intn(2) == 0 {
+			var cands []*Node
+			for _, o := range others {
+				walk(o, 0, func(n *Node, depth int) {
+					if n.Rule == old.Rule && n != old {
+						cands = append(cands, n)
+					}
+				})
+			}
+			if len(cands) != 0 {
+				repl = cands[r.Intn(len(cands))]
+			}
+		}
+		if repl == nil {
+			budget := maxNodes / 10
+			repl = g.generate(r, rl, depths[idx], &budget)
+		}
+		t = replace(t, &idx, repl)
+	}
+	return t
+}
+
+// walk calls fn for all nonterminal nodes of the tree in pre-order.
+func walk(n *Node, depth int, fn func(n *Node, depth int)) {
+	if n.Rule == "" {
+		return
+	}
+	fn(n, depth)
+	for _, c := range n.Children {
+		walk(c, depth+1, fn)
+	}
+}
+
+// replace returns a copy of the tree with *idx-th nonterminal node (in walk order) replaced with repl.
+// Only nodes on the path to the replaced node are copied, the rest is shared.
+func replace(n *Node, idx *int, repl *Node) *Node {
+	if n.Rule == "" {
+		return n
+	}
+	if *idx == 0 {
+		*idx = -1
+		return repl
+	}
+	*idx--
+	for i, c := range n.Children {
+		c1 := replace(c, idx, repl)
+		if c1 != c {
+			n1 := *n
+			n1.Children = append([]*Node(nil), n.Children...)
+			n1.Children[i] = c1
+			return &n1
+		}
+		if *idx < 0 {
+			break
+		}
+	}
+	return n
+}
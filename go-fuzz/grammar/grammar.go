@@ -0,0 +1,330 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package grammar generates and mutates inputs according to a context-free grammar.
+//
+// Grammars are written in the EBNF dialect used by the Go spec:
+//
+//	Production  = name "=" [ Expression ] "." .
+//	Expression  = Alternative { "|" Alternative } .
+//	Alternative = Term { Term } .
+//	Term        = name | token [ "…" token ] | Group | Option | Repetition .
+//	Group       = "(" Expression ")" .
+//	Option      = "[" Expression "]" .
+//	Repetition  = "{" Expression "}" .
+//
+// Tokens are Go string literals ("..." or `...`), "a" … "z" denotes a single
+// character from the range ("..." can be used instead of "…").
+// Comments are Go comments. The first production is the start symbol.
+//
+// Inputs are represented as derivation trees (see Node). Mutations operate on
+// trees: a random subtree is either regenerated from scratch or replaced with
+// a subtree derived from the same nonterminal in another tree.
+// Raw inputs can be converted back to trees with Grammar.Parse.
+package grammar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode/utf8"
+)
+
+const (
+	maxDepth = 20   // max depth of generated trees
+	maxNodes = 1000 // max number of nonterminal nodes in a generated tree
+	infDepth = 1 << 30
+)
+
+// Rand is the source of randomness for generation and mutation.
+type Rand interface {
+	Intn(n int) int
+}
+
+type Grammar struct {
+	start *rule
+	rules map[string]*rule
+}
+
+type rule struct {
+	name     string
+	alts     [][]symbol
+	minDepth int // depth of the smallest tree derived from this rule
+}
+
+// symbol is either a nonterminal (rule != nil), a literal or a character range.
+type symbol struct {
+	rule   *rule
+	lit    []byte
+	lo, hi rune
+}
+
+func (s symbol) isRange() bool {
+	return s.rule == nil && s.lit == nil
+}
+
+// Node is a node of a derivation tree.
+// Nodes are never modified after creation, so trees can share subtrees.
+type Node struct {
+	Rule     string  // nonterminal name, empty for terminals
+	Alt      int     // index of the alternative used for the nonterminal
+	Children []*Node // one child per symbol of the alternative
+	Text     []byte  // terminal text
+}
+
+// Bytes returns the input represented by the tree.
+func (n *Node) Bytes() []byte {
+	return n.appendBytes(nil)
+}
+
+func (n *Node) appendBytes(buf []byte) []byte {
+	if n.Rule == "" {
+		return append(buf, n.Text...)
+	}
+	for _, c := range n.Children {
+		buf = c.appendBytes(buf)
+	}
+	return buf
+}
+
+// Parse parses grammar source.
+func Parse(filename string, src []byte) (*Grammar, error) {
+	p := &grammarParser{
+		g:    &Grammar{rules: make(map[string]*rule)},
+		refs: make(map[string]scanner.Position),
+	}
+	p.s.Init(strings.NewReader(string(src)))
+	p.s.Filename = filename
+	p.s.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanRawStrings | scanner.ScanComments | scanner.SkipComments
+	p.s.Error = func(s *scanner.Scanner, msg string) {
+		p.errorf("%v", msg)
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	g := p.g
+	for name, pos := range p.refs {
+		if !p.defined[name] {
+			return nil, fmt.Errorf("%v: undefined: %v", pos, name)
+		}
+	}
+	if g.start == nil {
+		return nil, fmt.Errorf("%v: no productions", filename)
+	}
+	g.computeMinDepth()
+	for _, r := range g.rules {
+		if r.minDepth == infDepth {
+			return nil, fmt.Errorf("%v: production %v does not derive any finite string", filename, r.name)
+		}
+	}
+	return g, nil
+}
+
+type grammarParser struct {
+	g       *Grammar
+	s       scanner.Scanner
+	tok     rune
+	refs    map[string]scanner.Position
+	defined map[string]bool
+	cur     string // name of the current production
+	anon    int    // counter for names of synthesized productions
+}
+
+type parseError struct{ error }
+
+func (p *grammarParser) errorf(msg string, args ...interface{}) {
+	panic(parseError{fmt.Errorf("%v: %v", p.s.Position, fmt.Sprintf(msg, args...))})
+}
+
+func (p *grammarParser) next() {
+	p.tok = p.s.Scan()
+}
+
+func (p *grammarParser) expect(tok rune) {
+	if p.tok != tok {
+		p.errorf("expected %q, found %q", tok, p.s.TokenText())
+	}
+	p.next()
+}
+
+func (p *grammarParser) parse() (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			perr, ok := e.(parseError)
+			if !ok {
+				panic(e)
+			}
+			err = perr.error
+		}
+	}()
+	p.defined = make(map[string]bool)
+	p.next()
+	for p.tok != scanner.EOF {
+		if p.tok != scanner.Ident {
+			p.errorf("expected production name, found %q", p.s.TokenText())
+		}
+		name := p.s.TokenText()
+		if p.defined[name] {
+			p.errorf("%v redefined", name)
+		}
+		p.defined[name] = true
+		p.cur, p.anon = name, 0
+		r := p.lookup(name)
+		if p.g.start == nil {
+			p.g.start = r
+		}
+		p.next()
+		p.expect('=')
+		if p.tok != '.' {
+			r.alts = p.expression()
+		} else {
+			r.alts = [][]symbol{nil}
+		}
+		p.expect('.')
+	}
+	return nil
+}
+
+func (p *grammarParser) lookup(name string) *rule {
+	r := p.g.rules[name]
+	if r == nil {
+		r = &rule{name: name}
+		p.g.rules[name] = r
+	}
+	return r
+}
+
+func (p *grammarParser) expression() [][]symbol {
+	alts := [][]symbol{p.alternative()}
+	for p.tok == '|' {
+		p.next()
+		alts = append(alts, p.alternative())
+	}
+	return alts
+}
+
+func (p *grammarParser) alternative() []symbol {
+	var syms []symbol
+	for {
+		switch p.tok {
+		case scanner.Ident, scanner.String, scanner.RawString, '(', '[', '{':
+			syms = append(syms, p.term())
+		default:
+			return syms
+		}
+	}
+}
+
+func (p *grammarParser) term() symbol {
+	switch p.tok {
+	case scanner.Ident:
+		name := p.s.TokenText()
+		if _, ok := p.refs[name]; !ok {
+			p.refs[name] = p.s.Position
+		}
+		p.next()
+		return symbol{rule: p.lookup(name)}
+	case scanner.String, scanner.RawString:
+		lit := p.literal()
+		if p.tok != '…' && p.tok != '.' || p.tok == '.' && p.s.Peek() != '.' {
+			if len(lit) == 0 {
+				// Empty literal is a valid way to denote an empty alternative.
+				return symbol{rule: p.synthesize([][]symbol{nil})}
+			}
+			return symbol{lit: []byte(lit)}
+		}
+		if p.tok == '.' {
+			// ASCII version of the ellipsis.
+			p.next()
+			p.expect('.')
+			p.expect('.')
+		} else {
+			p.next()
+		}
+		lo, n1 := utf8.DecodeRuneInString(lit)
+		hi := p.literal()
+		hi1, n2 := utf8.DecodeRuneInString(hi)
+		if n1 != len(lit) || n2 != len(hi) || lo > hi1 {
+			p.errorf("bad character range %q … %q", lit, hi)
+		}
+		return symbol{lo: lo, hi: hi1}
+	case '(':
+		p.next()
+		alts := p.expression()
+		p.expect(')')
+		return symbol{rule: p.synthesize(alts)}
+	case '[':
+		p.next()
+		alts := p.expression()
+		p.expect(']')
+		return symbol{rule: p.synthesize(append(alts, nil))}
+	case '{':
+		p.next()
+		alts := p.expression()
+		p.expect('}')
+		// {x} is desugared into rule R = x R | "" .
+		r := p.synthesize(nil)
+		for _, alt := range alts {
+			r.alts = append(r.alts, append(alt, symbol{rule: r}))
+		}
+		r.alts = append(r.alts, nil)
+		return symbol{rule: r}
+	}
+	p.errorf("unexpected %q", p.s.TokenText())
+	return symbol{}
+}
+
+func (p *grammarParser) literal() string {
+	if p.tok != scanner.String && p.tok != scanner.RawString {
+		p.errorf("expected string literal, found %q", p.s.TokenText())
+	}
+	lit, err := strconv.Unquote(p.s.TokenText())
+	if err != nil {
+		p.errorf("bad string literal %v: %v", p.s.TokenText(), err)
+	}
+	p.next()
+	return lit
+}
+
+// synthesize creates an anonymous production for groups, options and repetitions.
+func (p *grammarParser) synthesize(alts [][]symbol) *rule {
+	p.anon++
+	name := fmt.Sprintf("%v#%v", p.cur, p.anon)
+	r := &rule{name: name, alts: alts}
+	p.g.rules[name] = r
+	return r
+}
+
+// computeMinDepth calculates minimal derivation tree depth for all rules
+// (infDepth for rules that can't derive any finite string).
+func (g *Grammar) computeMinDepth() {
+	for _, r := range g.rules {
+		r.minDepth = infDepth
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, r := range g.rules {
+			for _, alt := range r.alts {
+				if d := altDepth(alt); d < r.minDepth {
+					r.minDepth = d
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// altDepth returns minimal depth of a tree rooted at a node for the alternative alt.
+func altDepth(alt []symbol) int {
+	d := 0
+	for _, sym := range alt {
+		if sym.rule != nil && sym.rule.minDepth > d {
+			d = sym.rule.minDepth
+		}
+	}
+	if d == infDepth {
+		return infDepth
+	}
+	return d + 1
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package grammar
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const exprGrammar = `
+// Arithmetic expressions.
+Expr   = Term { ("+" | "-") Term } .
+Term   = Factor { ("*" | "/") Factor } .
+Factor = Number | "(" Expr ")" | "-" Factor .
+Number = Digit { Digit } [ "." Digit ] .
+Digit  = "0" … "9" .
+`
+
+func TestGenerateParse(t *testing.T) {
+	g, err := Parse("expr", []byte(exprGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(0))
+	var trees []*Node
+	for i := 0; i < 300; i++ {
+		tree := g.Generate(r)
+		data := tree.Bytes()
+		if len(data) == 0 {
+			t.Fatalf("generated empty input")
+		}
+		if tree2 := g.Parse(data); tree2 == nil || string(tree2.Bytes()) != string(data) {
+			t.Fatalf("failed to parse generated input %q", data)
+		}
+		trees = append(trees, tree)
+	}
+	for i := 0; i < 300; i++ {
+		tree := trees[r.Intn(len(trees))]
+		orig := string(tree.Bytes())
+		mut := g.Mutate(r, tree, trees[:10])
+		if string(tree.Bytes()) != orig {
+			t.Fatalf("mutation modified the original tree")
+		}
+		if data := mut.Bytes(); g.Parse(data) == nil {
+			t.Fatalf("failed to parse mutated input %q", data)
+		}
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	g, err := Parse("expr", []byte(exprGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		data string
+		ok   bool
+	}{
+		{"1", true},
+		{"1+2*(3.5-4)/-5", true},
+		{"((((1))))", true},
+		{"", false},
+		{"1+", false},
+		{"1.", false},
+		{"(1", false},
+	} {
+		tree := g.Parse([]byte(test.data))
+		if (tree != nil) != test.ok {
+			t.Errorf("%q: parsed %v, want %v", test.data, tree != nil, test.ok)
+			continue
+		}
+		if tree != nil && string(tree.Bytes()) != test.data {
+			t.Errorf("%q: tree represents %q", test.data, tree.Bytes())
+		}
+	}
+}
+
+func TestLeftRecursion(t *testing.T) {
+	g, err := Parse("list", []byte(`
+		List = List "," Item | Item .
+		Item = "a" ... "z" .
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"a", "a,b", "a,b,c,d"} {
+		tree := g.Parse([]byte(data))
+		if tree == nil {
+			t.Fatalf("failed to parse %q", data)
+		}
+		if string(tree.Bytes()) != data {
+			t.Fatalf("%q: tree represents %q", data, tree.Bytes())
+		}
+	}
+	if g.Parse([]byte("a,")) != nil {
+		t.Fatalf("parsed bad input")
+	}
+}
+
+func TestGrammarErrors(t *testing.T) {
+	for _, test := range []struct {
+		src string
+		err string
+	}{
+		{``, "no productions"},
+		{`A = B .`, "undefined: B"},
+		{`A = "a" . A = "b" .`, "A redefined"},
+		{`A = "a" A .`, "does not derive any finite string"},
+		{`A = "ab" … "z" .`, "bad character range"},
+		{`A = "a" | .`, ""},
+		{`A = ("a" .`, "expected ')'"},
+		{`A = "a"`, "expected '.'"},
+	} {
+		_, err := Parse("test", []byte(test.src))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", test.src, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: got error %v, want %q", test.src, err, test.err)
+		}
+	}
+}
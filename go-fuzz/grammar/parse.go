@@ -0,0 +1,156 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package grammar
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// maxParseSteps limits amount of work spent on parsing of a single input.
+const maxParseSteps = 1 << 20
+
+// Parse reconstructs a derivation tree for data.
+// It returns nil if data does not match the grammar,
+// or the parser gives up because the input is too ambiguous.
+//
+// The parser is a memoizing top-down parser that tracks all possible
+// parse lengths for each (rule, position) pair, so it handles ambiguity and
+// backtracking. Directly left-recursive rules are supported by growing the
+// parse from the non-recursive alternatives.
+func (g *Grammar) Parse(data []byte) (tree *Node) {
+	p := &inputParser{
+		data: data,
+		memo: make(map[parseKey]*parseEntry),
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			if e != errParseBudget {
+				panic(e)
+			}
+			tree = nil
+		}
+	}()
+	for _, m := range p.rule(g.start, 0) {
+		if m.end == len(data) {
+			return m.node
+		}
+	}
+	return nil
+}
+
+type parseKey struct {
+	rule *rule
+	pos  int
+}
+
+type parseEntry struct {
+	matches   []match
+	active    bool // the entry is being computed
+	recursive bool // the entry was requested while being computed
+}
+
+// match is a possible parse of a symbol: a tree that spans data[pos:end].
+type match struct {
+	end  int
+	node *Node
+}
+
+type inputParser struct {
+	data  []byte
+	memo  map[parseKey]*parseEntry
+	steps int
+}
+
+type parseBudgetError struct{}
+
+var errParseBudget = new(parseBudgetError)
+
+func (p *inputParser) rule(r *rule, pos int) []match {
+	key := parseKey{r, pos}
+	if e := p.memo[key]; e != nil {
+		if e.active {
+			e.recursive = true
+		}
+		return e.matches
+	}
+	e := &parseEntry{active: true}
+	p.memo[key] = e
+	for {
+		matches := p.alternatives(r, pos)
+		if !e.recursive || len(matches) <= len(e.matches) {
+			if len(matches) > len(e.matches) {
+				e.matches = matches
+			}
+			break
+		}
+		// Left recursion: recompute with the longer seed until it stops growing.
+		e.matches = matches
+		e.recursive = false
+	}
+	e.active = false
+	return e.matches
+}
+
+// alternatives returns all matches of rule r at pos, at most one per end position.
+func (p *inputParser) alternatives(r *rule, pos int) []match {
+	var res []match
+	seen := make(map[int]bool)
+	for ai, alt := range r.alts {
+		// Partial parses of the alternative, at most one per current position.
+		type partial struct {
+			pos      int
+			children []*Node
+		}
+		states := []partial{{pos, nil}}
+		for _, sym := range alt {
+			var next []partial
+			nextSeen := make(map[int]bool)
+			for _, st := range states {
+				for _, m := range p.symbol(sym, st.pos) {
+					if nextSeen[m.end] {
+						continue
+					}
+					nextSeen[m.end] = true
+					children := append(st.children[:len(st.children):len(st.children)], m.node)
+					next = append(next, partial{m.end, children})
+				}
+			}
+			states = next
+			if len(states) == 0 {
+				break
+			}
+		}
+		for _, st := range states {
+			if seen[st.pos] {
+				continue
+			}
+			seen[st.pos] = true
+			res = append(res, match{st.pos, &Node{Rule: r.name, Alt: ai, Children: st.children}})
+		}
+	}
+	return res
+}
+
+func (p *inputParser) symbol(sym symbol, pos int) []match {
+	p.steps++
+	if p.steps > maxParseSteps {
+		panic(errParseBudget)
+	}
+	switch {
+	case sym.rule != nil:
+		return p.rule(sym.rule, pos)
+	case sym.isRange():
+		c, size := utf8.DecodeRune(p.data[pos:])
+		if size == 0 || c == utf8.RuneError && size == 1 || c < sym.lo || c > sym.hi {
+			return nil
+		}
+		return []match{{pos + size, &Node{Text: p.data[pos : pos+size]}}}
+	default:
+		if !bytes.HasPrefix(p.data[pos:], sym.lit) {
+			return nil
+		}
+		return []match{{pos + len(sym.lit), &Node{Text: sym.lit}}}
+	}
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/rpc"
 	"path/filepath"
@@ -12,6 +13,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/dvyukov/go-fuzz/go-fuzz/grammar"
+	"github.com/dvyukov/go-fuzz/go-fuzz/protomut"
 	"github.com/dvyukov/go-fuzz/go-fuzz/versifier"
 
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
@@ -22,10 +25,22 @@ const (
 	syncPeriod             = 3 * time.Second
 	syncDeadline           = 100 * syncPeriod
 	connectionPollInterval = 100 * time.Millisecond
+	// deterministicSyncPeriod is the number of executions between syncs with the coordinator
+	// in -deterministic mode (syncs are periodic otherwise).
+	deterministicSyncPeriod = 1000
+	// deterministicScorePeriod is the number of executions between corpus score updates
+	// in -deterministic mode (periodic syncs update scores otherwise).
+	deterministicScorePeriod = 10000
 
 	minScore = 1.0
 	maxScore = 1000.0
 	defScore = 10.0
+
+	// minSlowExecTime is the minimal exec time for an input to be reported as slow,
+	// it protects from noise when all inputs are very fast.
+	minSlowExecTime = 10 * time.Millisecond
+	// maxSlowInputs is the max number of stored slow inputs.
+	maxSlowInputs = 100
 )
 
 // Hub contains data shared between all workers in the process (e.g. corpus).
@@ -41,19 +56,33 @@ type Hub struct {
 	maxCover   atomic.Value // []byte
 
 	initialTriage uint32
+	pkgName       string                // name of the package with fuzz function
+	fnname        string                // fuzz function name
+	slowInputs    map[Sig]struct{}      // cover signatures of slow inputs already reported to the coordinator
+	grammar       *grammar.Grammar      // parsed -grammar file, nil if not specified
+	protoType     *protomut.MessageType // -prototype message type, nil if not specified
+	jsonDict      []string              // string literals for JSON mutations
+	schedule      *Schedule             // -schedule power schedule
 
 	corpusCoverSize int
 	corpusSigs      map[Sig]struct{}
 	corpusStale     bool
 	triageQueue     []CoordinatorInput
-
-	triageC     chan CoordinatorInput
-	newInputC   chan Input
-	newCrasherC chan NewCrasherArgs
-	syncC       chan Stats
+	scoreRefreshes  uint64           // number of refreshScores calls
+	fuzzed          []uint64         // number of times corpus inputs were fuzzed, by corpus index
+	edgeHits        []uint64         // sampled per-edge hits, only if the schedule uses them
+	species         []map[int]uint32 // sampled rare edge hits of mutants, by corpus index
+
+	triageC      chan CoordinatorInput
+	newInputC    chan Input
+	newCrasherC  chan NewCrasherArgs
+	newSlowC     chan NewSlowInputArgs
+	newChecksumC chan Checksum
+	syncC        chan Stats
 
 	stats         Stats
 	corpusOrigins [execCount]uint64
+	mutations     MutationStats // totals for -v output
 }
 
 type ROData struct {
@@ -66,21 +95,58 @@ type ROData struct {
 	coverBlocks  map[int][]CoverBlock
 	sonarSites   []SonarSite
 	verse        *versifier.Verse
+	avgExecTime  uint64     // average exec time of corpus inputs
+	slowExecTime uint64     // inputs with larger exec time are reported as slow, 0 if disabled
+	resources    *Resources // per-edge resource usage maxima of corpus, nil unless -resourcefeedback
+	checksums    []Checksum // checksums detected in inputs, fixed in generated inputs
+	edgeHits     []uint64   // sampled per-edge hits as of the last score update, nil unless the schedule uses them
 }
 
 type Stats struct {
-	execs    uint64
-	restarts uint64
+	execs     uint64
+	restarts  uint64
+	mutations MutationStats
+	fuzzed    []uint64               // number of times corpus inputs were fuzzed, by corpus index
+	edgeHits  []uint32               // sampled per-edge hits, only if the schedule uses them
+	species   map[int]map[int]uint32 // sampled rare edge hits of mutants, by corpus index of the mutated input
 }
 
-func newHub(metadata MetaData) *Hub {
+func newHub(metadata MetaData, fnname string) *Hub {
 	procs := *flagProcs
 	hub := &Hub{
-		corpusSigs:  make(map[Sig]struct{}),
-		triageC:     make(chan CoordinatorInput, procs),
-		newInputC:   make(chan Input, procs),
-		newCrasherC: make(chan NewCrasherArgs, procs),
-		syncC:       make(chan Stats, procs),
+		pkgName:      metadata.PkgName,
+		fnname:       fnname,
+		corpusSigs:   make(map[Sig]struct{}),
+		slowInputs:   make(map[Sig]struct{}),
+		triageC:      make(chan CoordinatorInput, procs),
+		newInputC:    make(chan Input, procs),
+		newCrasherC:  make(chan NewCrasherArgs, procs),
+		newSlowC:     make(chan NewSlowInputArgs, procs),
+		newChecksumC: make(chan Checksum, procs),
+		syncC:        make(chan Stats, procs),
+		schedule:     findSchedule(*flagSchedule),
+	}
+	if hub.schedule.edges {
+		hub.edgeHits = make([]uint64, CoverSize)
+	}
+
+	if *flagGrammar != "" {
+		src, err := ioutil.ReadFile(*flagGrammar)
+		if err != nil {
+			log.Fatalf("failed to read grammar file: %v", err)
+		}
+		if hub.grammar, err = grammar.Parse(*flagGrammar, src); err != nil {
+			log.Fatalf("failed to parse grammar file: %v", err)
+		}
+	}
+	if *flagProtoDesc != "" {
+		desc, err := ioutil.ReadFile(*flagProtoDesc)
+		if err != nil {
+			log.Fatalf("failed to read protobuf descriptor set: %v", err)
+		}
+		if hub.protoType, err = protomut.LoadType(desc, *flagProtoType); err != nil {
+			log.Fatalf("failed to load protobuf message type: %v", err)
+		}
 	}
 
 	if err := hub.connect(); err != nil {
@@ -98,6 +164,7 @@ func newHub(metadata MetaData) *Hub {
 		}
 		sonarSites[i].id = b.ID
 		sonarSites[i].loc = fmt.Sprintf("%v:%v.%v,%v.%v", b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol)
+		sonarSites[i].mapKey = b.NumStmt&SonarMapKey != 0
 	}
 	hub.maxCover.Store(make([]byte, CoverSize))
 
@@ -108,17 +175,23 @@ func newHub(metadata MetaData) *Hub {
 		coverBlocks:  coverBlocks,
 		sonarSites:   sonarSites,
 	}
+	if *flagResourceFeedback {
+		ro.resources = newResources()
+	}
 	// Prepare list of string and integer literals.
 	for _, lit := range metadata.Literals {
 		if lit.IsStr {
 			ro.strLits = append(ro.strLits, []byte(lit.Val))
+			hub.jsonDict = append(hub.jsonDict, lit.Val)
 		} else {
 			ro.intLits = append(ro.intLits, []byte(lit.Val))
 		}
 	}
 	hub.ro.Store(ro)
 
-	go hub.loop()
+	if !*flagDeterministic {
+		go hub.loop()
+	}
 
 	return hub
 }
@@ -157,144 +230,320 @@ func (hub *Hub) loop() {
 
 	syncTicker := time.NewTicker(syncPeriod).C
 	for {
-		if len(hub.triageQueue) > 0 && triageC == nil {
-			n := len(hub.triageQueue) - 1
-			triageInput = hub.triageQueue[n]
-			hub.triageQueue[n] = CoordinatorInput{}
-			hub.triageQueue = hub.triageQueue[:n]
-			triageC = hub.triageC
+		if triageC == nil {
+			if input, ok := hub.popTriage(); ok {
+				triageInput = input
+				triageC = hub.triageC
+			}
 		}
 
 		select {
 		case <-syncTicker:
-			// Sync with the coordinator.
-			if *flagV >= 1 {
-				ro := hub.ro.Load().(*ROData)
-				log.Printf("hub: corpus=%v bootstrap=%v fuzz=%v minimize=%v versifier=%v smash=%v sonar=%v",
-					len(ro.corpus), hub.corpusOrigins[execBootstrap]+hub.corpusOrigins[execCorpus],
-					hub.corpusOrigins[execFuzz]+hub.corpusOrigins[execSonar],
-					hub.corpusOrigins[execMinimizeInput]+hub.corpusOrigins[execMinimizeCrasher],
-					hub.corpusOrigins[execVersifier], hub.corpusOrigins[execSmash],
-					hub.corpusOrigins[execSonarHint])
-			}
-			args := &SyncArgs{
-				ID:            hub.id,
-				Execs:         hub.stats.execs,
-				Restarts:      hub.stats.restarts,
-				CoverFullness: hub.corpusCoverSize,
-			}
-			hub.stats.execs = 0
-			hub.stats.restarts = 0
-			var res SyncRes
-			if err := hub.coordinator.Call("Coordinator.Sync", args, &res); err != nil {
-				log.Printf("sync call failed: %v, reconnection to coordinator", err)
-				if err := hub.connect(); err != nil {
-					log.Printf("failed to connect to coordinator: %v, killing worker", err)
-					return
-				}
-			}
-			if len(res.Inputs) > 0 {
-				hub.triageQueue = append(hub.triageQueue, res.Inputs...)
-			}
-			if hub.corpusStale {
-				hub.updateScores()
-				hub.corpusStale = false
+			if !hub.sync() {
+				return
 			}
 
 		case triageC <- triageInput:
-			// Send new input to workers for triage.
-			if len(hub.triageQueue) > 0 {
-				n := len(hub.triageQueue) - 1
-				triageInput = hub.triageQueue[n]
-				hub.triageQueue[n] = CoordinatorInput{}
-				hub.triageQueue = hub.triageQueue[:n]
-			} else {
-				triageC = nil
-				triageInput = CoordinatorInput{}
-			}
+			// Sent new input to workers for triage.
+			triageC = nil
+			triageInput = CoordinatorInput{}
 
 		case s := <-hub.syncC:
-			// Sync from a worker.
-			hub.stats.execs += s.execs
-			hub.stats.restarts += s.restarts
+			hub.addStats(s)
 
 		case input := <-hub.newInputC:
-			// New interesting input from workers.
-			ro := hub.ro.Load().(*ROData)
-			if !compareCover(ro.corpusCover, input.cover) {
-				break
-			}
-			sig := hash(input.data)
-			if _, ok := hub.corpusSigs[sig]; ok {
-				break
+			if !hub.addInput(input) {
+				return
 			}
 
-			// Passed deduplication, taking it.
-			if *flagV >= 2 {
-				log.Printf("hub received new input [%v]%v mine=%v", len(input.data), hash(input.data), input.mine)
-			}
-			hub.corpusSigs[sig] = struct{}{}
-			ro1 := new(ROData)
-			*ro1 = *ro
-			// Assign it the default score, but mark corpus for score recalculation.
-			hub.corpusStale = true
-			scoreSum := 0
-			if len(ro1.corpus) > 0 {
-				scoreSum = ro1.corpus[len(ro1.corpus)-1].runningScoreSum
-			}
-			input.score = defScore
-			input.runningScoreSum = scoreSum + defScore
-			ro1.corpus = append(ro1.corpus, input)
-			hub.updateMaxCover(input.cover)
-			ro1.corpusCover = makeCopy(ro.corpusCover)
-			hub.corpusCoverSize = updateMaxCover(ro1.corpusCover, input.cover)
-			if input.res > 0 || input.typ == execBootstrap {
-				ro1.verse = versifier.BuildVerse(ro.verse, input.data)
+		case crash := <-hub.newCrasherC:
+			hub.addCrasher(crash)
+
+		case slow := <-hub.newSlowC:
+			hub.addSlowInput(slow)
+
+		case cs := <-hub.newChecksumC:
+			hub.addChecksum(cs)
+		}
+	}
+}
+
+// The following methods pass messages from workers to the hub.
+// In -deterministic mode the hub does not have own goroutine and messages
+// are processed synchronously by the only worker, so that the worker always
+// observes the effects of its previous messages.
+
+func (hub *Hub) newInput(input Input) {
+	if !*flagDeterministic {
+		hub.newInputC <- input
+	} else if !hub.addInput(input) {
+		log.Fatalf("lost connection to coordinator")
+	}
+}
+
+func (hub *Hub) newCrasher(crash NewCrasherArgs) {
+	if !*flagDeterministic {
+		hub.newCrasherC <- crash
+	} else {
+		hub.addCrasher(crash)
+	}
+}
+
+func (hub *Hub) newSlowInput(slow NewSlowInputArgs) {
+	if !*flagDeterministic {
+		hub.newSlowC <- slow
+	} else {
+		hub.addSlowInput(slow)
+	}
+}
+
+func (hub *Hub) newChecksum(cs Checksum) {
+	if !*flagDeterministic {
+		hub.newChecksumC <- cs
+	} else {
+		hub.addChecksum(cs)
+	}
+}
+
+func (hub *Hub) newStats(s Stats) {
+	if !*flagDeterministic {
+		hub.syncC <- s
+	} else {
+		hub.addStats(s)
+		if !hub.sync() {
+			log.Fatalf("lost connection to coordinator")
+		}
+	}
+}
+
+// popTriage removes the next input from the triage queue.
+func (hub *Hub) popTriage() (CoordinatorInput, bool) {
+	n := len(hub.triageQueue) - 1
+	if n < 0 {
+		return CoordinatorInput{}, false
+	}
+	input := hub.triageQueue[n]
+	hub.triageQueue[n] = CoordinatorInput{}
+	hub.triageQueue = hub.triageQueue[:n]
+	return input, true
+}
+
+// sync syncs with the coordinator. It returns false if the connection is lost.
+func (hub *Hub) sync() bool {
+	if *flagV >= 1 {
+		ro := hub.ro.Load().(*ROData)
+		log.Printf("hub: corpus=%v bootstrap=%v fuzz=%v minimize=%v versifier=%v smash=%v grammar=%v sonar=%v",
+			len(ro.corpus), hub.corpusOrigins[execBootstrap]+hub.corpusOrigins[execCorpus],
+			hub.corpusOrigins[execFuzz]+hub.corpusOrigins[execSonar],
+			hub.corpusOrigins[execMinimizeInput]+hub.corpusOrigins[execMinimizeCrasher],
+			hub.corpusOrigins[execVersifier], hub.corpusOrigins[execSmash], hub.corpusOrigins[execGrammar],
+			hub.corpusOrigins[execSonarHint])
+		log.Printf("hub: mutations (finds/execs): %v", &hub.mutations)
+	}
+	args := &SyncArgs{
+		ID:            hub.id,
+		Execs:         hub.stats.execs,
+		Restarts:      hub.stats.restarts,
+		CoverFullness: hub.corpusCoverSize,
+		Mutations:     hub.stats.mutations,
+	}
+	hub.stats = Stats{}
+	var res SyncRes
+	if err := hub.coordinator.Call("Coordinator.Sync", args, &res); err != nil {
+		log.Printf("sync call failed: %v, reconnection to coordinator", err)
+		if err := hub.connect(); err != nil {
+			log.Printf("failed to connect to coordinator: %v, killing worker", err)
+			return false
+		}
+	}
+	if len(res.Inputs) > 0 {
+		hub.triageQueue = append(hub.triageQueue, res.Inputs...)
+	}
+	if !*flagDeterministic {
+		// In -deterministic mode scores are updated by refreshScores.
+		hub.refreshScores()
+	}
+	return true
+}
+
+// refreshScores recalculates corpus scores if new inputs were added since the last call.
+// Scores of schedules that depend on fuzzing progress are also recalculated periodically.
+func (hub *Hub) refreshScores() {
+	hub.scoreRefreshes++
+	ro := hub.ro.Load().(*ROData)
+	if len(ro.corpus) == 0 {
+		return
+	}
+	if hub.corpusStale || hub.schedule.energy != nil && hub.scoreRefreshes%dynamicScorePeriod == 0 {
+		hub.updateScores()
+		hub.corpusStale = false
+	}
+}
+
+// addStats accounts stats from a worker.
+func (hub *Hub) addStats(s Stats) {
+	hub.stats.execs += s.execs
+	hub.stats.restarts += s.restarts
+	hub.stats.mutations.add(&s.mutations)
+	hub.mutations.add(&s.mutations)
+	for idx, n := range s.fuzzed {
+		for len(hub.fuzzed) <= idx {
+			hub.fuzzed = append(hub.fuzzed, 0)
+		}
+		hub.fuzzed[idx] += n
+	}
+	for e, n := range s.edgeHits {
+		hub.edgeHits[e] += uint64(n)
+	}
+	for idx, hits := range s.species {
+		for len(hub.species) <= idx {
+			hub.species = append(hub.species, nil)
+		}
+		if hub.species[idx] == nil {
+			hub.species[idx] = make(map[int]uint32)
+		}
+		for e, n := range hits {
+			hub.species[idx][e] += n
+		}
+	}
+}
+
+// addInput adds new interesting input from workers to corpus.
+// It returns false if the connection to the coordinator is lost.
+func (hub *Hub) addInput(input Input) bool {
+	ro := hub.ro.Load().(*ROData)
+	if !compareCover(ro.corpusCover, input.cover) &&
+		(ro.resources == nil || !ro.resources.improves(input.cover, input.execTime, input.alloc)) {
+		return true
+	}
+	sig := hash(input.data)
+	if _, ok := hub.corpusSigs[sig]; ok {
+		return true
+	}
+
+	// Passed deduplication, taking it.
+	if *flagV >= 2 {
+		log.Printf("hub received new input [%v]%v mine=%v", len(input.data), hash(input.data), input.mine)
+	}
+	hub.corpusSigs[sig] = struct{}{}
+	ro1 := new(ROData)
+	*ro1 = *ro
+	// Assign it the default score, but mark corpus for score recalculation.
+	hub.corpusStale = true
+	scoreSum := 0
+	if len(ro1.corpus) > 0 {
+		scoreSum = ro1.corpus[len(ro1.corpus)-1].runningScoreSum
+	}
+	if hub.grammar != nil {
+		// Trees are not sent along with inputs, so reconstruct it from the data.
+		input.tree = hub.grammar.Parse(input.data)
+	}
+	input.score = defScore
+	input.runningScoreSum = scoreSum + defScore
+	ro1.corpus = append(ro1.corpus, input)
+	hub.updateMaxCover(input.cover)
+	ro1.corpusCover = makeCopy(ro.corpusCover)
+	hub.corpusCoverSize = updateMaxCover(ro1.corpusCover, input.cover)
+	if ro.resources != nil {
+		ro1.resources = ro.resources.copy()
+		ro1.resources.update(input.cover, input.execTime, input.alloc)
+	}
+	if input.res > 0 || input.typ == execBootstrap {
+		ro1.verse = versifier.BuildVerse(ro.verse, input.data)
+	}
+	hub.ro.Store(ro1)
+	hub.corpusOrigins[input.typ]++
+
+	if input.mine {
+		if err := hub.coordinator.Call("Coordinator.NewInput", NewInputArgs{hub.id, input.data, uint64(input.depth)}, nil); err != nil {
+			log.Printf("new input call failed: %v, reconnecting to coordinator", err)
+			if err := hub.connect(); err != nil {
+				log.Printf("failed to connect to coordinator: %v, killing worker", err)
+				return false
 			}
-			hub.ro.Store(ro1)
-			hub.corpusOrigins[input.typ]++
-
-			if input.mine {
-				if err := hub.coordinator.Call("Coordinator.NewInput", NewInputArgs{hub.id, input.data, uint64(input.depth)}, nil); err != nil {
-					log.Printf("new input call failed: %v, reconnecting to coordinator", err)
-					if err := hub.connect(); err != nil {
-						log.Printf("failed to connect to coordinator: %v, killing worker", err)
-						return
-					}
-				}
+		}
+		if *flagDeterministic {
+			// Get the input back for smashing right away rather than on the next periodic sync.
+			if !hub.sync() {
+				return false
 			}
+		}
+	}
 
-			if *flagDumpCover {
-				dumpCover(filepath.Join(*flagWorkdir, "coverprofile"), ro.coverBlocks, ro.corpusCover)
-			}
+	if *flagDumpCover {
+		dumpCover(filepath.Join(*flagWorkdir, "coverprofile"), ro.coverBlocks, ro.corpusCover)
+	}
+	return true
+}
 
-		case crash := <-hub.newCrasherC:
-			// New crasher from workers. Woohoo!
-			if crash.Hanging || !*flagDup {
-				ro := hub.ro.Load().(*ROData)
-				ro1 := new(ROData)
-				*ro1 = *ro
-				if crash.Hanging {
-					ro1.badInputs = make(map[Sig]struct{})
-					for k, v := range ro.badInputs {
-						ro1.badInputs[k] = v
-					}
-					ro1.badInputs[hash(crash.Data)] = struct{}{}
-				}
-				if !*flagDup {
-					ro1.suppressions = make(map[Sig]struct{})
-					for k, v := range ro.suppressions {
-						ro1.suppressions[k] = v
-					}
-					ro1.suppressions[hash(crash.Suppression)] = struct{}{}
-				}
-				hub.ro.Store(ro1)
+// addCrasher passes new crasher from workers to the coordinator. Woohoo!
+func (hub *Hub) addCrasher(crash NewCrasherArgs) {
+	if crash.Hanging || !*flagDup {
+		ro := hub.ro.Load().(*ROData)
+		ro1 := new(ROData)
+		*ro1 = *ro
+		if crash.Hanging {
+			ro1.badInputs = make(map[Sig]struct{})
+			for k, v := range ro.badInputs {
+				ro1.badInputs[k] = v
 			}
-			if err := hub.coordinator.Call("Coordinator.NewCrasher", crash, nil); err != nil {
-				log.Printf("new crasher call failed: %v", err)
+			ro1.badInputs[hash(crash.Data)] = struct{}{}
+		}
+		if !*flagDup {
+			ro1.suppressions = make(map[Sig]struct{})
+			for k, v := range ro.suppressions {
+				ro1.suppressions[k] = v
 			}
+			ro1.suppressions[hash(crash.Suppression)] = struct{}{}
 		}
+		hub.ro.Store(ro1)
 	}
+	crash.PkgName = hub.pkgName
+	crash.Func = hub.fnname
+	if err := hub.coordinator.Call("Coordinator.NewCrasher", crash, nil); err != nil {
+		log.Printf("new crasher call failed: %v", err)
+	}
+}
+
+// addSlowInput passes new slow input from workers to the coordinator.
+// Workers can rediscover the same input many times, so it is reported only once.
+// Inputs that cover the same edges are most likely mutants of the same slow input,
+// only the first of them is reported.
+func (hub *Hub) addSlowInput(slow NewSlowInputArgs) {
+	if _, ok := hub.slowInputs[slow.Cover]; ok || len(hub.slowInputs) >= maxSlowInputs {
+		return
+	}
+	hub.slowInputs[slow.Cover] = struct{}{}
+	if err := hub.coordinator.Call("Coordinator.NewSlowInput", slow, nil); err != nil {
+		log.Printf("new slow input call failed: %v", err)
+	}
+}
+
+// addChecksum remembers new checksum detected by workers.
+// If there are too many checksums, the oldest one is dropped,
+// so that checksums detected early don't take all slots.
+func (hub *Hub) addChecksum(cs Checksum) {
+	ro := hub.ro.Load().(*ROData)
+	if ro.hasChecksum(cs) {
+		return
+	}
+	checksums := ro.checksums
+	if len(checksums) >= maxChecksumFixups {
+		checksums = checksums[len(checksums)-maxChecksumFixups+1:]
+	}
+	ro1 := new(ROData)
+	*ro1 = *ro
+	ro1.checksums = append(append([]Checksum{}, checksums...), cs)
+	hub.ro.Store(ro1)
+}
+
+func (ro *ROData) hasChecksum(cs Checksum) bool {
+	for _, cs1 := range ro.checksums {
+		if cs1 == cs {
+			return true
+		}
+	}
+	return false
 }
 
 // Preliminary cover update to prevent new input thundering herd.
@@ -332,6 +581,18 @@ func (hub *Hub) updateScores() {
 	n := uint64(len(corpus))
 	avgExecTime := sumExecTime / n
 	avgCoverSize := sumCoverSize / n
+	ro1.avgExecTime = avgExecTime
+	ro1.slowExecTime = slowExecTime(avgExecTime)
+	for i := range corpus {
+		if i < len(hub.fuzzed) {
+			corpus[i].fuzzed = hub.fuzzed[i]
+		}
+	}
+	if hub.schedule.edges {
+		ro1.edgeHits = make([]uint64, CoverSize)
+		copy(ro1.edgeHits, hub.edgeHits)
+	}
+	sched := newScheduleState(hub.schedule, corpus, ro.corpusCover, hub.edgeHits, hub.species)
 
 	// Phase 1: calculate score for each input independently.
 	for i, inp := range corpus {
@@ -339,7 +600,11 @@ func (hub *Hub) updateScores() {
 
 		// Execution time multiplier 0.1-3x.
 		// Fuzzing faster inputs increases efficiency.
-		execTime := float64(inp.execTime) / float64(avgExecTime)
+		// Exec time is not measured in -deterministic mode.
+		execTime := 1.0
+		if avgExecTime != 0 {
+			execTime = float64(inp.execTime) / float64(avgExecTime)
+		}
 		if execTime > 10 {
 			score /= 10
 		} else if execTime > 4 {
@@ -392,6 +657,11 @@ func (hub *Hub) updateScores() {
 			score *= 2
 		}
 
+		// Power schedule multiplier.
+		if hub.schedule.energy != nil {
+			score *= hub.schedule.energy(sched, i, &corpus[i])
+		}
+
 		if score < minScore {
 			score = minScore
 		} else if score > maxScore {
@@ -445,6 +715,15 @@ func (hub *Hub) updateScores() {
 			candidates[i].score = 0
 		}
 	}
+	// Inputs that hold per-edge resource usage maxima are favored as well,
+	// otherwise they are never fuzzed since they don't add coverage.
+	if ro.resources != nil {
+		for i, inp := range corpus {
+			if !inp.favored && ro.resources.holdsMax(inp.cover, inp.execTime, inp.alloc) {
+				corpus[i].favored = true
+			}
+		}
+	}
 	scoreSum := 0
 	for i, inp := range corpus {
 		if !inp.favored {
@@ -456,3 +735,15 @@ func (hub *Hub) updateScores() {
 
 	hub.ro.Store(ro1)
 }
+
+// slowExecTime returns exec time threshold for slow inputs.
+func slowExecTime(avgExecTime uint64) uint64 {
+	if *flagSlowFactor == 0 || avgExecTime == 0 {
+		return 0
+	}
+	t := uint64(float64(avgExecTime) * *flagSlowFactor)
+	if t < uint64(minSlowExecTime) {
+		t = uint64(minSlowExecTime)
+	}
+	return t
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+func TestSlowExecTime(t *testing.T) {
+	defer func(factor float64) { *flagSlowFactor = factor }(*flagSlowFactor)
+	*flagSlowFactor = 100
+	tests := []struct {
+		avg, want uint64
+	}{
+		{0, 0},
+		{1000, uint64(minSlowExecTime)},
+		{uint64(time.Millisecond), uint64(100 * time.Millisecond)},
+		{uint64(time.Second), uint64(100 * time.Second)},
+	}
+	for _, test := range tests {
+		if got := slowExecTime(test.avg); got != test.want {
+			t.Errorf("avg %v: got %v, want %v", test.avg, got, test.want)
+		}
+	}
+	*flagSlowFactor = 0
+	if got := slowExecTime(uint64(time.Second)); got != 0 {
+		t.Errorf("disabled slow inputs: got %v", got)
+	}
+}
+
+func TestSlowInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-fuzz-slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &Coordinator{slow: newPersistentSet(dir)}
+	srv := rpc.NewServer()
+	if err := srv.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	conn1, conn2 := net.Pipe()
+	go srv.ServeConn(conn1)
+	client := rpc.NewClient(conn2)
+	defer client.Close()
+	hub := &Hub{coordinator: client, slowInputs: make(map[Sig]struct{})}
+
+	// cover returns a signature of cover with the given hit counts of 2 edges.
+	cover := func(hits ...byte) Sig {
+		cover := make([]byte, CoverSize)
+		copy(cover[10:], hits)
+		return coverSig(cover)
+	}
+	// A slower input must not hide a faster one with a different path,
+	// repeated inputs and inputs with the same path are stored once.
+	avg := uint64(time.Millisecond)
+	inputs := []NewSlowInputArgs{
+		{[]byte("aaaa"), uint64(5 * time.Second), avg, cover(1, 0)},
+		{[]byte("bbbb"), uint64(time.Second), avg, cover(1, 1)},
+		{[]byte("aaaa"), uint64(6 * time.Second), avg, cover(1, 0)},
+		{[]byte("cccc"), uint64(2 * time.Second), avg, cover(5, 0)},
+	}
+	for _, inp := range inputs {
+		hub.addSlowInput(inp)
+	}
+	if len(c.slow.m) != 2 {
+		t.Fatalf("stored %v slow inputs, want 2", len(c.slow.m))
+	}
+	for _, data := range []string{"aaaa", "bbbb"} {
+		if _, ok := c.slow.m[hash([]byte(data))]; !ok {
+			t.Errorf("slow input %q is not stored", data)
+		}
+	}
+	// The coordinator deduplicates inputs from different hubs as well.
+	hub.slowInputs = make(map[Sig]struct{})
+	hub.addSlowInput(inputs[1])
+	if len(c.slow.m) != 2 {
+		t.Fatalf("stored %v slow inputs after a duplicate, want 2", len(c.slow.m))
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("got %v files in slow dir, want 4 (inputs and .time descriptions)", len(files))
+	}
+	// Both the hub and the coordinator limit the number of slow inputs.
+	for i := 0; i < 2*maxSlowInputs; i++ {
+		cover := make([]byte, CoverSize)
+		cover[100+i] = 1
+		hub.addSlowInput(NewSlowInputArgs{[]byte(fmt.Sprint(i)), uint64(time.Second), avg, coverSig(cover)})
+	}
+	if len(hub.slowInputs) != maxSlowInputs || len(c.slow.m) != maxSlowInputs {
+		t.Fatalf("hub has %v slow inputs, coordinator has %v, want %v", len(hub.slowInputs), len(c.slow.m), maxSlowInputs)
+	}
+	hub.slowInputs = make(map[Sig]struct{})
+	hub.addSlowInput(NewSlowInputArgs{[]byte("dddd"), uint64(time.Second), avg, cover(0, 0, 2)})
+	if len(c.slow.m) != maxSlowInputs {
+		t.Fatalf("coordinator stored %v slow inputs, want %v", len(c.slow.m), maxSlowInputs)
+	}
+}
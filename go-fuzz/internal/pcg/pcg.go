@@ -4,8 +4,9 @@
 // Package pcg implements a 32 bit PRNG with a 64 bit period: pcg xsh rr 64 32.
 // See https://www.pcg-random.org/ for more information.
 // This implementation is geared specifically towards go-fuzz's needs:
-// Simple creation and use, no reproducibility, no concurrency safety,
+// Simple creation and use, no concurrency safety,
 // just the methods go-fuzz needs, optimized for speed.
+// Rands are seeded from the current time, unless Seed is called.
 package pcg
 
 import (
@@ -14,7 +15,11 @@ import (
 	"time"
 )
 
-var globalInc uint64 // PCG stream
+var (
+	globalInc  uint64 // PCG stream
+	globalSeed uint64 // seed set by Seed
+	seeded     uint32 // Seed was called
+)
 
 const multiplier uint64 = 6364136223846793005
 
@@ -29,15 +34,26 @@ type Rand struct {
 	inc    uint64
 }
 
+// Seed makes Rands reproducible: the n-th Rand created after Seed
+// always generates the same sequence for the same seed.
+func Seed(seed uint64) {
+	atomic.StoreUint64(&globalSeed, seed)
+	atomic.StoreUint64(&globalInc, 0)
+	atomic.StoreUint32(&seeded, 1)
+}
+
 // New generates a new, seeded Rand, ready for use.
 func New() *Rand {
 	r := new(Rand)
-	now := uint64(time.Now().UnixNano())
+	seed := uint64(time.Now().UnixNano())
+	if atomic.LoadUint32(&seeded) != 0 {
+		seed = atomic.LoadUint64(&globalSeed)
+	}
 	inc := atomic.AddUint64(&globalInc, 1)
-	r.state = now
+	r.state = seed
 	r.inc = (inc << 1) | 1
 	r.step()
-	r.state += now
+	r.state += seed
 	r.step()
 	return r
 }
@@ -0,0 +1,30 @@
+// Copyright 2019 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package pcg
+
+import "testing"
+
+func TestSeed(t *testing.T) {
+	gen := func(seed uint64) [2][8]uint32 {
+		Seed(seed)
+		var res [2][8]uint32
+		for i := range res {
+			r := New()
+			for j := range res[i] {
+				res[i][j] = r.Uint32()
+			}
+		}
+		return res
+	}
+	a, b := gen(1), gen(1)
+	if a != b {
+		t.Fatalf("different sequences for the same seed:\n%v\n%v", a, b)
+	}
+	if a[0] == a[1] {
+		t.Fatalf("Rands created after Seed generate the same sequence: %v", a[0])
+	}
+	if c := gen(2); a == c {
+		t.Fatalf("same sequences for different seeds: %v", a)
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package jsonmut implements structure-aware mutations of JSON inputs.
+//
+// Unlike encoding/json, the parser preserves order of object members,
+// duplicate keys and exact text of numbers and strings (including escapes,
+// lone surrogates and invalid UTF-8), so that an input is not changed
+// beyond the applied mutations (modulo formatting).
+package jsonmut
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type Kind int
+
+const (
+	Null Kind = iota
+	Bool
+	Number
+	String
+	Array
+	Object
+)
+
+// Value is a parsed JSON value.
+type Value struct {
+	Kind    Kind
+	Text    string // literal text for Null, Bool and Number; decoded string for String
+	Elems   []*Value
+	Members []Member
+	raw     rawString // original text of String
+}
+
+// Member is an object member.
+type Member struct {
+	Key string
+	Val *Value
+	raw rawString // original text of Key
+}
+
+// rawString is a string as it appears in the input (without quotes).
+// It is serialized as is while the decoded string is not changed,
+// decoding is lossy for lone surrogates and invalid UTF-8.
+type rawString struct {
+	text string // decoded string
+	raw  string
+}
+
+// maxNesting bounds recursion of the parser.
+const maxNesting = 1000
+
+// Parse parses a single JSON value (surrounded by optional whitespace).
+func Parse(data []byte) (*Value, error) {
+	p := &parser{data: data}
+	p.skipSpace()
+	v, err := p.value(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.data) {
+		return nil, p.errorf("trailing data")
+	}
+	return v, nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+}
+
+func (p *parser) errorf(msg string, args ...interface{}) error {
+	return fmt.Errorf("offset %v: %v", p.pos, fmt.Sprintf(msg, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) value(depth int) (*Value, error) {
+	if depth > maxNesting {
+		return nil, p.errorf("too deep nesting")
+	}
+	if p.pos == len(p.data) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		p.pos++
+		v := &Value{Kind: Object}
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == '}' {
+			p.pos++
+			return v, nil
+		}
+		for {
+			p.skipSpace()
+			if p.pos == len(p.data) || p.data[p.pos] != '"' {
+				return nil, p.errorf("expected object key")
+			}
+			key, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if p.pos == len(p.data) || p.data[p.pos] != ':' {
+				return nil, p.errorf("expected ':'")
+			}
+			p.pos++
+			p.skipSpace()
+			val, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v.Members = append(v.Members, Member{Key: key.text, Val: val, raw: key})
+			if done, err := p.next('}'); err != nil || done {
+				return v, err
+			}
+		}
+	case c == '[':
+		p.pos++
+		v := &Value{Kind: Array}
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == ']' {
+			p.pos++
+			return v, nil
+		}
+		for {
+			p.skipSpace()
+			elem, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v.Elems = append(v.Elems, elem)
+			if done, err := p.next(']'); err != nil || done {
+				return v, err
+			}
+		}
+	case c == '"':
+		s, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Kind: String, Text: s.text, raw: s}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	default:
+		for _, lit := range []struct {
+			text string
+			kind Kind
+		}{{"null", Null}, {"true", Bool}, {"false", Bool}} {
+			if len(p.data)-p.pos >= len(lit.text) && string(p.data[p.pos:p.pos+len(lit.text)]) == lit.text {
+				p.pos += len(lit.text)
+				return &Value{Kind: lit.kind, Text: lit.text}, nil
+			}
+		}
+		return nil, p.errorf("unexpected character %q", c)
+	}
+}
+
+// next consumes either ',' or the closing bracket after an element.
+func (p *parser) next(end byte) (bool, error) {
+	p.skipSpace()
+	if p.pos == len(p.data) {
+		return false, p.errorf("unexpected end of input")
+	}
+	switch p.data[p.pos] {
+	case ',':
+		p.pos++
+		return false, nil
+	case end:
+		p.pos++
+		return true, nil
+	}
+	return false, p.errorf("expected ',' or %q", end)
+}
+
+func (p *parser) number() (*Value, error) {
+	start := p.pos
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+			p.pos++
+			n++
+		}
+		return n
+	}
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '0' {
+		p.pos++
+	} else if digits() == 0 {
+		return nil, p.errorf("bad number")
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '.' {
+		p.pos++
+		if digits() == 0 {
+			return nil, p.errorf("bad number")
+		}
+	}
+	if p.pos < len(p.data) && (p.data[p.pos] == 'e' || p.data[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.data) && (p.data[p.pos] == '+' || p.data[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			return nil, p.errorf("bad number")
+		}
+	}
+	return &Value{Kind: Number, Text: string(p.data[start:p.pos])}, nil
+}
+
+func (p *parser) str() (rawString, error) {
+	p.pos++ // opening quote
+	start := p.pos
+	var buf []byte
+	for {
+		if p.pos == len(p.data) {
+			return rawString{}, p.errorf("unterminated string")
+		}
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return rawString{string(buf), string(p.data[start : p.pos-1])}, nil
+		case c < 0x20:
+			return rawString{}, p.errorf("control character in string")
+		case c != '\\':
+			buf = append(buf, c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 == len(p.data) {
+			return rawString{}, p.errorf("unterminated string")
+		}
+		esc := p.data[p.pos+1]
+		p.pos += 2
+		switch esc {
+		case '"', '\\', '/':
+			buf = append(buf, esc)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r, ok := p.hex4()
+			if !ok {
+				return rawString{}, p.errorf("bad unicode escape")
+			}
+			if utf16.IsSurrogate(r) && p.pos+6 <= len(p.data) && p.data[p.pos] == '\\' && p.data[p.pos+1] == 'u' {
+				save := p.pos
+				p.pos += 2
+				if r2, ok := p.hex4(); ok && utf16.DecodeRune(r, r2) != utf8.RuneError {
+					r = utf16.DecodeRune(r, r2)
+				} else {
+					p.pos = save
+				}
+			}
+			buf = append(buf, string(r)...)
+		default:
+			return rawString{}, p.errorf("bad escape %q", esc)
+		}
+	}
+}
+
+func (p *parser) hex4() (rune, bool) {
+	if p.pos+4 > len(p.data) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(string(p.data[p.pos:p.pos+4]), 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	p.pos += 4
+	return rune(v), true
+}
+
+// Marshal serializes the value in compact form.
+func (v *Value) Marshal() []byte {
+	e := &encoder{}
+	e.value(v, 0)
+	return e.buf
+}
+
+// encoder serializes values with configurable formatting.
+type encoder struct {
+	buf       []byte
+	indent    string // if not empty, elements are put on separate lines with this indent
+	space     bool   // put spaces after ':' and ','
+	escapeAll bool   // escape all non-ASCII and HTML-sensitive characters
+}
+
+func (e *encoder) value(v *Value, depth int) {
+	switch v.Kind {
+	case String:
+		e.str(v.Text, v.raw)
+	case Array:
+		e.buf = append(e.buf, '[')
+		for i, elem := range v.Elems {
+			e.sep(i, depth+1)
+			e.value(elem, depth+1)
+		}
+		e.end(len(v.Elems), depth)
+		e.buf = append(e.buf, ']')
+	case Object:
+		e.buf = append(e.buf, '{')
+		for i, m := range v.Members {
+			e.sep(i, depth+1)
+			e.str(m.Key, m.raw)
+			e.buf = append(e.buf, ':')
+			if e.space || e.indent != "" {
+				e.buf = append(e.buf, ' ')
+			}
+			e.value(m.Val, depth+1)
+		}
+		e.end(len(v.Members), depth)
+		e.buf = append(e.buf, '}')
+	default:
+		e.buf = append(e.buf, v.Text...)
+	}
+}
+
+func (e *encoder) sep(i, depth int) {
+	if i != 0 {
+		e.buf = append(e.buf, ',')
+		if e.space && e.indent == "" {
+			e.buf = append(e.buf, ' ')
+		}
+	}
+	e.newline(depth)
+}
+
+func (e *encoder) end(n, depth int) {
+	if n != 0 {
+		e.newline(depth)
+	}
+}
+
+func (e *encoder) newline(depth int) {
+	if e.indent == "" {
+		return
+	}
+	e.buf = append(e.buf, '\n')
+	for i := 0; i < depth; i++ {
+		e.buf = append(e.buf, e.indent...)
+	}
+}
+
+// str serializes string s, raw is used if s is not changed since parsing.
+func (e *encoder) str(s string, raw rawString) {
+	const hex = "0123456789abcdef"
+	e.buf = append(e.buf, '"')
+	if raw.raw != "" && raw.text == s {
+		e.buf = append(e.buf, raw.raw...)
+		e.buf = append(e.buf, '"')
+		return
+	}
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			e.buf = append(e.buf, '\\', byte(r))
+		case r == '\n':
+			e.buf = append(e.buf, '\\', 'n')
+		case r == '\t':
+			e.buf = append(e.buf, '\\', 't')
+		case r < 0x20 || e.escapeAll && (r == '<' || r == '>' || r == '&' || r >= utf8.RuneSelf):
+			if r > 0xffff {
+				r1, r2 := utf16.EncodeRune(r)
+				e.buf = append(e.buf, '\\', 'u', hex[r1>>12], hex[r1>>8&0xf], hex[r1>>4&0xf], hex[r1&0xf])
+				r = r2
+			}
+			e.buf = append(e.buf, '\\', 'u', hex[r>>12], hex[r>>8&0xf], hex[r>>4&0xf], hex[r&0xf])
+		default:
+			e.buf = append(e.buf, string(r)...)
+		}
+	}
+	e.buf = append(e.buf, '"')
+}
+
+func (v *Value) clone() *Value {
+	v1 := *v
+	v1.Elems = make([]*Value, len(v.Elems))
+	for i, elem := range v.Elems {
+		v1.Elems[i] = elem.clone()
+	}
+	v1.Members = make([]Member, len(v.Members))
+	for i, m := range v.Members {
+		v1.Members[i] = m
+		v1.Members[i].Val = m.Val.clone()
+	}
+	return &v1
+}
+
+// walk calls fn for the value and all nested values.
+func (v *Value) walk(fn func(v *Value)) {
+	fn(v)
+	for _, elem := range v.Elems {
+		elem.walk(fn)
+	}
+	for _, m := range v.Members {
+		m.Val.walk(fn)
+	}
+}
+
+// depth returns nesting depth of the value (0 for scalars).
+func (v *Value) depth() int {
+	d := 0
+	for _, elem := range v.Elems {
+		if d1 := elem.depth() + 1; d1 > d {
+			d = d1
+		}
+	}
+	for _, m := range v.Members {
+		if d1 := m.Val.depth() + 1; d1 > d {
+			d = d1
+		}
+	}
+	return d
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package jsonmut
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		data string
+		want string // compact serialization, empty if data is invalid
+	}{
+		{`null`, `null`},
+		{` [1, -2.5e+3 , true,false,null] `, `[1,-2.5e+3,true,false,null]`},
+		{`{"b": 1, "a": {"c": []}, "b": 2}`, `{"b":1,"a":{"c":[]},"b":2}`},
+		{`"é😀\n\/\"\\"`, `"é😀\n\/\"\\"`},
+		{`"\ud800"`, `"\ud800"`},
+		{`{"\u0041\udc00x":"\ud83d\ude00"}`, `{"\u0041\udc00x":"\ud83d\ude00"}`},
+		{"[\"\xff\xfe\", \"\xed\xa0\x80\"]", "[\"\xff\xfe\",\"\xed\xa0\x80\"]"},
+		{`{}`, `{}`},
+		{``, ``},
+		{`[1,]`, ``},
+		{`{"a" 1}`, ``},
+		{`{"a":1,}`, ``},
+		{`01`, ``},
+		{`1.`, ``},
+		{`-`, ``},
+		{`"abc`, ``},
+		{`"\x"`, ``},
+		{"\"\x01\"", ``},
+		{`tru`, ``},
+		{`[1] 2`, ``},
+	} {
+		v, err := Parse([]byte(test.data))
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: parsed invalid input", test.data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: failed to parse: %v", test.data, err)
+			continue
+		}
+		if got := string(v.Marshal()); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.data, got, test.want)
+		}
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	v, err := Parse([]byte(`{"\ud800": ["\u0041", "\udfff"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changed strings are re-encoded, the rest are kept as is.
+	v1 := v.clone()
+	v1.Members[0].Val.Elems[0].Text = "B\n"
+	if got, want := string(v1.Marshal()), `{"\ud800":["B\n","\udfff"]}`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	v1.Members[0].Key = "k"
+	if got, want := string(v1.Marshal()), `{"k":["B\n","\udfff"]}`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := string(v.Marshal()), `{"\ud800":["\u0041","\udfff"]}`; got != want {
+		t.Errorf("original value is changed: got %q, want %q", got, want)
+	}
+}
+
+func TestMutate(t *testing.T) {
+	m := &Mutator{
+		Rand: rand.New(rand.NewSource(0)),
+		Dict: []string{"id", "name"},
+	}
+	corpus := [][]byte{
+		[]byte(`{"id": 1, "name": "foo", "tags": ["a", "b"], "nested": {"x": 1.5, "y": null}}`),
+		[]byte(`[true, {"id": 2}]`),
+	}
+	changed := 0
+	for i := 0; i < 1000; i++ {
+		data := corpus[m.Rand.Intn(len(corpus))]
+		donors := [][]byte{corpus[m.Rand.Intn(len(corpus))], corpus[m.Rand.Intn(len(corpus))]}
+		res, ok := m.Mutate(data, donors)
+		if !ok {
+			t.Fatalf("failed to mutate valid input %q", data)
+		}
+		if _, err := Parse(res); err != nil {
+			t.Fatalf("mutated input %q is not valid: %v", res, err)
+		}
+		if !json.Valid(res) {
+			t.Fatalf("mutated input %q is not valid for encoding/json", res)
+		}
+		if string(res) != string(data) {
+			changed++
+		}
+		if len(res) < 1<<12 {
+			corpus = append(corpus, res)
+		}
+	}
+	if changed < 500 {
+		t.Fatalf("only %v mutations changed input", changed)
+	}
+	if _, ok := m.Mutate([]byte(`{"a":`), nil); ok {
+		t.Fatalf("mutated invalid input")
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package jsonmut
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Rand is the source of randomness for mutations.
+type Rand interface {
+	Intn(n int) int
+}
+
+// Mutator mutates JSON inputs.
+type Mutator struct {
+	Rand Rand
+	// Dict contains interesting strings (e.g. string literals of the tested program),
+	// they are used as object keys and string values.
+	Dict []string
+}
+
+var interestingNumbers = []string{
+	"0", "-0", "1", "-1", "0.0", "1.5", "-1e-7", "1e308", "1e309", "-1e309", "4.9e-324", "1e-400",
+	"127", "128", "255", "256", "-129", "32767", "65535", "65536", "2147483647", "2147483648",
+	"-2147483649", "4294967295", "4294967296", "9007199254740992", "9007199254740993",
+	"9223372036854775807", "9223372036854775808", "-9223372036854775809",
+	"18446744073709551615", "18446744073709551616", "1E2", "1e+2", "0.1e1",
+	"100000000000000000000000000000000000000000000000000000000000000000000000",
+}
+
+var interestingStrings = []string{
+	"", " ", "0", "-1", "true", "null", "\x00", "\u2028", "\ufffd", "\U0001F600",
+	"%s%n", "../../", "\\", "\"", "<script>", "2006-01-02T15:04:05Z", "1e1000",
+}
+
+// Mutate parses data as JSON, applies a few mutations and returns the serialized result.
+// Subtrees can be spliced from donors (other JSON inputs).
+// It returns false if data is not valid JSON.
+func (m *Mutator) Mutate(data []byte, donors [][]byte) ([]byte, bool) {
+	root, err := Parse(data)
+	if err != nil {
+		return nil, false
+	}
+	var donorVals []*Value
+	for _, d := range donors {
+		if v, err := Parse(d); err == nil {
+			donorVals = append(donorVals, v)
+		}
+	}
+	root = root.clone()
+	for iter := 0; iter == 0 || m.Rand.Intn(2) == 0; iter++ {
+		m.mutate(root, donorVals)
+	}
+	return m.encode(root), true
+}
+
+func (m *Mutator) mutate(root *Value, donors []*Value) {
+	r := m.Rand
+	var vals []*Value
+	root.walk(func(v *Value) {
+		vals = append(vals, v)
+	})
+	v := vals[r.Intn(len(vals))]
+	for tries := 0; tries < 10; tries++ {
+		switch r.Intn(10) {
+		case 0:
+			// Change a number to an edge case.
+			if v.Kind != Number {
+				continue
+			}
+			if r.Intn(3) == 0 {
+				if f, err := strconv.ParseFloat(v.Text, 64); err == nil {
+					v.Text = strconv.FormatFloat(f+float64(r.Intn(3)-1), 'g', -1, 64)
+					break
+				}
+			}
+			v.Text = interestingNumbers[r.Intn(len(interestingNumbers))]
+		case 1:
+			// Change a string to a dictionary token.
+			if v.Kind != String {
+				continue
+			}
+			v.Text = m.randString()
+		case 2:
+			// Type confusion: replace a value with a value of a different type.
+			*v = *m.randValue(v.Kind)
+		case 3:
+			// Deep nesting (but keep the result parsable).
+			inner := *v
+			n := 1 << uint(r.Intn(10))
+			if d := maxNesting - root.depth(); n > d {
+				n = d
+			}
+			for i := 0; i < n; i++ {
+				inner1 := inner
+				if r.Intn(2) == 0 {
+					inner = Value{Kind: Array, Elems: []*Value{&inner1}}
+				} else {
+					inner = Value{Kind: Object, Members: []Member{{Key: m.randKey(v), Val: &inner1}}}
+				}
+			}
+			*v = inner
+		case 4:
+			// Duplicate an element or a member (duplicate keys).
+			switch {
+			case len(v.Members) != 0:
+				mem := v.Members[r.Intn(len(v.Members))]
+				mem.Val = mem.Val.clone()
+				if r.Intn(2) == 0 {
+					mem.Val = m.randValue(mem.Val.Kind)
+				}
+				v.Members = insert(v.Members, r.Intn(len(v.Members)+1), mem)
+			case len(v.Elems) != 0:
+				elem := v.Elems[r.Intn(len(v.Elems))]
+				for n := 1 << uint(r.Intn(6)); n > 0; n-- {
+					v.Elems = append(v.Elems, elem.clone())
+				}
+			default:
+				continue
+			}
+		case 5:
+			// Remove an element or a member.
+			switch {
+			case len(v.Members) != 0:
+				i := r.Intn(len(v.Members))
+				v.Members = append(v.Members[:i], v.Members[i+1:]...)
+			case len(v.Elems) != 0:
+				i := r.Intn(len(v.Elems))
+				v.Elems = append(v.Elems[:i], v.Elems[i+1:]...)
+			default:
+				continue
+			}
+		case 6:
+			// Add a new element or member.
+			switch v.Kind {
+			case Object:
+				mem := Member{Key: m.randKey(v), Val: m.randValue(Null)}
+				v.Members = insert(v.Members, r.Intn(len(v.Members)+1), mem)
+			case Array:
+				elem := m.randValue(Null)
+				if len(v.Elems) != 0 && r.Intn(2) == 0 {
+					// Arrays are usually homogeneous.
+					elem = v.Elems[r.Intn(len(v.Elems))].clone()
+				}
+				pos := r.Intn(len(v.Elems) + 1)
+				v.Elems = append(v.Elems, nil)
+				copy(v.Elems[pos+1:], v.Elems[pos:])
+				v.Elems[pos] = elem
+			default:
+				continue
+			}
+		case 7:
+			// Splice a subtree from a donor, preferably of the same type.
+			if len(donors) == 0 {
+				continue
+			}
+			var cands, same []*Value
+			donors[r.Intn(len(donors))].walk(func(d *Value) {
+				cands = append(cands, d)
+				if d.Kind == v.Kind {
+					same = append(same, d)
+				}
+			})
+			if len(same) != 0 && r.Intn(4) != 0 {
+				cands = same
+			}
+			*v = *cands[r.Intn(len(cands))].clone()
+		case 8:
+			// Change an object key.
+			if len(v.Members) == 0 {
+				continue
+			}
+			v.Members[r.Intn(len(v.Members))].Key = m.randKey(v)
+		case 9:
+			// Swap two elements or members.
+			switch {
+			case len(v.Members) > 1:
+				i, j := r.Intn(len(v.Members)), r.Intn(len(v.Members))
+				v.Members[i], v.Members[j] = v.Members[j], v.Members[i]
+			case len(v.Elems) > 1:
+				i, j := r.Intn(len(v.Elems)), r.Intn(len(v.Elems))
+				v.Elems[i], v.Elems[j] = v.Elems[j], v.Elems[i]
+			default:
+				continue
+			}
+		}
+		return
+	}
+}
+
+func insert(members []Member, pos int, mem Member) []Member {
+	members = append(members, Member{})
+	copy(members[pos+1:], members[pos:])
+	members[pos] = mem
+	return members
+}
+
+// randValue returns a random value, preferably not of kind not.
+func (m *Mutator) randValue(not Kind) *Value {
+	r := m.Rand
+	kind := Kind(r.Intn(int(Object) + 1))
+	if kind == not {
+		kind = Kind(r.Intn(int(Object) + 1))
+	}
+	switch kind {
+	case Null:
+		return &Value{Kind: Null, Text: "null"}
+	case Bool:
+		return &Value{Kind: Bool, Text: []string{"true", "false"}[r.Intn(2)]}
+	case Number:
+		return &Value{Kind: Number, Text: interestingNumbers[r.Intn(len(interestingNumbers))]}
+	case String:
+		return &Value{Kind: String, Text: m.randString()}
+	case Array:
+		return &Value{Kind: Array}
+	default:
+		return &Value{Kind: Object}
+	}
+}
+
+func (m *Mutator) randString() string {
+	r := m.Rand
+	switch {
+	case len(m.Dict) != 0 && r.Intn(2) == 0:
+		return m.Dict[r.Intn(len(m.Dict))]
+	case r.Intn(10) == 0:
+		return strings.Repeat("A", 1<<uint(r.Intn(16)))
+	default:
+		return interestingStrings[r.Intn(len(interestingStrings))]
+	}
+}
+
+// randKey returns a key for a new member of object v:
+// either an existing key of v, or a random string.
+func (m *Mutator) randKey(v *Value) string {
+	if len(v.Members) != 0 && m.Rand.Intn(3) == 0 {
+		return v.Members[m.Rand.Intn(len(v.Members))].Key
+	}
+	return m.randString()
+}
+
+// encode serializes the value with random formatting.
+func (m *Mutator) encode(v *Value) []byte {
+	r := m.Rand
+	e := &encoder{
+		space:     r.Intn(4) == 0,
+		escapeAll: r.Intn(8) == 0,
+	}
+	switch r.Intn(8) {
+	case 0:
+		e.indent = "  "
+	case 1:
+		e.indent = "\t"
+	}
+	e.value(v, 0)
+	if r.Intn(16) == 0 {
+		e.buf = append(e.buf, '\n')
+	}
+	return e.buf
+}
@@ -13,10 +13,12 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/dvyukov/go-fuzz/go-fuzz/internal/pcg"
 	"golang.org/x/tools/go/packages"
 )
 
@@ -28,7 +30,8 @@ import (
 var (
 	flagWorkdir           = flag.String("workdir", ".", "dir with persistent work data")
 	flagProcs             = flag.Int("procs", runtime.NumCPU(), "parallelism level")
-	flagTimeout           = flag.Int("timeout", 10, "test timeout, in seconds")
+	flagTimeout           = durationFlag("timeout", 10*time.Second, "test timeout (duration like 200ms, or integer number of seconds)")
+	flagSlowFactor        = flag.Float64("slowfactor", 100, "report inputs that are that many times slower than corpus average as slow (0 to disable)")
 	flagMinimize          = flag.Duration("minimize", 1*time.Minute, "time limit for input minimization")
 	flagCoordinator       = flag.String("coordinator", "", "coordinator mode (value is coordinator address)")
 	flagWorker            = flag.String("worker", "", "worker mode (value is coordinator address)")
@@ -40,8 +43,25 @@ var (
 	flagTestOutput        = flag.Bool("testoutput", false, "print test binary output to stdout (for debugging only)")
 	flagCoverCounters     = flag.Bool("covercounters", true, "use coverage hit counters")
 	flagSonar             = flag.Bool("sonar", true, "use sonar hints")
+	flagGrammar           = flag.String("grammar", "", "EBNF grammar file, used to generate inputs and mutate their derivation trees")
+	flagJSON              = flag.Bool("json", false, "inputs are JSON, use JSON-aware mutations")
+	flagProtoDesc         = flag.String("protodesc", "", "protobuf descriptor set file, inputs are mutated as -prototype messages")
+	flagProtoType         = flag.String("prototype", "", "fully-qualified protobuf message type of inputs (with -protodesc)")
+	flagCustomMutator     = flag.Float64("custommutator", 0.5, "fraction of fuzzing iterations that use FuzzMutate/FuzzCrossOver functions (if the package has them)")
+	flagResourceFeedback  = flag.Bool("resourcefeedback", false, "use per-edge maxima of exec time and allocated bytes as feedback")
+	flagLeakCheck         = flag.Bool("leakcheck", false, "report inputs that leak goroutines as crashers")
+	flagMemLimit          = flag.Int("memlimit", 0, "limit on heap growth of test binary while running one input, in MB (0 means no limit)")
 	flagV                 = flag.Int("v", 0, "verbosity level")
 	flagHTTP              = flag.String("http", "", "HTTP server listen address (coordinator mode only)")
+	flagGenTest           = flag.String("gentest", "", "write a Go regression test for every new crasher into this dir")
+	flagGen               = flag.String("gen", "", "command line of a generator built with go-fuzz/gen package, its inputs are added to corpus (coordinator mode only)")
+	flagImport            = flag.String("import", "", "import Go native fuzzing corpus dir (testdata/fuzz/FuzzX) into workdir and exit")
+	flagExport            = flag.String("export", "", "export crashers into dir in Go native fuzzing corpus format and exit")
+	flagExportCorpus      = flag.Bool("exportcorpus", false, "export corpus as well as crashers (with -export)")
+	flagNativeArgs        = flag.String("nativeargs", "[]byte", "comma-separated list of Go native fuzz target argument types (for -import/-export)")
+	flagSeed              = flag.Uint64("seed", 0, "seed for random number generators (0 means random seed, unless -deterministic)")
+	flagDeterministic     = flag.Bool("deterministic", false, "reproducible fuzzing with -seed: single proc, no decisions based on wall-clock time")
+	flagSchedule          = flag.String("schedule", "default", "power schedule that decides how often corpus inputs are fuzzed: default, explore, fast, coe or entropy")
 
 	shutdown        uint32
 	shutdownC       = make(chan struct{})
@@ -53,9 +73,45 @@ func main() {
 	if *flagCoordinator != "" && *flagWorker != "" {
 		log.Fatalf("both -coordinator and -worker are specified")
 	}
+	if *flagTimeout <= 0 {
+		log.Fatalf("bad -timeout value %v", *flagTimeout)
+	}
+	if *flagSlowFactor < 0 {
+		log.Fatalf("bad -slowfactor value %v", *flagSlowFactor)
+	}
+	if *flagCustomMutator < 0 || *flagCustomMutator > 1 {
+		log.Fatalf("bad -custommutator value %v, must be in [0, 1]", *flagCustomMutator)
+	}
+	if (*flagProtoDesc == "") != (*flagProtoType == "") {
+		log.Fatalf("-protodesc and -prototype must be used together")
+	}
+	if *flagMemLimit < 0 {
+		log.Fatalf("bad -memlimit value %v", *flagMemLimit)
+	}
 	if *flagHTTP != "" && *flagWorker != "" {
 		log.Fatalf("both -http and -worker are specified")
 	}
+	if *flagGen != "" && *flagWorker != "" {
+		log.Fatalf("both -gen and -worker are specified")
+	}
+	if findSchedule(*flagSchedule) == nil {
+		log.Fatalf("bad -schedule value %v, must be one of default, explore, fast, coe or entropy", *flagSchedule)
+	}
+	if *flagDeterministic {
+		if *flagCoordinator != "" || *flagWorker != "" || *flagGen != "" || *flagResourceFeedback {
+			log.Fatalf("-deterministic is incompatible with -coordinator, -worker, -gen and -resourcefeedback")
+		}
+		*flagProcs = 1
+	}
+	if *flagSeed != 0 || *flagDeterministic {
+		pcg.Seed(*flagSeed)
+	}
+
+	if *flagImport != "" || *flagExport != "" {
+		*flagWorkdir = expandHomeDir(*flagWorkdir)
+		goCorpusMain()
+		return
+	}
 
 	go func() {
 		c := make(chan os.Signal, 1)
@@ -132,3 +188,31 @@ func expandHomeDir(path string) string {
 	}
 	return path
 }
+
+// secondsOrDuration is a flag value that accepts either a duration
+// or an integer number of seconds (for backwards compatibility).
+type secondsOrDuration time.Duration
+
+func durationFlag(name string, value time.Duration, usage string) *time.Duration {
+	p := new(time.Duration)
+	*p = value
+	flag.Var((*secondsOrDuration)(p), name, usage)
+	return p
+}
+
+func (d *secondsOrDuration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *secondsOrDuration) Set(s string) error {
+	if n, err := strconv.Atoi(s); err == nil {
+		*d = secondsOrDuration(time.Duration(n) * time.Second)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = secondsOrDuration(v)
+	return nil
+}
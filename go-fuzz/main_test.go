@@ -0,0 +1,44 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSecondsOrDuration(t *testing.T) {
+	tests := []struct {
+		s   string
+		d   time.Duration
+		err bool
+	}{
+		{s: "10", d: 10 * time.Second},
+		{s: "0", d: 0},
+		{s: "200ms", d: 200 * time.Millisecond},
+		{s: "1m30s", d: 90 * time.Second},
+		{s: "1.5", err: true},
+		{s: "foo", err: true},
+	}
+	for _, test := range tests {
+		var d secondsOrDuration
+		err := d.Set(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: no error", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if time.Duration(d) != test.d {
+			t.Errorf("%q: got %v, want %v", test.s, time.Duration(d), test.d)
+		}
+		if d.String() != test.d.String() {
+			t.Errorf("%q: bad string %q", test.s, d.String())
+		}
+	}
+}
@@ -5,19 +5,89 @@ package main
 
 import (
 	"encoding/binary"
+	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
 	"github.com/dvyukov/go-fuzz/go-fuzz/internal/pcg"
 )
 
+const (
+	// mutationOps is the number of mutation operators in Mutator.mutate.
+	mutationOps = 20
+	// opSchedulePeriod is the number of credited mutations between operator weight updates.
+	// The period is counted in mutations rather than time to keep -deterministic runs reproducible.
+	opSchedulePeriod = 10000
+	// opScheduleTotal is the sum of operator weights.
+	opScheduleTotal = 1 << 16
+	// opSchedulePrior is the number of virtual executions with the mean success rate
+	// added to every operator, so that operators with few executions are not over/under-rated.
+	opSchedulePrior = 1000
+	// opScheduleExplore is the fraction of mutations that choose operators uniformly,
+	// so that currently unsuccessful operators get a chance to recover.
+	opScheduleExplore = 0.25
+	// opScheduleDecay is the factor by which old operator executions are forgotten on every update.
+	opScheduleDecay = 0.9
+)
+
+// mutationOpNames are short names of mutation operators used in statistics.
+var mutationOpNames = [mutationOps]string{
+	"remove", "insert", "duplicate", "copy", "bitflip", "setbyte", "swap",
+	"add8", "add16", "add32", "add64", "int8", "int16", "int32", "digit", "number",
+	"splice", "insertpart", "insertlit", "replacelit",
+}
+
+// MutationStat is execution statistics of a mutation operator.
+type MutationStat struct {
+	Execs uint64 // executed inputs produced with the operator
+	Finds uint64 // executed inputs that gave new coverage
+}
+
+// MutationStats is execution statistics of all mutation operators.
+type MutationStats [mutationOps]MutationStat
+
+func (s *MutationStats) add(s1 *MutationStats) {
+	for i := range s {
+		s[i].Execs += s1[i].Execs
+		s[i].Finds += s1[i].Finds
+	}
+}
+
+// String returns finds/execs of every operator that was executed.
+func (s *MutationStats) String() string {
+	var parts []string
+	for i, st := range s {
+		if st.Execs != 0 {
+			parts = append(parts, fmt.Sprintf("%v=%v/%v", mutationOpNames[i], st.Finds, st.Execs))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Mutator mutates inputs with a set of mutation operators.
+// Operators are chosen adaptively: the worker credits operators applied to every executed input
+// with whether the input gave new coverage, and operators with higher success rate
+// are chosen more frequently.
 type Mutator struct {
 	r *pcg.Rand
+
+	input int // corpus index of the input chosen by the last chooseFuzzInput call, -1 if none
+
+	ops      []int                   // operators applied by the last mutate call
+	weights  [mutationOps]int        // cumulative operator weights
+	recent   [mutationOps][2]float64 // decayed execs and finds of every operator
+	credited int                     // mutations credited since the last weights update
+	stats    MutationStats           // statistics not yet reported to hub
 }
 
 func newMutator() *Mutator {
-	return &Mutator{r: pcg.New()}
+	m := &Mutator{r: pcg.New(), input: -1}
+	for i := range m.weights {
+		m.weights[i] = (i + 1) * (opScheduleTotal / mutationOps)
+	}
+	return m
 }
 
 func (m *Mutator) rand(n int) int {
@@ -37,23 +107,40 @@ func (m *Mutator) randByteOrder() binary.ByteOrder {
 }
 
 func (m *Mutator) generate(ro *ROData) ([]byte, int) {
+	input := m.chooseFuzzInput(ro)
+	return m.mutate(input.data, ro), input.depth + 1
+}
+
+// chooseInput chooses a random corpus input weighted by score.
+func (m *Mutator) chooseInput(ro *ROData) *Input {
+	return &ro.corpus[m.chooseInputIdx(ro)]
+}
+
+// chooseFuzzInput chooses a corpus input to be fuzzed and remembers its index in m.input.
+// Unlike inputs chosen with chooseInput (e.g. splicing donors), it counts as fuzzing of the input.
+func (m *Mutator) chooseFuzzInput(ro *ROData) *Input {
+	m.input = m.chooseInputIdx(ro)
+	return &ro.corpus[m.input]
+}
+
+func (m *Mutator) chooseInputIdx(ro *ROData) int {
 	corpus := ro.corpus
 	scoreSum := corpus[len(corpus)-1].runningScoreSum
 	weightedIdx := m.rand(scoreSum)
-	idx := sort.Search(len(corpus), func(i int) bool {
+	return sort.Search(len(corpus), func(i int) bool {
 		return corpus[i].runningScoreSum > weightedIdx
 	})
-	input := &corpus[idx]
-	return m.mutate(input.data, ro), input.depth + 1
 }
 
 func (m *Mutator) mutate(data []byte, ro *ROData) []byte {
 	corpus := ro.corpus
 	res := make([]byte, len(data))
 	copy(res, data)
+	m.ops = m.ops[:0]
 	nm := 1 + m.r.Exp2()
 	for iter := 0; iter < nm; iter++ {
-		switch m.rand(20) {
+		op := m.chooseOp()
+		switch op {
 		case 0:
 			// Remove a range of bytes.
 			if len(res) <= 1 {
@@ -387,6 +474,8 @@ func (m *Mutator) mutate(data []byte, ro *ROData) []byte {
 			pos := m.rand(len(res) - len(lit))
 			copy(res[pos:], lit)
 		}
+		// Inapplicable operators skip this with continue.
+		m.ops = append(m.ops, op)
 	}
 	if len(res) > MaxInputSize {
 		res = res[:MaxInputSize]
@@ -394,6 +483,63 @@ func (m *Mutator) mutate(data []byte, ro *ROData) []byte {
 	return res
 }
 
+// chooseOp chooses a mutation operator according to the current weights.
+func (m *Mutator) chooseOp() int {
+	x := m.rand(m.weights[mutationOps-1])
+	return sort.Search(mutationOps, func(i int) bool {
+		return m.weights[i] > x
+	})
+}
+
+// credit accounts execution of the input produced by the last mutate call,
+// found says if the input gave new coverage.
+func (m *Mutator) credit(found bool) {
+	var seen uint32 // every operator is credited once per input
+	for _, op := range m.ops {
+		if seen&(1<<uint(op)) != 0 {
+			continue
+		}
+		seen |= 1 << uint(op)
+		m.stats[op].Execs++
+		m.recent[op][0]++
+		if found {
+			m.stats[op].Finds++
+			m.recent[op][1]++
+		}
+	}
+	m.ops = m.ops[:0]
+	m.credited++
+	if m.credited == opSchedulePeriod {
+		m.credited = 0
+		m.updateWeights()
+	}
+}
+
+// updateWeights recalculates operator weights from their recent success rates.
+func (m *Mutator) updateWeights() {
+	var execs, finds float64
+	for _, r := range m.recent {
+		execs += r[0]
+		finds += r[1]
+	}
+	// Operators without executions (e.g. not applicable to the inputs) get the mean rate.
+	mean := (finds + 1) / (execs + 1)
+	var rates [mutationOps]float64
+	var sum float64
+	for i, r := range m.recent {
+		rates[i] = (r[1] + mean*opSchedulePrior) / (r[0] + opSchedulePrior)
+		sum += rates[i]
+	}
+	cum := 0
+	for i := range m.weights {
+		w := (1-opScheduleExplore)*rates[i]/sum + opScheduleExplore/mutationOps
+		cum += int(w*opScheduleTotal) + 1
+		m.weights[i] = cum
+		m.recent[i][0] *= opScheduleDecay
+		m.recent[i][1] *= opScheduleDecay
+	}
+}
+
 // chooseLen chooses length of range mutation.
 // It gives preference to shorter ranges.
 func (m *Mutator) chooseLen(n int) int {
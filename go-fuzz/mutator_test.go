@@ -0,0 +1,79 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dvyukov/go-fuzz/go-fuzz/internal/pcg"
+)
+
+func TestMutatorSchedule(t *testing.T) {
+	m := newMutator()
+	weight := func(op int) int {
+		if op == 0 {
+			return m.weights[0]
+		}
+		return m.weights[op] - m.weights[op-1]
+	}
+	for op := 0; op < mutationOps; op++ {
+		if weight(op) != opScheduleTotal/mutationOps {
+			t.Fatalf("initial weights are not uniform: %v", m.weights)
+		}
+	}
+	// Bit flips are successful 1% of time, everything else never.
+	const good = 4
+	for i := 0; i < 5*opSchedulePeriod; i++ {
+		op := m.chooseOp()
+		// The operator is applied twice, but must be credited once.
+		m.ops = append(m.ops[:0], op, op)
+		m.credit(op == good && m.rand(100) == 0)
+	}
+	for op := 0; op < mutationOps; op++ {
+		if op != good && (weight(op) >= weight(good)/4 || weight(op) == 0) {
+			t.Fatalf("bad weight of operator %v: %v, successful operator: %v", mutationOpNames[op], weight(op), weight(good))
+		}
+	}
+	if m.stats[good].Finds == 0 || m.stats[good].Execs <= m.stats[0].Execs {
+		t.Fatalf("bad stats: %v", &m.stats)
+	}
+}
+
+func TestMutatorSeed(t *testing.T) {
+	ro := &ROData{
+		strLits: [][]byte{[]byte("magic")},
+		intLits: [][]byte{{1, 2, 3, 4}},
+	}
+	sum := 0
+	for i, data := range []string{"", "abcd", "12345678", "{\"key\": 100}", "GIF89a"} {
+		sum += 1 + i
+		ro.corpus = append(ro.corpus, Input{data: []byte(data), score: 1 + i, runningScoreSum: sum})
+	}
+	// generate runs the mutator with the given seed, including operator schedule updates.
+	generate := func(seed uint64) [][]byte {
+		pcg.Seed(seed)
+		m := newMutator()
+		var inputs [][]byte
+		for i := 0; i < 3*opSchedulePeriod; i++ {
+			data, _ := m.generate(ro)
+			m.credit(len(data)%5 == 0)
+			inputs = append(inputs, data)
+		}
+		return inputs
+	}
+	inputs1, inputs2, inputs3 := generate(1), generate(1), generate(2)
+	same := 0
+	for i := range inputs1 {
+		if !bytes.Equal(inputs1[i], inputs2[i]) {
+			t.Fatalf("input #%v differs for the same seed: %q vs %q", i, inputs1[i], inputs2[i])
+		}
+		if bytes.Equal(inputs1[i], inputs3[i]) {
+			same++
+		}
+	}
+	if same == len(inputs1) {
+		t.Fatalf("different seeds produce the same inputs")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // PersistentSet is a set of binary blobs with a persistent mirror on disk.
@@ -48,7 +49,7 @@ func (ps *PersistentSet) readInDir(dir string) {
 			log.Printf("error during dir walk: %v\n", err)
 			return nil
 		}
-		if info.IsDir() {
+		if info.IsDir() || strings.HasSuffix(path, hintSuffix) {
 			return nil
 		}
 		data, err := ioutil.ReadFile(path)
@@ -69,12 +70,25 @@ func (ps *PersistentSet) readInDir(dir string) {
 		if len(name) > hexLen+1 && isHexString(name[:hexLen]) && name[hexLen] == '-' {
 			meta, _ = strconv.ParseUint(name[2*sha1.Size+1:], 10, 64)
 		}
+		if hint, err := ioutil.ReadFile(path + hintSuffix); err == nil {
+			// Priority hint produced by a generator built with go-fuzz/gen package.
+			meta = parseHint(hint)
+		}
 		a := Artifact{data, meta, len(name) < hexLen || !isHexString(name[:hexLen])}
 		ps.m[sig] = a
 		return nil
 	})
 }
 
+// hintSuffix is the suffix of sidecar files with input priority.
+const hintSuffix = ".hint"
+
+// parseHint parses decimal priority hint, invalid hints are ignored.
+func parseHint(hint []byte) uint64 {
+	prio, _ := strconv.ParseUint(strings.TrimSpace(string(hint)), 10, 64)
+	return prio
+}
+
 func persistentFilename(dir string, a Artifact, sig Sig) string {
 	fname := filepath.Join(dir, hex.EncodeToString(sig[:]))
 	if a.meta != 0 {
@@ -0,0 +1,249 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package protomut
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MessageType describes a message type loaded from a descriptor set.
+type MessageType struct {
+	Name   string // fully-qualified name without the leading dot
+	Fields []*FieldDesc
+}
+
+// FieldDesc describes a message field.
+type FieldDesc struct {
+	Name     string
+	Num      int
+	Type     int // descriptor type, one of type* constants
+	Repeated bool
+	Message  *MessageType // for message fields
+	Enum     []uint64     // values of enum fields (as varints)
+	typeName string
+}
+
+// Field types from google/protobuf/descriptor.proto.
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+)
+
+func (t *MessageType) field(num int) *FieldDesc {
+	if t == nil {
+		return nil
+	}
+	for _, f := range t.Fields {
+		if f.Num == num {
+			return f
+		}
+	}
+	return nil
+}
+
+// wireType returns the wire type used to encode the field.
+func (f *FieldDesc) wireType() int {
+	switch f.Type {
+	case typeDouble, typeFixed64, typeSfixed64:
+		return wireFixed64
+	case typeFloat, typeFixed32, typeSfixed32:
+		return wireFixed32
+	case typeString, typeBytes, typeMessage:
+		return wireBytes
+	case typeGroup:
+		return wireGroup
+	default:
+		return wireVarint
+	}
+}
+
+// LoadType loads message type name (like "pkg.Message") from a serialized FileDescriptorSet.
+// All types referenced by the message must be present in the set.
+func LoadType(descSet []byte, name string) (*MessageType, error) {
+	types := make(map[string]*MessageType)
+	enums := make(map[string][]uint64)
+	set, err := Parse(nil, descSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set: %v", err)
+	}
+	for _, file := range set.Fields {
+		// FileDescriptorSet.file = 1
+		if file.Num != 1 || file.Wire != wireBytes {
+			continue
+		}
+		fd, err := Parse(nil, file.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse file descriptor: %v", err)
+		}
+		// FileDescriptorProto.package = 2, message_type = 4, enum_type = 5.
+		pkg := ""
+		for _, f := range fd.Fields {
+			if f.Num == 2 && f.Wire == wireBytes {
+				pkg = string(f.Data)
+			}
+		}
+		for _, f := range fd.Fields {
+			if f.Wire != wireBytes {
+				continue
+			}
+			switch f.Num {
+			case 4:
+				if err := loadMessage(types, enums, pkg, f.Data); err != nil {
+					return nil, err
+				}
+			case 5:
+				if err := loadEnum(enums, pkg, f.Data); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, t := range types {
+		for _, f := range t.Fields {
+			name := strings.TrimPrefix(f.typeName, ".")
+			switch f.Type {
+			case typeMessage, typeGroup:
+				if f.Message = types[name]; f.Message == nil {
+					return nil, fmt.Errorf("type %v of field %v.%v is not present in the descriptor set", name, t.Name, f.Name)
+				}
+			case typeEnum:
+				f.Enum = enums[name]
+			}
+		}
+	}
+	t := types[strings.TrimPrefix(name, ".")]
+	if t == nil {
+		var names []string
+		for name := range types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("message type %v is not present in the descriptor set, available types: %v",
+			name, strings.Join(names, ", "))
+	}
+	return t, nil
+}
+
+// loadMessage loads DescriptorProto and its nested types.
+func loadMessage(types map[string]*MessageType, enums map[string][]uint64, scope string, data []byte) error {
+	msg, err := Parse(nil, data)
+	if err != nil {
+		return fmt.Errorf("failed to parse message descriptor: %v", err)
+	}
+	t := new(MessageType)
+	// DescriptorProto.name = 1, field = 2, nested_type = 3, enum_type = 4.
+	for _, f := range msg.Fields {
+		if f.Num == 1 && f.Wire == wireBytes {
+			t.Name = qualify(scope, string(f.Data))
+		}
+	}
+	types[t.Name] = t
+	for _, f := range msg.Fields {
+		if f.Wire != wireBytes {
+			continue
+		}
+		switch f.Num {
+		case 2:
+			fd, err := loadField(f.Data)
+			if err != nil {
+				return err
+			}
+			t.Fields = append(t.Fields, fd)
+		case 3:
+			if err := loadMessage(types, enums, t.Name, f.Data); err != nil {
+				return err
+			}
+		case 4:
+			if err := loadEnum(enums, t.Name, f.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadField loads FieldDescriptorProto.
+func loadField(data []byte) (*FieldDesc, error) {
+	msg, err := Parse(nil, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse field descriptor: %v", err)
+	}
+	fd := new(FieldDesc)
+	// FieldDescriptorProto.name = 1, number = 3, label = 4, type = 5, type_name = 6.
+	for _, f := range msg.Fields {
+		switch {
+		case f.Num == 1 && f.Wire == wireBytes:
+			fd.Name = string(f.Data)
+		case f.Num == 3 && f.Wire == wireVarint:
+			fd.Num = int(f.Val)
+		case f.Num == 4 && f.Wire == wireVarint:
+			fd.Repeated = f.Val == 3 // LABEL_REPEATED
+		case f.Num == 5 && f.Wire == wireVarint:
+			fd.Type = int(f.Val)
+		case f.Num == 6 && f.Wire == wireBytes:
+			fd.typeName = string(f.Data)
+		}
+	}
+	if fd.Num <= 0 || fd.Type < typeDouble || fd.Type > typeSint64 {
+		return nil, fmt.Errorf("bad field descriptor %v: number %v, type %v", fd.Name, fd.Num, fd.Type)
+	}
+	return fd, nil
+}
+
+// loadEnum loads values of EnumDescriptorProto.
+func loadEnum(enums map[string][]uint64, scope string, data []byte) error {
+	msg, err := Parse(nil, data)
+	if err != nil {
+		return fmt.Errorf("failed to parse enum descriptor: %v", err)
+	}
+	// EnumDescriptorProto.name = 1, value = 2; EnumValueDescriptorProto.number = 2.
+	var name string
+	var vals []uint64
+	for _, f := range msg.Fields {
+		if f.Num == 1 && f.Wire == wireBytes {
+			name = qualify(scope, string(f.Data))
+		}
+		if f.Num == 2 && f.Wire == wireBytes {
+			val, err := Parse(nil, f.Data)
+			if err != nil {
+				return fmt.Errorf("failed to parse enum value descriptor: %v", err)
+			}
+			var v uint64
+			for _, vf := range val.Fields {
+				if vf.Num == 2 && vf.Wire == wireVarint {
+					// Negative values are encoded sign-extended to 64 bits.
+					v = uint64(int64(int32(vf.Val)))
+				}
+			}
+			vals = append(vals, v)
+		}
+	}
+	enums[name] = vals
+	return nil
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
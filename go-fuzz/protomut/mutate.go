@@ -0,0 +1,218 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package protomut
+
+// Rand is the source of randomness for mutations.
+type Rand interface {
+	Intn(n int) int
+}
+
+// Mutator mutates serialized messages of a single type.
+type Mutator struct {
+	Type *MessageType
+	Rand Rand
+	// MutateBytes, if set, is used to mutate contents of string and bytes fields.
+	MutateBytes func(data []byte) []byte
+}
+
+var interestingVarints = []uint64{
+	0, 1, 2, 0x7f, 0x80, 0xff, 0x100, 0x3fff, 0x4000, 0x7fff, 0x8000, 0xffff,
+	0x7fffffff, 0x80000000, 0xffffffff, 1<<63 - 1, 1 << 63, 1<<64 - 1,
+}
+
+// Mutate parses data as a message of m.Type, applies a few field-level mutations
+// and returns the serialized result. Sub-messages can be swapped with
+// sub-messages of the same type from donors (serialized messages of m.Type).
+// It returns false if data is not a valid serialized message.
+func (m *Mutator) Mutate(data []byte, donors [][]byte) ([]byte, bool) {
+	msg, err := Parse(m.Type, data)
+	if err != nil {
+		return nil, false
+	}
+	var donorMsgs []*Message
+	for _, d := range donors {
+		if dm, err := Parse(m.Type, d); err == nil {
+			donorMsgs = append(donorMsgs, dm)
+		}
+	}
+	msg = msg.clone()
+	for iter := 0; iter == 0 || m.Rand.Intn(2) == 0; iter++ {
+		m.mutate(msg, donorMsgs)
+	}
+	return msg.Marshal(), true
+}
+
+func (m *Mutator) mutate(root *Message, donors []*Message) {
+	// Choose a random (sub-)message to mutate.
+	var msgs []*Message
+	root.walk(func(msg *Message) {
+		msgs = append(msgs, msg)
+	})
+	msg := msgs[m.Rand.Intn(len(msgs))]
+	r := m.Rand
+	for tries := 0; tries < 10; tries++ {
+		switch r.Intn(7) {
+		case 0:
+			// Add a new field.
+			if msg.Type == nil || len(msg.Type.Fields) == 0 {
+				continue
+			}
+			fd := msg.Type.Fields[r.Intn(len(msg.Type.Fields))]
+			if fd.Type == typeGroup {
+				continue
+			}
+			f := m.newField(fd, 0)
+			pos := r.Intn(len(msg.Fields) + 1)
+			msg.Fields = append(msg.Fields, Field{})
+			copy(msg.Fields[pos+1:], msg.Fields[pos:])
+			msg.Fields[pos] = f
+		case 1:
+			// Remove a field.
+			if len(msg.Fields) == 0 {
+				continue
+			}
+			pos := r.Intn(len(msg.Fields))
+			msg.Fields = append(msg.Fields[:pos], msg.Fields[pos+1:]...)
+		case 2:
+			// Repeat a field.
+			if len(msg.Fields) == 0 {
+				continue
+			}
+			f := msg.Fields[r.Intn(len(msg.Fields))]
+			if f.Msg != nil {
+				f.Msg = f.Msg.clone()
+			}
+			for n := 1 + r.Intn(3); n > 0; n-- {
+				msg.Fields = append(msg.Fields, f)
+			}
+		case 3:
+			// Swap two fields.
+			if len(msg.Fields) < 2 {
+				continue
+			}
+			i, j := r.Intn(len(msg.Fields)), r.Intn(len(msg.Fields))
+			msg.Fields[i], msg.Fields[j] = msg.Fields[j], msg.Fields[i]
+		case 4:
+			// Change a scalar value.
+			if len(msg.Fields) == 0 {
+				continue
+			}
+			f := &msg.Fields[r.Intn(len(msg.Fields))]
+			if f.Msg != nil {
+				continue
+			}
+			if f.Wire == wireBytes {
+				f.Data = m.mutateBytes(f.Data)
+			} else {
+				f.Val = m.mutateValue(msg.Type.field(f.Num), f.Val)
+			}
+		case 5:
+			// Replace a sub-message with a sub-message of the same type from a donor.
+			var fields []*Field
+			for i := range msg.Fields {
+				if msg.Fields[i].Msg != nil && msg.Fields[i].Msg.Type != nil {
+					fields = append(fields, &msg.Fields[i])
+				}
+			}
+			if len(fields) == 0 || len(donors) == 0 {
+				continue
+			}
+			f := fields[r.Intn(len(fields))]
+			var cands []*Message
+			for _, d := range donors {
+				d.walk(func(dm *Message) {
+					if dm.Type == f.Msg.Type && dm != d {
+						cands = append(cands, dm)
+					}
+				})
+			}
+			if len(cands) == 0 {
+				continue
+			}
+			f.Msg = cands[r.Intn(len(cands))].clone()
+		case 6:
+			// Change type of a field to another field of the message,
+			// this is a cheap way to get unexpected wire types.
+			if len(msg.Fields) == 0 || msg.Type == nil || len(msg.Type.Fields) == 0 {
+				continue
+			}
+			f := &msg.Fields[r.Intn(len(msg.Fields))]
+			f.Num = msg.Type.Fields[r.Intn(len(msg.Type.Fields))].Num
+		}
+		return
+	}
+}
+
+// newField creates a new random field for descriptor fd.
+func (m *Mutator) newField(fd *FieldDesc, depth int) Field {
+	r := m.Rand
+	f := Field{Num: fd.Num, Wire: fd.wireType()}
+	switch {
+	case fd.Type == typeMessage:
+		f.Msg = &Message{Type: fd.Message}
+		// Populate a few fields of the new sub-message.
+		for n := r.Intn(3); n > 0 && depth < 3 && len(fd.Message.Fields) != 0; n-- {
+			sub := fd.Message.Fields[r.Intn(len(fd.Message.Fields))]
+			if sub.Type != typeGroup {
+				f.Msg.Fields = append(f.Msg.Fields, m.newField(sub, depth+1))
+			}
+		}
+	case f.Wire == wireBytes:
+		f.Data = make([]byte, r.Intn(16))
+		for i := range f.Data {
+			if fd.Type == typeString {
+				f.Data[i] = byte(' ' + r.Intn(0x7f-' '))
+			} else {
+				f.Data[i] = byte(r.Intn(256))
+			}
+		}
+	default:
+		f.Val = m.mutateValue(fd, 0)
+	}
+	return f
+}
+
+// mutateValue returns a new value for a varint or fixed field.
+func (m *Mutator) mutateValue(fd *FieldDesc, v uint64) uint64 {
+	r := m.Rand
+	if fd != nil {
+		switch fd.Type {
+		case typeBool:
+			return v ^ 1
+		case typeEnum:
+			if len(fd.Enum) != 0 && r.Intn(4) != 0 {
+				return fd.Enum[r.Intn(len(fd.Enum))]
+			}
+		}
+	}
+	switch r.Intn(4) {
+	case 0:
+		return interestingVarints[r.Intn(len(interestingVarints))]
+	case 1:
+		return v + uint64(r.Intn(33)) - 16
+	case 2:
+		return v ^ 1<<uint(r.Intn(64))
+	default:
+		return uint64(r.Intn(1 << 30))
+	}
+}
+
+func (m *Mutator) mutateBytes(data []byte) []byte {
+	if m.MutateBytes != nil {
+		return m.MutateBytes(data)
+	}
+	r := m.Rand
+	data = append([]byte(nil), data...)
+	switch {
+	case len(data) == 0 || r.Intn(3) == 0:
+		pos := r.Intn(len(data) + 1)
+		data = append(data[:pos], append([]byte{byte(r.Intn(256))}, data[pos:]...)...)
+	case r.Intn(2) == 0:
+		pos := r.Intn(len(data))
+		data = append(data[:pos], data[pos+1:]...)
+	default:
+		data[r.Intn(len(data))] ^= byte(1 << uint(r.Intn(8)))
+	}
+	return data
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package protomut
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func bytesField(num int, data []byte) Field {
+	return Field{Num: num, Wire: wireBytes, Data: data}
+}
+
+func varintField(num int, v uint64) Field {
+	return Field{Num: num, Wire: wireVarint, Val: v}
+}
+
+func msgBytes(fields ...Field) []byte {
+	return (&Message{Fields: fields}).Marshal()
+}
+
+func fieldDesc(name string, num, label, typ int, typeName string) Field {
+	fields := []Field{
+		bytesField(1, []byte(name)),
+		varintField(3, uint64(num)),
+		varintField(4, uint64(label)),
+		varintField(5, uint64(typ)),
+	}
+	if typeName != "" {
+		fields = append(fields, bytesField(6, []byte(typeName)))
+	}
+	return bytesField(2, msgBytes(fields...))
+}
+
+// testDescSet returns descriptor set for:
+//
+//	package test;
+//	message Outer {
+//		int32 id = 1;
+//		string name = 2;
+//		repeated Inner items = 3;
+//		Kind kind = 4;
+//		message Inner {
+//			bytes data = 1;
+//			fixed64 x = 2;
+//			Outer next = 3;
+//		}
+//	}
+//	enum Kind { A = 0; B = 1; C = -1; }
+func testDescSet() []byte {
+	inner := msgBytes(
+		bytesField(1, []byte("Inner")),
+		fieldDesc("data", 1, 1, typeBytes, ""),
+		fieldDesc("x", 2, 1, typeFixed64, ""),
+		fieldDesc("next", 3, 1, typeMessage, ".test.Outer"),
+	)
+	outer := msgBytes(
+		bytesField(1, []byte("Outer")),
+		fieldDesc("id", 1, 1, typeInt32, ""),
+		fieldDesc("name", 2, 1, typeString, ""),
+		fieldDesc("items", 3, 3, typeMessage, ".test.Outer.Inner"),
+		fieldDesc("kind", 4, 1, typeEnum, ".test.Kind"),
+		bytesField(3, inner),
+	)
+	enum := msgBytes(
+		bytesField(1, []byte("Kind")),
+		bytesField(2, msgBytes(bytesField(1, []byte("A")), varintField(2, 0))),
+		bytesField(2, msgBytes(bytesField(1, []byte("B")), varintField(2, 1))),
+		bytesField(2, msgBytes(bytesField(1, []byte("C")), varintField(2, 0xffffffffffffffff))),
+	)
+	file := msgBytes(
+		bytesField(1, []byte("test.proto")),
+		bytesField(2, []byte("test")),
+		bytesField(4, outer),
+		bytesField(5, enum),
+	)
+	return msgBytes(bytesField(1, file))
+}
+
+func TestLoadType(t *testing.T) {
+	typ, err := LoadType(testDescSet(), "test.Outer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ.Name != "test.Outer" || len(typ.Fields) != 4 {
+		t.Fatalf("bad type: %+v", typ)
+	}
+	items := typ.field(3)
+	if !items.Repeated || items.Message == nil || items.Message.Name != "test.Outer.Inner" {
+		t.Fatalf("bad items field: %+v", items)
+	}
+	if items.Message.field(3).Message != typ {
+		t.Fatalf("recursive reference is not resolved")
+	}
+	if kind := typ.field(4); len(kind.Enum) != 3 || kind.Enum[2] != 0xffffffffffffffff {
+		t.Fatalf("bad enum values: %v", kind.Enum)
+	}
+	if _, err := LoadType(testDescSet(), ".test.Outer.Inner"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadType(testDescSet(), "test.Foo"); err == nil || !strings.Contains(err.Error(), "test.Outer.Inner") {
+		t.Fatalf("unexpected error for missing type: %v", err)
+	}
+}
+
+func TestParseMarshal(t *testing.T) {
+	typ, err := LoadType(testDescSet(), "test.Outer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := msgBytes(
+		varintField(1, 42),
+		bytesField(2, []byte("foo")),
+		bytesField(3, msgBytes(bytesField(1, []byte{1, 2, 3}), Field{Num: 2, Wire: wireFixed64, Val: 1 << 40})),
+		bytesField(3, []byte{0xff}), // not a valid message, kept as bytes
+		varintField(4, 1),
+		Field{Num: 100, Wire: wireFixed32, Val: 7}, // unknown field
+	)
+	msg, err := Parse(typ, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Fields) != 6 || msg.Fields[2].Msg == nil || msg.Fields[3].Msg != nil {
+		t.Fatalf("bad parsed message: %+v", msg)
+	}
+	if got := msg.Marshal(); !bytes.Equal(got, data) {
+		t.Fatalf("marshal does not round-trip:\ngot:  %x\nwant: %x", got, data)
+	}
+	for _, bad := range [][]byte{{0x08}, {0x12, 0x05, 'a'}, {0x0b}, {0x00, 0x00}} {
+		if _, err := Parse(typ, bad); err == nil {
+			t.Errorf("parsed bad input %x", bad)
+		}
+	}
+}
+
+func TestMutate(t *testing.T) {
+	typ, err := LoadType(testDescSet(), "test.Outer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Mutator{Type: typ, Rand: rand.New(rand.NewSource(0))}
+	corpus := [][]byte{nil}
+	changed := 0
+	for i := 0; i < 1000; i++ {
+		data := corpus[m.Rand.Intn(len(corpus))]
+		res, ok := m.Mutate(data, corpus)
+		if !ok {
+			t.Fatalf("failed to mutate valid input %x", data)
+		}
+		if _, err := Parse(typ, res); err != nil {
+			t.Fatalf("mutated input %x is not valid: %v", res, err)
+		}
+		if !bytes.Equal(res, data) {
+			changed++
+		}
+		if len(res) < 1000 {
+			corpus = append(corpus, res)
+		}
+	}
+	if changed < 500 {
+		t.Fatalf("only %v mutations changed input", changed)
+	}
+	if _, ok := m.Mutate([]byte{0x0b}, nil); ok {
+		t.Fatalf("mutated invalid input")
+	}
+}
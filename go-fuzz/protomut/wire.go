@@ -0,0 +1,165 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package protomut implements structure-aware mutations of serialized protobuf messages.
+//
+// Message types are loaded from a descriptor set file (as produced by
+// protoc --descriptor_set_out --include_imports). Inputs are parsed into
+// a tree of fields, mutated on the field level and serialized back.
+// Fields that are not described in the descriptor are preserved as is.
+package protomut
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireGroup   = 3
+	wireEnd     = 4
+	wireFixed32 = 5
+)
+
+var (
+	errTruncated = errors.New("truncated message")
+	errWireType  = errors.New("unsupported wire type")
+)
+
+// Message is a parsed protobuf message.
+// Fields are kept in the wire order, repeated fields are represented by several entries.
+type Message struct {
+	Type   *MessageType // nil if the type is unknown
+	Fields []Field
+}
+
+// Field is a single field entry of a message.
+type Field struct {
+	Num  int
+	Wire int
+	Val  uint64   // value of varint and fixed fields
+	Data []byte   // contents of length-delimited fields that are not parsed as messages
+	Msg  *Message // parsed contents of message fields
+}
+
+// Parse parses data as a message of type t.
+// Message fields that fail to parse are kept as raw bytes.
+func Parse(t *MessageType, data []byte) (*Message, error) {
+	return parse(t, data, 0)
+}
+
+// maxNesting bounds recursion on deeply nested (or malicious) inputs.
+const maxNesting = 64
+
+func parse(t *MessageType, data []byte, depth int) (*Message, error) {
+	m := &Message{Type: t}
+	for len(data) != 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		data = data[n:]
+		f := Field{Num: int(key >> 3), Wire: int(key & 7)}
+		if f.Num <= 0 {
+			return nil, errors.New("bad field number")
+		}
+		switch f.Wire {
+		case wireVarint:
+			if f.Val, n = binary.Uvarint(data); n <= 0 {
+				return nil, errTruncated
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, errTruncated
+			}
+			f.Val = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, errTruncated
+			}
+			f.Val = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, errTruncated
+			}
+			f.Data = data[n : n+int(size)]
+			data = data[n+int(size):]
+			if fd := t.field(f.Num); fd != nil && fd.Message != nil && depth < maxNesting {
+				if msg, err := parse(fd.Message, f.Data, depth+1); err == nil {
+					f.Msg = msg
+					f.Data = nil
+				}
+			}
+		default:
+			return nil, errWireType
+		}
+		m.Fields = append(m.Fields, f)
+	}
+	return m, nil
+}
+
+// Marshal serializes the message.
+func (m *Message) Marshal() []byte {
+	return m.appendTo(nil)
+}
+
+func (m *Message) appendTo(buf []byte) []byte {
+	for _, f := range m.Fields {
+		buf = appendVarint(buf, uint64(f.Num)<<3|uint64(f.Wire))
+		switch f.Wire {
+		case wireVarint:
+			buf = appendVarint(buf, f.Val)
+		case wireFixed64:
+			var tmp [8]byte
+			binary.LittleEndian.PutUint64(tmp[:], f.Val)
+			buf = append(buf, tmp[:]...)
+		case wireFixed32:
+			var tmp [4]byte
+			binary.LittleEndian.PutUint32(tmp[:], uint32(f.Val))
+			buf = append(buf, tmp[:]...)
+		case wireBytes:
+			data := f.Data
+			if f.Msg != nil {
+				data = f.Msg.Marshal()
+			}
+			buf = appendVarint(buf, uint64(len(data)))
+			buf = append(buf, data...)
+		}
+	}
+	return buf
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+// clone returns a deep copy of the message structure (but not of the raw bytes).
+func (m *Message) clone() *Message {
+	m1 := &Message{Type: m.Type, Fields: make([]Field, len(m.Fields))}
+	for i, f := range m.Fields {
+		if f.Msg != nil {
+			f.Msg = f.Msg.clone()
+		}
+		m1.Fields[i] = f
+	}
+	return m1
+}
+
+// walk calls fn for the message and all its parsed sub-messages.
+func (m *Message) walk(fn func(m *Message)) {
+	fn(m)
+	for _, f := range m.Fields {
+		if f.Msg != nil {
+			f.Msg.walk(fn)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+func TestResources(t *testing.T) {
+	r := newResources()
+	cover := make([]byte, CoverSize)
+	cover[1] = 1
+	cover[2] = 3
+	if r.improves(cover, 100, 0) {
+		t.Fatalf("sub-microsecond exec time improves resources")
+	}
+	if !r.improves(cover, 10000, 100) {
+		t.Fatalf("input does not improve empty resources")
+	}
+	r.update(cover, 10000, 100)
+	if r.improves(cover, 12000, 120) {
+		t.Fatalf("input in the same buckets improves resources")
+	}
+	if !r.holdsMax(cover, 12000, 0) {
+		t.Fatalf("input in the max bucket does not hold max")
+	}
+	if !r.improves(cover, 10000, 1000) {
+		t.Fatalf("input with more allocations does not improve resources")
+	}
+	other := make([]byte, CoverSize)
+	other[3] = 1
+	if !r.improves(other, 2000, 0) {
+		t.Fatalf("input with resources on a new edge does not improve resources")
+	}
+	if r.holdsMax(other, 2000, 100) {
+		t.Fatalf("input on a new edge holds max")
+	}
+}
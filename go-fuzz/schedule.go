@@ -0,0 +1,170 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// scheduleRound is the number of mutations of an input that make one fuzzing round
+	// (an analog of one fuzzing of a queue entry in AFL), rounds are used by explore, fast and coe schedules.
+	scheduleRound = 1000
+	// maxScheduleRounds limits exponential growth of energy in fast and coe schedules.
+	maxScheduleRounds = 16
+	// edgeSampleRate is the rate of executions that contribute to per-edge hit counts
+	// (scanning coverage of every execution is too expensive).
+	edgeSampleRate = 8
+	// rareEdgeHits is the number of sampled hits below which an edge is rare for the entropy schedule.
+	rareEdgeHits = 256
+	// dynamicScorePeriod is the number of refreshScores calls after which scores of schedules
+	// that depend on fuzzing progress are recalculated even if the corpus has not changed.
+	dynamicScorePeriod = 10
+)
+
+// Schedule is a power schedule: it decides how often corpus inputs are chosen for fuzzing
+// by multiplying their base scores (based on exec time, cover size, depth and Fuzz result).
+// Scores of inputs that are not favored (not needed for full corpus coverage) are minimal
+// with any schedule.
+type Schedule struct {
+	name    string
+	edges   bool // uses sampled per-edge hit counts
+	species bool // uses sampled hits of rare edges by mutants of every input
+	// energy returns score multiplier for corpus input idx, nil means 1 for all inputs.
+	energy func(s *scheduleState, idx int, inp *Input) float64
+}
+
+var schedules = []*Schedule{
+	// The classic go-fuzz schedule: base scores only.
+	{name: "default"},
+	// AFLFast-style schedules: f(i) is the number of sampled executions that hit the rarest edge
+	// of input i (an approximation of frequency of its path), s(i) is the number of rounds it was fuzzed.
+	// explore spreads fuzzing evenly: energy decreases as the input is fuzzed.
+	{name: "explore", energy: func(s *scheduleState, idx int, inp *Input) float64 {
+		return scheduleRound / float64(scheduleRound+inp.fuzzed)
+	}},
+	// fast: 2^s(i) / f(i), inputs on rare paths get exponentially more energy
+	// until their paths become frequent.
+	{name: "fast", edges: true, energy: func(s *scheduleState, idx int, inp *Input) float64 {
+		return rounds(inp) * s.meanFreq / float64(s.freq[idx])
+	}},
+	// coe (cut-off exponential): 2^s(i), but inputs on paths more frequent than average are not fuzzed.
+	{name: "coe", edges: true, energy: func(s *scheduleState, idx int, inp *Input) float64 {
+		if float64(s.freq[idx]) > s.meanFreq {
+			return 0
+		}
+		return rounds(inp)
+	}},
+	// entropy (similar to libFuzzer's Entropic): inputs whose mutants hit more diverse
+	// rare edges have higher chances to discover new edges, new inputs get maximal energy.
+	{name: "entropy", edges: true, species: true, energy: func(s *scheduleState, idx int, inp *Input) float64 {
+		if s.meanEntropy == 0 {
+			return 1
+		}
+		return s.entropy[idx] / s.meanEntropy
+	}},
+}
+
+func findSchedule(name string) *Schedule {
+	for _, s := range schedules {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// rounds returns 2^s(i) for input inp.
+func rounds(inp *Input) float64 {
+	s := inp.fuzzed / scheduleRound
+	if s > maxScheduleRounds {
+		s = maxScheduleRounds
+	}
+	return float64(uint64(1) << s)
+}
+
+// scheduleState is corpus-wide data used by schedules to calculate energy of inputs.
+type scheduleState struct {
+	freq        []uint64  // sampled hits of the rarest edge of every input (at least 1)
+	meanFreq    float64   // mean of freq
+	entropy     []float64 // entropy of rare edge hits by mutants of every input
+	meanEntropy float64   // mean of entropy
+}
+
+// newScheduleState calculates schedule data for the corpus.
+// edgeHits are sampled per-edge hits (with sched.edges), species are sampled hits
+// of rare edges by mutants of every corpus input (with sched.species).
+func newScheduleState(sched *Schedule, corpus []Input, corpusCover []byte, edgeHits []uint64, species []map[int]uint32) *scheduleState {
+	s := new(scheduleState)
+	if sched.edges {
+		s.freq = make([]uint64, len(corpus))
+		sum := 0.0
+		for idx, inp := range corpus {
+			f := uint64(math.MaxUint64)
+			for e, c := range inp.cover {
+				if c != 0 && edgeHits[e] < f {
+					f = edgeHits[e]
+				}
+			}
+			if f == 0 || f == math.MaxUint64 {
+				f = 1
+			}
+			s.freq[idx] = f
+			sum += float64(f)
+		}
+		s.meanFreq = sum / float64(len(corpus))
+	}
+	if sched.species {
+		rare := 0
+		for e, c := range corpusCover {
+			if c != 0 && edgeHits[e] < rareEdgeHits {
+				rare++
+			}
+		}
+		s.entropy = make([]float64, len(corpus))
+		sum := 0.0
+		var counts []uint32
+		for idx := range corpus {
+			counts = counts[:0]
+			if idx < len(species) {
+				for e, c := range species[idx] {
+					if edgeHits[e] >= rareEdgeHits {
+						// The edge is not rare anymore.
+						delete(species[idx], e)
+						continue
+					}
+					counts = append(counts, c)
+				}
+			}
+			s.entropy[idx] = entropy(counts, rare-len(counts))
+			sum += s.entropy[idx]
+		}
+		s.meanEntropy = sum / float64(len(corpus))
+	}
+	return s
+}
+
+// entropy estimates Shannon entropy of distribution of rare edges hit by mutants of an input
+// from hit counts of observed edges, unseen is the number of rare edges that were not hit.
+// All counts are Laplace-smoothed (incremented by 1), so inputs with few observations
+// get high entropy.
+func entropy(counts []uint32, unseen int) float64 {
+	if unseen < 0 {
+		unseen = 0
+	}
+	// Sort to sum in a fixed order, -deterministic runs must produce the same scores.
+	sort.Slice(counts, func(i, j int) bool { return counts[i] < counts[j] })
+	total := float64(unseen)
+	sum := 0.0
+	for _, c := range counts {
+		n := float64(c) + 1
+		total += n
+		sum += n * math.Log(n)
+	}
+	if total == 0 {
+		return 0
+	}
+	return math.Log(total) - sum/total
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+func TestEntropy(t *testing.T) {
+	fresh := entropy(nil, 10)
+	uniform := entropy([]uint32{5, 5, 5, 5}, 6)
+	skewed := entropy([]uint32{100, 1, 1, 1}, 6)
+	exhausted := entropy([]uint32{100, 100, 100, 100}, 0)
+	if !(fresh > uniform && uniform > skewed && uniform > exhausted) {
+		t.Fatalf("bad entropy order: fresh=%v uniform=%v skewed=%v exhausted=%v", fresh, uniform, skewed, exhausted)
+	}
+	if e := entropy(nil, 0); e != 0 {
+		t.Fatalf("entropy without rare edges: %v", e)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	// Input 0 covers a frequent path, input 1 covers a rare edge.
+	corpus := make([]Input, 2)
+	corpusCover := make([]byte, CoverSize)
+	edgeHits := make([]uint64, CoverSize)
+	for i := range corpus {
+		corpus[i].cover = make([]byte, CoverSize)
+		corpus[i].cover[0] = 1
+		corpusCover[0] = 1
+	}
+	edgeHits[0] = 1000
+	corpus[1].cover[1] = 1
+	corpusCover[1] = 1
+	edgeHits[1] = 10
+	corpus[0].fuzzed = 2 * scheduleRound
+	corpus[1].fuzzed = 2 * scheduleRound
+	// Mutants of input 0 hit only one rare edge, mutants of input 1 hit several.
+	species := []map[int]uint32{
+		{1: 50},
+		{1: 10, 2: 10, 3: 10},
+	}
+	energy := func(name string, idx int) float64 {
+		sched := findSchedule(name)
+		s := newScheduleState(sched, corpus, corpusCover, edgeHits, species)
+		return sched.energy(s, idx, &corpus[idx])
+	}
+	for _, name := range []string{"fast", "coe", "entropy"} {
+		if e0, e1 := energy(name, 0), energy(name, 1); e0 >= e1 {
+			t.Errorf("%v: frequent input energy %v >= rare input energy %v", name, e0, e1)
+		}
+	}
+	if e := energy("coe", 0); e != 0 {
+		t.Errorf("coe: input with a frequent path is fuzzed: %v", e)
+	}
+	corpus[1].fuzzed = 0
+	if e0, e1 := energy("explore", 0), energy("explore", 1); e0 >= e1 {
+		t.Errorf("explore: fuzzed input energy %v >= fresh input energy %v", e0, e1)
+	}
+	if findSchedule("default").energy != nil || findSchedule("foo") != nil {
+		t.Errorf("bad schedule lookup")
+	}
+}
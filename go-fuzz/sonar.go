@@ -17,13 +17,15 @@ import (
 )
 
 type SonarSite struct {
-	id  int    // unique site id (const)
-	loc string // file:line.pos,line.pos (const)
+	id     int    // unique site id (const)
+	loc    string // file:line.pos,line.pos (const)
+	mapKey bool   // site reports map keys in random order (const)
 	sync.Mutex
-	dynamic    bool   // both operands are not constant
-	takenFuzz  [2]int // number of times condition evaluated to false/true during fuzzing
-	takenTotal [2]int // number of times condition evaluated to false/true in total
-	val        [2][]byte
+	dynamic       bool   // both operands are not constant
+	takenFuzz     [2]int // number of times condition evaluated to false/true during fuzzing
+	takenTotal    [2]int // number of times condition evaluated to false/true in total
+	val           [2][]byte
+	checksumTries int // number of times we looked for checksums for this site
 }
 
 type SonarSample struct {
@@ -35,14 +37,14 @@ type SonarSample struct {
 func (w *Worker) parseSonarData(sonar []byte) (res []SonarSample) {
 	ro := w.hub.ro.Load().(*ROData)
 	sonar = makeCopy(sonar)
-	for len(sonar) > SonarHdrLen {
+	for len(sonar) >= SonarHdrLen {
 		id := binary.LittleEndian.Uint32(sonar)
 		flags := byte(id)
 		id >>= 8
-		n1 := sonar[4]
-		n2 := sonar[5]
+		n1 := int(binary.LittleEndian.Uint16(sonar[4:]))
+		n2 := int(binary.LittleEndian.Uint16(sonar[6:]))
 		sonar = sonar[SonarHdrLen:]
-		if n1 > SonarMaxLen || n2 > SonarMaxLen || len(sonar) < int(n1)+int(n2) {
+		if n1 > SonarMaxLen || n2 > SonarMaxLen || len(sonar) < n1+n2 {
 			log.Fatalf("corrupted sonar data: hdr=[%v/%v/%v] data=%v", flags, n1, n2, len(sonar))
 		}
 		v1 := makeCopy(sonar[:n1])
@@ -94,6 +96,10 @@ func (w *Worker) processSonarData(data, sonar []byte, depth int, smash bool) {
 		// Either ignore them or handle differently (e.g. alter a string length).
 
 		site := sam.site
+		if site.mapKey && *flagDeterministic {
+			// Reported keys depend on map iteration order.
+			continue
+		}
 		flags := sam.flags
 		v1 := sam.val[0]
 		v2 := sam.val[1]
@@ -107,13 +113,17 @@ func (w *Worker) processSonarData(data, sonar []byte, depth int, smash bool) {
 		if skip {
 			continue
 		}
+		if flags&(SonarConst1|SonarConst2|SonarString) == 0 {
+			// Comparison of two computed values can be a checksum verification.
+			w.noteChecksums(site, data, v1, v2, depth)
+		}
 		if smash && bytes.Equal(v1, v2) {
 			// We systematically mutate all bytes during smashing,
 			// no point in trying to break equality here.
 			continue
 		}
 		testInput := func(tmp []byte) {
-			w.testInput(tmp, depth+1, execSonarHint)
+			w.testInput(w.fixChecksums(ro, tmp), depth+1, execSonarHint)
 		}
 		check := func(indexdata, v1, v2 []byte) {
 			if len(v1) == 0 || bytes.Equal(v1, v2) || !bytes.Contains(indexdata, v1) {
@@ -157,10 +167,24 @@ func (w *Worker) processSonarData(data, sonar []byte, depth int, smash bool) {
 				}
 			}
 		}
+		// checkPrefix handles partial matches of long strings (see sonarPrefixLen).
+		checkPrefix := func(v1, v2 []byte) {
+			p := sonarPrefixLen(data, v1, v2)
+			if p == 0 {
+				return
+			}
+			vv := string(v2) + "\t|\tprefix"
+			if _, ok := checked[vv]; ok {
+				return
+			}
+			checked[vv] = struct{}{}
+			sonarPrefixHints(data, v1[:p], v2[p:], testInput)
+		}
 		check1 := func(v1, v2 []byte) {
 			check(data, v1, v2)
 			// TODO: for strings check upper/lower case.
 			if flags&SonarString != 0 {
+				checkPrefix(v1, v2)
 				if bytes.Equal(v1, bytes.ToLower(v1)) && bytes.Equal(v2, bytes.ToLower(v2)) {
 					if lower := bytes.ToLower(data); len(lower) == len(data) {
 						check(lower, v1, v2)
@@ -250,6 +274,48 @@ func (w *Worker) processSonarData(data, sonar []byte, depth int, smash bool) {
 
 var dumpMu sync.Mutex
 
+// sonarPrefixLen returns length of the common prefix of string operands v1 and v2
+// if data contains the prefix, but not the whole v1 (e.g. v1 is only a window
+// of the compared string, or the string is transformed), so that the prefix
+// can be completed with the rest of v2. It returns 0 otherwise.
+func sonarPrefixLen(data, v1, v2 []byte) int {
+	const minPrefix = 4
+	p := 0
+	for p < len(v1) && p < len(v2) && v1[p] == v2[p] {
+		p++
+	}
+	if p < minPrefix || p == len(v2) || len(data)+len(v2) > MaxInputSize ||
+		bytes.Contains(data, v1) || !bytes.Contains(data, v1[:p]) {
+		return 0
+	}
+	return p
+}
+
+// sonarPrefixHints calls fn for inputs produced from data by completing
+// every occurrence of prefix with rest (both overwriting and inserting).
+func sonarPrefixHints(data, prefix, rest []byte, fn func([]byte)) {
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], prefix)
+		if i == -1 {
+			break
+		}
+		i += pos + len(prefix)
+		pos = i
+		// Overwrite bytes after the prefix.
+		tmp := make([]byte, 0, len(data)+len(rest))
+		tmp = append(tmp, data[:i]...)
+		tmp = append(tmp, rest...)
+		if i+len(rest) < len(data) {
+			tmp = append(tmp, data[i+len(rest):]...)
+		}
+		fn(tmp)
+		// Insert the rest after the prefix.
+		tmp = make([]byte, 0, len(data)+len(rest))
+		tmp = append(append(append(tmp, data[:i]...), rest...), data[i:]...)
+		fn(tmp)
+	}
+}
+
 func (site *SonarSite) update(sam SonarSample, smash, resb bool) (updated, skip bool) {
 	res := 0
 	if resb {
@@ -0,0 +1,90 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
+)
+
+func TestParseSonarData(t *testing.T) {
+	// The file is written by sonarRecord in go-fuzz-dep TestSonarRecord,
+	// see the test for description of the records.
+	data, err := ioutil.ReadFile(filepath.Join("..", "go-fuzz-dep", "testdata", "sonar.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const regionSize = 4096
+	if len(data) > regionSize || len(data) < regionSize-SonarHdrLen-10 {
+		t.Fatalf("sonar region is not full: %v bytes", len(data))
+	}
+	w := &Worker{hub: &Hub{}}
+	ro := &ROData{sonarSites: make([]SonarSite, regionSize)}
+	for i := range ro.sonarSites {
+		ro.sonarSites[i].id = i
+	}
+	w.hub.ro.Store(ro)
+	samples := w.parseSonarData(data)
+	if len(samples) < 100 {
+		t.Fatalf("got %v samples", len(samples))
+	}
+	check := func(i, site int, v1, v2 string) {
+		sam := samples[i]
+		if sam.site.id != site || sam.flags != SonarString || string(sam.val[0]) != v1 || string(sam.val[1]) != v2 {
+			t.Errorf("sample #%v: got site %v, flags %x, %v/%v bytes, want site %v, %v/%v bytes",
+				i, sam.site.id, sam.flags, len(sam.val[0]), len(sam.val[1]), site, len(v1), len(v2))
+		}
+	}
+	check(0, 1, "abc", "abd")
+	// Long operands are reported as a window around the first difference,
+	// the second long record does not fit into the first half of the region.
+	start := 3000 - SonarMaxLen/2
+	long1 := strings.Repeat("a", 3000) + "X" + strings.Repeat("b", 1000)
+	long2 := strings.Repeat("a", 3000) + "Y" + strings.Repeat("c", 10)
+	check(1, 2, long1[start:start+SonarMaxLen], long2[start:])
+	for i := 2; i < len(samples); i++ {
+		check(i, i+2, fmt.Sprintf("k%04d", i+2), fmt.Sprintf("v%04d", i+2))
+	}
+}
+
+func TestSonarPrefixHints(t *testing.T) {
+	tests := []struct {
+		data, v1, v2 string
+		hints        []string
+	}{
+		// v1 is a window of a long string that data contains only partially.
+		{"<svg version=1.0 />", "version=1.0>", "version=1.1>", []string{
+			"<svg version=1.1>/>", "<svg version=1.1>0 />",
+		}},
+		// The common prefix occurs twice.
+		{"key:x key:y", "key:value", "key:other", []string{
+			"key:other:y", "key:otherx key:y", "key:x key:other", "key:x key:othery",
+		}},
+		// data contains the whole v1, the usual replacement handles it.
+		{"<svg version=1.0>", "version=1.0", "version=1.1", nil},
+		// Short prefix.
+		{"abcd", "abz", "abw", nil},
+		// v1 is a prefix of v2.
+		{"header", "head", "header", nil},
+		// data does not contain the prefix.
+		{"foo", "version=1.0", "version=1.1", nil},
+	}
+	for _, test := range tests {
+		data, v1, v2 := []byte(test.data), []byte(test.v1), []byte(test.v2)
+		var hints []string
+		if p := sonarPrefixLen(data, v1, v2); p != 0 {
+			sonarPrefixHints(data, v1[:p], v2[p:], func(tmp []byte) {
+				hints = append(hints, string(tmp))
+			})
+		}
+		if fmt.Sprint(hints) != fmt.Sprint(test.hints) {
+			t.Errorf("%q, %q, %q:\ngot:  %q\nwant: %q", test.data, test.v1, test.v2, hints, test.hints)
+		}
+	}
+}
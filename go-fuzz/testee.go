@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -29,14 +31,15 @@ type Testee struct {
 	inPipe      *os.File
 	outPipe     *os.File
 	stdoutPipe  *os.File
-	writebuf    [9]byte  // reusable write buffer
-	resbuf      [24]byte // reusable results buffer
+	writebuf    [34]byte // reusable write buffer
+	resbuf      [32]byte // reusable results buffer
 	startTime   int64
 	execs       int
 	outputC     chan []byte
 	downC       chan bool
 	down        bool
 	fnidx       uint8
+	race        bool
 }
 
 // TestBinary handles communication with and restring of testee subprocesses.
@@ -56,6 +59,7 @@ type TestBinary struct {
 	stats *Stats
 
 	fnidx uint8
+	race  bool // testee is built with race detector
 }
 
 func init() {
@@ -69,7 +73,27 @@ func init() {
 // before we start to overwrite old output.
 const testeeBufferSize = 1 << 20
 
-func newTestBinary(fileName string, periodicCheck func(), stats *Stats, fnidx uint8) *TestBinary {
+const (
+	// testeeRestartPeriod is how many inputs a testee executes before we recreate it.
+	testeeRestartPeriod = 10000
+	// raceTesteeRestartPeriod is the same for binaries built with race detector.
+	// Race runtime accumulates shadow memory and goroutine history much faster,
+	// and it also has a hard limit on the number of simultaneously alive goroutines.
+	raceTesteeRestartPeriod = 1000
+
+	// testeeStartupAllowance is added to the timeout of the first input of a testee.
+	testeeStartupAllowance = 10 * time.Second
+	// minHangCheckPeriod limits how often the hang watcher wakes up for short timeouts.
+	minHangCheckPeriod = 10 * time.Millisecond
+)
+
+// raceGoroutineLimit is printed by race runtime when the testee has too many goroutines.
+// Usually this is not a bug in the input, but rather a sign that we need to restart the testee
+// (goroutines are leaked by previous inputs), so the input is retried once on a fresh testee.
+// The limit itself differs between race runtime versions, so it is not matched.
+var raceGoroutineLimit = []byte("simultaneously alive goroutines is exceeded")
+
+func newTestBinary(fileName string, periodicCheck func(), stats *Stats, fnidx uint8, race bool) *TestBinary {
 	comm, err := ioutil.TempFile("", "go-fuzz-comm")
 	if err != nil {
 		log.Fatalf("failed to create comm file: %v", err)
@@ -87,6 +111,7 @@ func newTestBinary(fileName string, periodicCheck func(), stats *Stats, fnidx ui
 		sonarRegion:   mem[CoverSize+SonarRegionSize:],
 		stats:         stats,
 		fnidx:         fnidx,
+		race:          race,
 		testeeBuffer:  make([]byte, testeeBufferSize),
 	}
 }
@@ -100,10 +125,22 @@ func (bin *TestBinary) close() {
 	os.Remove(bin.commFile)
 }
 
-func (bin *TestBinary) test(data []byte) (res int, ns uint64, cover, sonar, output []byte, crashed, hanged bool) {
+// test runs the fuzz function on data.
+func (bin *TestBinary) test(data []byte) (res int, ns, alloc uint64, cover, sonar, output []byte, crashed, hanged bool) {
+	return bin.run(CmdFuzz, data)
+}
+
+// testSonar is the same as test, but also collects sonar data.
+func (bin *TestBinary) testSonar(data []byte) (res int, ns, alloc uint64, cover, sonar, output []byte, crashed, hanged bool) {
+	return bin.run(CmdSonar, data)
+}
+
+// run executes data with cmd (CmdFuzz or CmdSonar).
+func (bin *TestBinary) run(cmd uint8, data []byte) (res int, ns, alloc uint64, cover, sonar, output []byte, crashed, hanged bool) {
 	if len(data) > MaxInputSize {
 		panic("input is too large")
 	}
+	raceRetried := false
 	for {
 		// This is the only function that is executed regularly,
 		// so we tie some periodic checks to it.
@@ -112,10 +149,14 @@ func (bin *TestBinary) test(data []byte) (res int, ns uint64, cover, sonar, outp
 		bin.stats.execs++
 		if bin.testee == nil {
 			bin.stats.restarts++
-			bin.testee = newTestee(bin.fileName, bin.comm, bin.coverRegion, bin.inputRegion, bin.sonarRegion, bin.fnidx, bin.testeeBuffer)
+			bin.testee = newTestee(bin.fileName, bin.comm, bin.coverRegion, bin.inputRegion, bin.sonarRegion, bin.fnidx, bin.race, bin.testeeBuffer)
 		}
 		var retry bool
-		res, ns, cover, sonar, crashed, hanged, retry = bin.testee.test(data)
+		res, ns, alloc, cover, sonar, crashed, hanged, retry = bin.testee.test(cmd, data)
+		if *flagDeterministic {
+			// Exec time differs between runs, so it must not affect any decisions.
+			ns = 0
+		}
 		if retry {
 			bin.testee.shutdown()
 			bin.testee = nil
@@ -123,18 +164,51 @@ func (bin *TestBinary) test(data []byte) (res int, ns uint64, cover, sonar, outp
 		}
 		if crashed {
 			output = bin.testee.shutdown()
+			bin.testee = nil
+			if bin.race && !hanged && !raceRetried && bytes.Contains(output, raceGoroutineLimit) {
+				// If the input hits the limit on a fresh testee again,
+				// it starts too many goroutines itself and is reported as a crasher.
+				raceRetried = true
+				continue
+			}
 			if hanged {
-				hdr := fmt.Sprintf("program hanged (timeout %v seconds)\n\n", *flagTimeout)
+				hdr := fmt.Sprintf("program hanged (timeout %v)\n\n", *flagTimeout)
 				output = append([]byte(hdr), output...)
 			}
-			bin.testee = nil
 			return
 		}
 		return
 	}
 }
 
-func newTestee(bin string, comm *Mapping, coverRegion, inputRegion, sonarRegion []byte, fnidx uint8, buffer []byte) *Testee {
+// mutate runs custom mutator (cmd is CmdMutate or CmdCrossOver) in the testee.
+// Returns nil if the mutator crashed.
+func (bin *TestBinary) mutate(cmd uint8, data, data2 []byte, seed uint64, maxSize int) []byte {
+	for {
+		bin.periodicCheck()
+		if bin.testee == nil {
+			bin.stats.restarts++
+			bin.testee = newTestee(bin.fileName, bin.comm, bin.coverRegion, bin.inputRegion, bin.sonarRegion, bin.fnidx, bin.race, bin.testeeBuffer)
+		}
+		res, crashed, retry := bin.testee.mutate(cmd, data, data2, seed, maxSize)
+		if retry {
+			bin.testee.shutdown()
+			bin.testee = nil
+			continue
+		}
+		if crashed {
+			output := bin.testee.shutdown()
+			bin.testee = nil
+			if *flagV >= 1 {
+				log.Printf("custom mutator crashed:\n%s", output)
+			}
+			return nil
+		}
+		return res
+	}
+}
+
+func newTestee(bin string, comm *Mapping, coverRegion, inputRegion, sonarRegion []byte, fnidx uint8, race bool, buffer []byte) *Testee {
 retry:
 	rIn, wIn, err := os.Pipe()
 	if err != nil {
@@ -159,6 +233,23 @@ retry:
 	}
 	cmd.Env = append([]string{}, os.Environ()...)
 	cmd.Env = append(cmd.Env, "GOTRACEBACK=1")
+	if *flagLeakCheck {
+		cmd.Env = append(cmd.Env, "GO_FUZZ_LEAK_CHECK=1")
+	}
+	if *flagResourceFeedback {
+		cmd.Env = append(cmd.Env, "GO_FUZZ_ALLOC_STATS=1")
+	}
+	if *flagMemLimit != 0 {
+		// The limit is on heap growth per input, not on the heap size,
+		// so it is not passed to the runtime as GOMEMLIMIT.
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GO_FUZZ_MEM_LIMIT=%v", *flagMemLimit<<20))
+	}
+	if race {
+		// Make the testee exit on the first data race,
+		// so that the race is attributed to the current input.
+		// Our options go last, so that they take precedence over user settings.
+		cmd.Env = append(cmd.Env, "GORACE="+strings.TrimSpace(os.Getenv("GORACE")+" halt_on_error=1"))
+	}
 	setupCommMapping(cmd, comm, rOut, wIn)
 	if err = cmd.Start(); err != nil {
 		// This can be a transient failure like "cannot allocate memory" or "text file is busy".
@@ -186,6 +277,7 @@ retry:
 		outputC:     make(chan []byte),
 		downC:       make(chan bool),
 		fnidx:       fnidx,
+		race:        race,
 	}
 	// Stdout reader goroutine.
 	go func() {
@@ -222,8 +314,12 @@ retry:
 	}()
 	// Hang watcher goroutine.
 	go func() {
-		timeout := time.Duration(*flagTimeout) * time.Second
-		ticker := time.NewTicker(timeout / 2)
+		timeout := *flagTimeout
+		period := timeout / 2
+		if period < minHangCheckPeriod {
+			period = minHangCheckPeriod
+		}
+		ticker := time.NewTicker(period)
 		for {
 			select {
 			case <-ticker.C:
@@ -254,25 +350,82 @@ retry:
 	return t
 }
 
-// test passes data for testing.
-func (t *Testee) test(data []byte) (res int, ns uint64, cover, sonar []byte, crashed, hanged, retry bool) {
+// test passes data for testing with cmd (CmdFuzz or CmdSonar).
+func (t *Testee) test(cmd uint8, data []byte) (res int, ns, alloc uint64, cover, sonar []byte, crashed, hanged, retry bool) {
 	if t.down {
 		log.Fatalf("cannot test: testee is already shutdown")
 	}
 
 	// The test binary can accumulate significant amount of memory,
 	// so we recreate it periodically.
-	t.execs++
-	if t.execs > 10000 {
+	restartPeriod := testeeRestartPeriod
+	if t.race {
+		restartPeriod = raceTesteeRestartPeriod
+	}
+	if t.execs >= restartPeriod {
 		t.cmd.Process.Signal(syscall.SIGKILL)
 		retry = true
 		return
 	}
 
 	copy(t.inputRegion[:], data)
-	atomic.StoreInt64(&t.startTime, time.Now().UnixNano())
-	t.writebuf[0] = t.fnidx
-	binary.LittleEndian.PutUint64(t.writebuf[1:], uint64(len(data)))
+	var r testeeReply
+	r, crashed, hanged, retry = t.exec(cmd, uint64(len(data)), 0, 0, 0)
+	if crashed || retry {
+		return
+	}
+	res = int(r.Res)
+	ns = r.Ns
+	alloc = r.Alloc
+	cover = t.coverRegion
+	sonar = t.sonarRegion[:r.Sonar]
+	return
+}
+
+// mutate runs custom mutator (cmd is CmdMutate or CmdCrossOver) in the testee.
+// data2 is used only for crossover.
+func (t *Testee) mutate(cmd uint8, data, data2 []byte, seed uint64, maxSize int) (res []byte, crashed, retry bool) {
+	if t.down {
+		log.Fatalf("cannot mutate: testee is already shutdown")
+	}
+	copy(t.inputRegion[:], data)
+	copy(t.inputRegion[len(data):], data2)
+	r, crashed, _, retry := t.exec(cmd, uint64(len(data)), uint64(len(data2)), seed, uint64(maxSize))
+	if crashed || retry {
+		return
+	}
+	if r.Res > uint64(maxSize) {
+		r.Res = uint64(maxSize)
+	}
+	res = makeCopy(t.inputRegion[:r.Res])
+	return
+}
+
+// testeeReply is the reply of the testee to a command.
+type testeeReply struct {
+	Res   uint64 // Fuzz function result, or length of the mutated input
+	Ns    uint64
+	Sonar uint64
+	Alloc uint64 // bytes allocated, only with -resourcefeedback
+}
+
+// exec sends a command to the testee and waits for the reply.
+// The command input must be already copied into inputRegion.
+func (t *Testee) exec(cmd uint8, len1, len2, seed, maxSize uint64) (r testeeReply, crashed, hanged, retry bool) {
+	t.execs++
+	start := time.Now()
+	if t.execs == 1 {
+		// The first input also pays for process startup and package initialization,
+		// which can take longer than a short timeout.
+		start = start.Add(testeeStartupAllowance)
+	}
+	atomic.StoreInt64(&t.startTime, start.UnixNano())
+	t.writebuf[0] = cmd
+	t.writebuf[1] = t.fnidx
+	binary.LittleEndian.PutUint64(t.writebuf[2:], len1)
+	binary.LittleEndian.PutUint64(t.writebuf[10:], len2)
+	binary.LittleEndian.PutUint64(t.writebuf[18:], seed)
+	binary.LittleEndian.PutUint64(t.writebuf[26:], maxSize)
 	if _, err := t.outPipe.Write(t.writebuf[:]); err != nil {
 		if *flagV >= 1 {
 			log.Printf("write to testee failed: %v", err)
@@ -282,28 +435,19 @@ func (t *Testee) test(data []byte) (res int, ns uint64, cover, sonar []byte, cra
 	}
 	// Once we do the write, the test is running.
 	// Once we read the reply below, the test is done.
-	type Reply struct {
-		Res   uint64
-		Ns    uint64
-		Sonar uint64
-	}
 	_, err := io.ReadFull(t.inPipe, t.resbuf[:])
-	r := Reply{
+	r = testeeReply{
 		Res:   binary.LittleEndian.Uint64(t.resbuf[:]),
 		Ns:    binary.LittleEndian.Uint64(t.resbuf[8:]),
 		Sonar: binary.LittleEndian.Uint64(t.resbuf[16:]),
+		Alloc: binary.LittleEndian.Uint64(t.resbuf[24:]),
 	}
 	hanged = atomic.LoadInt64(&t.startTime) == -1
 	atomic.StoreInt64(&t.startTime, 0)
 	if err != nil || hanged {
 		// Should have been crashed.
 		crashed = true
-		return
 	}
-	res = int(r.Res)
-	ns = r.Ns
-	cover = t.coverRegion
-	sonar = t.sonarRegion[:r.Sonar]
 	return
 }
 
@@ -0,0 +1,494 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package versifier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*
+Binary analyser recognizes common layouts of binary formats:
+- magic: a common prefix of all binary inputs;
+- length-prefixed data: a 1/2/4-byte length field (either byte order)
+  that holds size of the rest of the data;
+- record sequences: data that is completely covered by a sequence of
+  records of the same shape (TLV, PNG/RIFF-like chunks), that is
+  [tag][length][tag][value][trailer] with optional tags and trailer.
+Values of length fields and records are analysed recursively.
+When generating, lengths are recomputed from the generated values,
+so they stay consistent with the data even if values grow or shrink.
+Header bytes preceding length fields and records keep their size,
+so offsets into the data stay valid as well.
+*/
+
+const (
+	maxBinarySize   = 1 << 14 // larger inputs are not analysed
+	maxBinaryDepth  = 4       // max nesting of recognized structures
+	maxHeaderSize   = 64      // max size of data preceding length field or records
+	maxMagicSize    = 16
+	minMagicSize    = 2
+	minMagicSamples = 2 // magic is recognized when several inputs start with the same bytes
+)
+
+// recordFormat describes shape of records: [pre][length][post][value][trailer].
+type recordFormat struct {
+	pre     int // bytes before the length field (e.g. tag in TLV)
+	width   int // size of the length field
+	big     bool
+	post    int // bytes between the length field and the value (e.g. PNG chunk type)
+	trailer int // bytes after the value (e.g. PNG chunk CRC)
+}
+
+func (f recordFormat) String() string {
+	order := "le"
+	if f.big {
+		order = "be"
+	}
+	return fmt.Sprintf("pre=%v len=%v%v post=%v trailer=%v", f.pre, f.width, order, f.post, f.trailer)
+}
+
+var recordFormats = func() []recordFormat {
+	var formats []recordFormat
+	for _, width := range []int{4, 2, 1} {
+		for _, big := range []bool{true, false} {
+			if width == 1 && !big {
+				continue
+			}
+			for _, pre := range []int{0, 1, 2, 4} {
+				for _, post := range []int{0, 4} {
+					for _, trailer := range []int{0, 4} {
+						formats = append(formats, recordFormat{pre, width, big, post, trailer})
+					}
+				}
+			}
+		}
+	}
+	return formats
+}()
+
+func readLen(data []byte, width int, big bool) int {
+	switch width {
+	case 1:
+		return int(data[0])
+	case 2:
+		if big {
+			return int(binary.BigEndian.Uint16(data))
+		}
+		return int(binary.LittleEndian.Uint16(data))
+	default:
+		if big {
+			return int(binary.BigEndian.Uint32(data))
+		}
+		return int(binary.LittleEndian.Uint32(data))
+	}
+}
+
+func writeLen(w io.Writer, v, width int, big bool) {
+	buf := make([]byte, 4)
+	switch width {
+	case 1:
+		buf[0] = byte(v)
+	case 2:
+		if big {
+			binary.BigEndian.PutUint16(buf, uint16(v))
+		} else {
+			binary.LittleEndian.PutUint16(buf, uint16(v))
+		}
+	default:
+		if big {
+			binary.BigEndian.PutUint32(buf, uint32(v))
+		} else {
+			binary.LittleEndian.PutUint32(buf, uint32(v))
+		}
+	}
+	w.Write(buf[:width])
+}
+
+// splitRecords splits data into records of format f.
+// It returns nil if data is not exactly covered by the records.
+func splitRecords(data []byte, f recordFormat) [][4][]byte {
+	var recs [][4][]byte // pre, post, value, trailer
+	hdr := f.pre + f.width + f.post
+	valueSize := 0
+	for pos := 0; pos != len(data); {
+		if len(data)-pos < hdr+f.trailer {
+			return nil
+		}
+		size := readLen(data[pos+f.pre:], f.width, f.big)
+		end := pos + hdr + size + f.trailer
+		if size < 0 || size > len(data) || end > len(data) {
+			return nil
+		}
+		recs = append(recs, [4][]byte{
+			data[pos : pos+f.pre],
+			data[pos+f.pre+f.width : pos+hdr],
+			data[pos+hdr : pos+hdr+size],
+			data[pos+hdr+size : end],
+		})
+		valueSize += size
+		pos = end
+	}
+	// Filter out degenerate splits like a sequence of empty records in zeroed data.
+	if valueSize < len(recs) {
+		return nil
+	}
+	return recs
+}
+
+// binLayout is a recognized layout of binary data:
+// a header followed by a sequence of records that cover the rest of data.
+// A single record without tags and trailer is just a length field.
+type binLayout struct {
+	start  int
+	format recordFormat
+	recs   [][4][]byte  // pre, post, value, trailer
+	values []*binLayout // layouts of record values, nil for unstructured values
+	score  float64
+}
+
+// analyseBinary finds the most probable layout of data, or returns nil.
+// Layouts are scored by the amount of evidence they provide: wider length fields
+// and more records are less likely to appear by coincidence, long headers are
+// suspicious. Nested layouts of record values contribute to the score as well,
+// but only few best candidates on every level are analysed recursively.
+func analyseBinary(data []byte, depth int) *binLayout {
+	if depth >= maxBinaryDepth || len(data) < 4 {
+		return nil
+	}
+	var cands []*binLayout
+	for start := 0; start <= maxHeaderSize && start < len(data); start++ {
+		for _, f := range recordFormats {
+			recs := splitRecords(data[start:], f)
+			// Single records with short length fields are too likely to be a coincidence.
+			minRecs := 1
+			if f.width == 1 {
+				minRecs = 3
+			}
+			if len(recs) < minRecs || len(recs) == 1 && (f.pre != 0 || f.post != 0 || f.trailer != 0) {
+				continue
+			}
+			l := &binLayout{start: start, format: f, recs: recs, score: -float64(start) / 4}
+			for _, rec := range recs {
+				if len(rec[2]) != 0 {
+					l.score += float64(f.width)
+				} else {
+					l.score += float64(f.width) / 2
+				}
+			}
+			cands = append(cands, l)
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		return cands[i].score > cands[j].score
+	})
+	const maxCands = 3
+	if len(cands) > maxCands {
+		cands = cands[:maxCands]
+	}
+	var best *binLayout
+	for _, l := range cands {
+		l.values = make([]*binLayout, len(l.recs))
+		for i, rec := range l.recs {
+			if l.values[i] = analyseBinary(rec[2], depth+1); l.values[i] != nil {
+				l.score += l.values[i].score
+			}
+		}
+		if best == nil || l.score > best.score {
+			best = l
+		}
+	}
+	return best
+}
+
+// buildBinary creates nodes for data with layout l.
+func (v *Verse) buildBinary(data []byte, l *binLayout) []Node {
+	if l == nil {
+		return []Node{v.bytesNode(data, false)}
+	}
+	nodes := v.header(data[:l.start])
+	if len(l.recs) == 1 && l.format.pre == 0 && l.format.post == 0 && l.format.trailer == 0 {
+		n := &LenNode{width: l.format.width, big: l.format.big, value: v.buildBinary(l.recs[0][2], l.values[0])}
+		return append(nodes, n)
+	}
+	seq := &SeqNode{format: l.format}
+	for i, rec := range l.recs {
+		r := &RecordNode{
+			format:  l.format,
+			pre:     rec[0],
+			post:    rec[1],
+			value:   v.buildBinary(rec[2], l.values[i]),
+			trailer: rec[3],
+		}
+		seq.records = append(seq.records, r)
+		v.records[l.format] = append(v.records[l.format], r)
+	}
+	return append(nodes, seq)
+}
+
+func (v *Verse) header(data []byte) []Node {
+	if len(data) == 0 {
+		return nil
+	}
+	return []Node{v.bytesNode(data, true)}
+}
+
+func (v *Verse) bytesNode(data []byte, fixed bool) Node {
+	v.binData = append(v.binData, data)
+	return &BytesNode{data: data, fixed: fixed}
+}
+
+// updateMagic updates common prefix of binary inputs.
+func (v *Verse) updateMagic(data []byte) {
+	if v.magicSamples == 0 {
+		v.magic = data
+		if len(v.magic) > maxMagicSize {
+			v.magic = v.magic[:maxMagicSize]
+		}
+	} else {
+		n := 0
+		for n < len(v.magic) && n < len(data) && v.magic[n] == data[n] {
+			n++
+		}
+		v.magic = v.magic[:n]
+	}
+	v.magicSamples++
+}
+
+// BinaryNode is the root of a binary input.
+type BinaryNode struct {
+	nodes []Node
+}
+
+func (n *BinaryNode) Visit(f func(n Node)) {
+	f(n)
+	for _, n := range n.nodes {
+		n.Visit(f)
+	}
+}
+
+func (n *BinaryNode) Print(w io.Writer, ident int) {
+	fmt.Fprintf(w, "%sbinary\n", strings.Repeat("  ", ident))
+	for _, n := range n.nodes {
+		n.Print(w, ident+1)
+	}
+}
+
+func (n *BinaryNode) Generate(w io.Writer, v *Verse) {
+	buf := new(bytes.Buffer)
+	for _, n := range n.nodes {
+		n.Generate(buf, v)
+	}
+	data := buf.Bytes()
+	// Most inputs need to start with the magic to get past the first check.
+	if v.magicSamples >= minMagicSamples && len(v.magic) >= minMagicSize && v.Rand(20) != 0 {
+		if len(data) < len(v.magic) {
+			data = append(data, make([]byte, len(v.magic)-len(data))...)
+		}
+		copy(data, v.magic)
+	}
+	w.Write(data)
+}
+
+// BytesNode is unstructured binary data.
+// Fixed nodes (headers) keep their size to not break offsets.
+type BytesNode struct {
+	data  []byte
+	fixed bool
+}
+
+func (n *BytesNode) Visit(f func(n Node)) {
+	f(n)
+}
+
+func (n *BytesNode) Print(w io.Writer, ident int) {
+	data := n.data
+	suffix := ""
+	if len(data) > 16 {
+		data, suffix = data[:16], "..."
+	}
+	fmt.Fprintf(w, "%sbytes[%v] %x%v\n", strings.Repeat("  ", ident), len(n.data), data, suffix)
+}
+
+func (n *BytesNode) Generate(w io.Writer, v *Verse) {
+	data := n.data
+	if v.Rand(3) != 0 {
+		w.Write(data)
+		return
+	}
+	data = append([]byte{}, data...)
+	switch v.Rand(4) {
+	case 0:
+		if len(data) != 0 {
+			data[v.Rand(len(data))] ^= 1 << uint(v.Rand(8))
+		}
+	case 1:
+		if len(data) != 0 {
+			data[v.Rand(len(data))] = []byte{0, 1, 0x7f, 0x80, 0xff}[v.Rand(5)]
+		}
+	case 2:
+		// Use data of another node of the same size, or of any size if size is not fixed.
+		for _, bn := range v.binData {
+			if !n.fixed || len(bn) == len(data) {
+				if v.Rand(4) == 0 {
+					data = bn
+					break
+				}
+			}
+		}
+	case 3:
+		if n.fixed {
+			break
+		}
+		if len(data) != 0 && v.Rand(2) == 0 {
+			pos := v.Rand(len(data))
+			data = append(data[:pos], data[pos+1+v.Rand(len(data)-pos):]...)
+		} else {
+			pos := v.Rand(len(data) + 1)
+			ins := make([]byte, 1+v.Rand(16))
+			for i := range ins {
+				ins[i] = byte(v.Rand(256))
+			}
+			data = append(data[:pos], append(ins, data[pos:]...)...)
+		}
+	}
+	w.Write(data)
+}
+
+// LenNode is a length field followed by the data it describes.
+type LenNode struct {
+	width int
+	big   bool
+	value []Node
+}
+
+func (n *LenNode) Visit(f func(n Node)) {
+	f(n)
+	for _, n := range n.value {
+		n.Visit(f)
+	}
+}
+
+func (n *LenNode) Print(w io.Writer, ident int) {
+	fmt.Fprintf(w, "%slength %v big=%v\n", strings.Repeat("  ", ident), n.width, n.big)
+	for _, n := range n.value {
+		n.Print(w, ident+1)
+	}
+}
+
+func (n *LenNode) Generate(w io.Writer, v *Verse) {
+	value := generateValue(n.value, v)
+	writeLen(w, badLen(v, len(value)), n.width, n.big)
+	w.Write(value)
+}
+
+func generateValue(nodes []Node, v *Verse) []byte {
+	buf := new(bytes.Buffer)
+	for _, n := range nodes {
+		n.Generate(buf, v)
+	}
+	return buf.Bytes()
+}
+
+// badLen returns correct length most of the time, but sometimes a slightly wrong one
+// to exercise error handling.
+func badLen(v *Verse, size int) int {
+	if v.Rand(50) != 0 {
+		return size
+	}
+	switch v.Rand(4) {
+	case 0:
+		return size + 1
+	case 1:
+		return size - 1
+	case 2:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// RecordNode is a single record of a record sequence.
+type RecordNode struct {
+	format  recordFormat
+	pre     []byte
+	post    []byte
+	value   []Node
+	trailer []byte
+}
+
+func (n *RecordNode) Visit(f func(n Node)) {
+	f(n)
+	for _, n := range n.value {
+		n.Visit(f)
+	}
+}
+
+func (n *RecordNode) Print(w io.Writer, ident int) {
+	fmt.Fprintf(w, "%srecord pre=%x post=%x trailer=%x\n", strings.Repeat("  ", ident), n.pre, n.post, n.trailer)
+	for _, n := range n.value {
+		n.Print(w, ident+1)
+	}
+}
+
+func (n *RecordNode) Generate(w io.Writer, v *Verse) {
+	value := generateValue(n.value, v)
+	w.Write(n.pre)
+	writeLen(w, badLen(v, len(value)), n.format.width, n.format.big)
+	w.Write(n.post)
+	w.Write(value)
+	w.Write(n.trailer)
+}
+
+// SeqNode is a sequence of records of the same format.
+type SeqNode struct {
+	format  recordFormat
+	records []Node
+}
+
+func (n *SeqNode) Visit(f func(n Node)) {
+	f(n)
+	for _, n := range n.records {
+		n.Visit(f)
+	}
+}
+
+func (n *SeqNode) Print(w io.Writer, ident int) {
+	fmt.Fprintf(w, "%srecords %v\n", strings.Repeat("  ", ident), n.format)
+	for _, n := range n.records {
+		n.Print(w, ident+1)
+	}
+}
+
+func (n *SeqNode) Generate(w io.Writer, v *Verse) {
+	records := append([]Node{}, n.records...)
+	if v.Rand(5) == 0 {
+		// Remove, duplicate and swap records, or use records from other inputs.
+		for iter := 0; iter == 0 || v.Rand(2) == 0; iter++ {
+			idx := v.Rand(len(records))
+			switch v.Rand(4) {
+			case 0:
+				if len(records) > 1 {
+					records = append(records[:idx], records[idx+1:]...)
+				}
+			case 1:
+				records = append(records, nil)
+				copy(records[idx+1:], records[idx:])
+			case 2:
+				idx2 := v.Rand(len(records))
+				records[idx], records[idx2] = records[idx2], records[idx]
+			case 3:
+				other := v.records[n.format]
+				records[idx] = other[v.Rand(len(other))]
+			}
+		}
+	}
+	for _, r := range records {
+		r.Generate(w, v)
+	}
+}
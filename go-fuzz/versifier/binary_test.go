@@ -0,0 +1,114 @@
+// Copyright 2015 go-fuzz project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package versifier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func pngChunk(typ string, data []byte) []byte {
+	buf := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	buf = append(buf, typ...)
+	buf = append(buf, data...)
+	return append(buf, 0xde, 0xad, 0xbe, 0xef)
+}
+
+func TestBinaryRecords(t *testing.T) {
+	const sig = "\x89PNG\r\n\x1a\n"
+	inputs := [][]byte{
+		bytes.Join([][]byte{[]byte(sig), pngChunk("IHDR", make([]byte, 13)), pngChunk("IDAT", []byte{1, 2, 3, 4, 5}), pngChunk("IEND", nil)}, nil),
+		bytes.Join([][]byte{[]byte(sig), pngChunk("IHDR", make([]byte, 13)), pngChunk("tEXt", []byte("\x00\x01\x02")), pngChunk("IDAT", []byte{7}), pngChunk("IEND", nil)}, nil),
+	}
+	var v *Verse
+	for _, data := range inputs {
+		v = BuildVerse(v, data)
+	}
+	v.Print(os.Stdout)
+	if !bytes.HasPrefix(v.magic, []byte(sig)) || v.magicSamples != 2 {
+		t.Fatalf("bad magic %q (%v samples)", v.magic, v.magicSamples)
+	}
+	format := recordFormat{width: 4, big: true, post: 4, trailer: 4}
+	if len(v.records[format]) != 7 {
+		t.Fatalf("recognized %v records of format %v, want 7", len(v.records[format]), format)
+	}
+	valid := 0
+	const iters = 1000
+	for i := 0; i < iters; i++ {
+		data := v.Rhyme()
+		if bytes.HasPrefix(data, []byte(sig)) && splitRecords(data[len(sig):], format) != nil {
+			valid++
+		}
+	}
+	if valid < iters/2 {
+		t.Fatalf("only %v/%v generated inputs are consistent", valid, iters)
+	}
+}
+
+func tlv(tag byte, value []byte) []byte {
+	buf := []byte{tag, 0, 0}
+	binary.LittleEndian.PutUint16(buf[1:], uint16(len(value)))
+	return append(buf, value...)
+}
+
+func TestBinaryNested(t *testing.T) {
+	inner := bytes.Join([][]byte{tlv(1, []byte{0xff, 0xfe}), tlv(2, []byte("\x00abc")), tlv(3, []byte{0x80})}, nil)
+	data := bytes.Join([][]byte{tlv(0x10, inner), tlv(0x11, []byte{0xf0, 0xf1, 0xf2}), tlv(0x12, inner)}, nil)
+	v := BuildVerse(nil, data)
+	v.Print(os.Stdout)
+	format := recordFormat{pre: 1, width: 2}
+	if n := len(v.records[format]); n != 9 {
+		t.Fatalf("recognized %v records of format %v, want 9", n, format)
+	}
+	valid := 0
+	const iters = 1000
+	for i := 0; i < iters; i++ {
+		out := v.Rhyme()
+		recs := splitRecords(out, format)
+		if recs == nil || len(recs) == 0 {
+			continue
+		}
+		// Nested records must be consistent as well.
+		nested := true
+		for _, rec := range recs {
+			if (rec[0][0] == 0x10 || rec[0][0] == 0x12) && splitRecords(rec[2], format) == nil {
+				nested = false
+			}
+		}
+		if nested {
+			valid++
+		}
+	}
+	if valid < iters/2 {
+		t.Fatalf("only %v/%v generated inputs are consistent", valid, iters)
+	}
+}
+
+func TestBinaryLength(t *testing.T) {
+	payload := []byte{0xca, 0xfe, 0xba, 0xbe, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	data := append([]byte{0xff, 0x01, 0, 0, 0, byte(len(payload))}, payload...)
+	v := BuildVerse(nil, data)
+	v.Print(os.Stdout)
+	valid := 0
+	const iters = 1000
+	for i := 0; i < iters; i++ {
+		out := v.Rhyme()
+		if len(out) >= 6 && int(binary.BigEndian.Uint32(out[2:])) == len(out)-6 {
+			valid++
+		}
+	}
+	if valid < iters/2 {
+		t.Fatalf("only %v/%v generated inputs are consistent", valid, iters)
+	}
+}
+
+func TestBinaryZeros(t *testing.T) {
+	v := BuildVerse(nil, make([]byte, 100))
+	if len(v.records) != 0 {
+		t.Fatalf("recognized records in zeroed data")
+	}
+}
@@ -1,8 +1,9 @@
 // Copyright 2015 go-fuzz project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
-// Package versifier recognizes internal structure of random (currently text-only) data
-// and allows to generate data of a similar structure (for some very weak definition of "similar").
+// Package versifier recognizes internal structure of random data (text, or binary with
+// length fields and records) and allows to generate data of a similar structure
+// (for some very weak definition of "similar").
 package versifier
 
 /*
@@ -29,6 +30,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"strings"
 	"unicode/utf8"
 
@@ -36,8 +38,7 @@ import (
 )
 
 func BuildVerse(oldv *Verse, data []byte) *Verse {
-	// Check if the data is something texty. If not, don't bother parsing it.
-	// Versifier don't know how to recognize structure in binary data.
+	// Check if the data is something texty. If not, use the binary analyser.
 	// TODO: we could detect detect text and binary parts and handle them separately
 	// (think of an HTTP request with compressed body).
 	printable := 0
@@ -47,14 +48,17 @@ func BuildVerse(oldv *Verse, data []byte) *Verse {
 		}
 	}
 	if printable < len(data)*9/10 {
-		return oldv
+		if len(data) > maxBinarySize {
+			return oldv
+		}
+		newv := copyVerse(oldv)
+		newv.updateMagic(data)
+		b := &BinaryNode{newv.buildBinary(data, analyseBinary(data, 0))}
+		newv.blocks = append(newv.blocks, b)
+		return newv
 	}
 
-	newv := &Verse{}
-	if oldv != nil {
-		newv.blocks = oldv.blocks
-		newv.allNodes = oldv.allNodes
-	}
+	newv := copyVerse(oldv)
 	n := tokenize(data)
 	n = structure(n)
 	b := &BlockNode{n}
@@ -62,6 +66,21 @@ func BuildVerse(oldv *Verse, data []byte) *Verse {
 	b.Visit(func(n Node) {
 		newv.allNodes = append(newv.allNodes, n)
 	})
+	return newv
+}
+
+func copyVerse(oldv *Verse) *Verse {
+	newv := &Verse{records: make(map[recordFormat][]*RecordNode)}
+	if oldv != nil {
+		newv.blocks = oldv.blocks
+		newv.allNodes = oldv.allNodes
+		newv.binData = oldv.binData
+		newv.magic = oldv.magic
+		newv.magicSamples = oldv.magicSamples
+		for f, recs := range oldv.records {
+			newv.records[f] = recs
+		}
+	}
 	newv.r = pcg.New()
 	return newv
 }
@@ -89,6 +108,7 @@ func randTerm(v *Verse, dict map[string]struct{}) []byte {
 	for k := range dict {
 		terms = append(terms, k)
 	}
+	sort.Strings(terms) // map iteration order is random, but generation must be reproducible with pcg.Seed
 	return []byte(terms[v.Rand(len(terms))])
 }
 
@@ -466,9 +486,15 @@ func (n *BlockNode) Generate(w io.Writer, v *Verse) {
 }
 
 type Verse struct {
-	blocks   []*BlockNode
+	blocks   []Node
 	allNodes []Node
 	r        *pcg.Rand
+
+	// Binary inputs.
+	records      map[recordFormat][]*RecordNode // all records by format
+	binData      [][]byte                       // contents of all BytesNode's
+	magic        []byte                         // common prefix of binary inputs
+	magicSamples int                            // number of binary inputs
 }
 
 func (v *Verse) Print(w io.Writer) {
@@ -18,6 +18,10 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/dvyukov/go-fuzz/go-fuzz/grammar"
+	"github.com/dvyukov/go-fuzz/go-fuzz/jsonmut"
+	"github.com/dvyukov/go-fuzz/go-fuzz/protomut"
+
 	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
 	. "github.com/dvyukov/go-fuzz/internal/go-fuzz-types"
 )
@@ -34,12 +38,16 @@ const (
 	execFuzz
 	execVersifier
 	execSmash
+	execGrammar
 	execSonar
 	execSonarHint
 	execTotal
 	execCount
 )
 
+// maxMutatorCrashes is the number of custom mutator crashes after which we stop using it.
+const maxMutatorCrashes = 10
+
 // Worker manages one testee.
 type Worker struct {
 	id      int
@@ -47,14 +55,24 @@ type Worker struct {
 	mutator *Mutator
 
 	coverBin *TestBinary
-	sonarBin *TestBinary
+	sonarBin *TestBinary // the same as coverBin for binaries built with go-fuzz-build -single
+
+	customMutator   bool // test binary has custom FuzzMutate function
+	customCrossOver bool // test binary has custom FuzzCrossOver function
+	mutatorCrashes  int  // number of custom mutator crashes
+	// customMutate runs custom mutator command in the test binary, returns nil if it crashes.
+	customMutate func(cmd uint8, data, data2 []byte, seed uint64, maxSize int) []byte
 
 	triageQueue  []CoordinatorInput
 	crasherQueue []NewCrasherArgs
+	// triageResources holds resource usage maxima of inputs queued for triage, only with -resourcefeedback.
+	triageResources *Resources
 
-	lastSync time.Time
-	stats    Stats
-	execs    [execCount]uint64
+	lastSync    time.Time
+	checks      uint64 // number of periodicCheck calls, used only in -deterministic mode
+	edgeSamples uint64 // number of executions considered for edge sampling
+	stats       Stats
+	execs       [execCount]uint64
 }
 
 type Input struct {
@@ -65,7 +83,10 @@ type Input struct {
 	res             int
 	depth           int
 	typ             execType
+	fuzzed          uint64 // number of times the input was chosen for fuzzing (as of the last score update)
 	execTime        uint64
+	alloc           uint64        // bytes allocated, only with -resourcefeedback
+	tree            *grammar.Node // derivation tree of data, only with -grammar
 	favored         bool
 	score           int
 	runningScoreSum int
@@ -107,6 +128,11 @@ func workerMain() {
 				coverBin = f.Name()
 			case "sonar.exe":
 				sonarBin = f.Name()
+			case "fuzz.exe":
+				// Built with go-fuzz-build -single: the binary has both coverage
+				// and sonar instrumentation, sonar is enabled per execution.
+				coverBin = f.Name()
+				sonarBin = f.Name()
 			default:
 				log.Fatalf("unknown file '%v' in input archive", f.Name())
 			}
@@ -120,7 +146,9 @@ func workerMain() {
 
 	cleanup := func() {
 		os.Remove(coverBin)
-		os.Remove(sonarBin)
+		if sonarBin != coverBin {
+			os.Remove(sonarBin)
+		}
 	}
 
 	// Which function should we fuzz?
@@ -153,21 +181,28 @@ func workerMain() {
 
 	shutdownCleanup = append(shutdownCleanup, cleanup)
 
-	hub := newHub(metadata)
+	hub := newHub(metadata, fnname)
 	for i := 0; i < *flagProcs; i++ {
 		w := &Worker{
 			id:      i,
 			hub:     hub,
 			mutator: newMutator(),
+
+			customMutator:   metadata.CustomMutator,
+			customCrossOver: metadata.CustomCrossOver,
+		}
+		w.coverBin = newTestBinary(coverBin, w.periodicCheck, &w.stats, uint8(fnidx), metadata.Race)
+		w.sonarBin = w.coverBin
+		w.customMutate = w.coverBin.mutate
+		if sonarBin != coverBin {
+			w.sonarBin = newTestBinary(sonarBin, w.periodicCheck, &w.stats, uint8(fnidx), metadata.Race)
 		}
-		w.coverBin = newTestBinary(coverBin, w.periodicCheck, &w.stats, uint8(fnidx))
-		w.sonarBin = newTestBinary(sonarBin, w.periodicCheck, &w.stats, uint8(fnidx))
 		go w.loop()
 	}
 }
 
 func (w *Worker) loop() {
-	iter, fuzzSonarIter, versifierSonarIter := 0, 0, 0
+	iter, fuzzSonarIter, versifierSonarIter, grammarIter := 0, 0, 0, 0
 	for atomic.LoadUint32(&shutdown) == 0 {
 		if len(w.crasherQueue) > 0 {
 			n := len(w.crasherQueue) - 1
@@ -181,8 +216,7 @@ func (w *Worker) loop() {
 			continue
 		}
 
-		select {
-		case input := <-w.hub.triageC:
+		if input, ok := w.nextTriageInput(); ok {
 			if *flagV >= 2 {
 				log.Printf("worker %v triages coordinator input [%v]%v minimized=%v smashed=%v", w.id, len(input.Data), hash(input.Data), input.Minimized, input.Smashed)
 			}
@@ -194,7 +228,6 @@ func (w *Worker) loop() {
 				}
 			}
 			continue
-		default:
 		}
 
 		if atomic.LoadUint32(&w.hub.initialTriage) != 0 {
@@ -228,7 +261,18 @@ func (w *Worker) loop() {
 		// 9 out of 10 iterations are random fuzzing.
 		iter++
 		if iter%10 != 0 || ro.verse == nil {
-			data, depth := w.mutator.generate(ro)
+			// With -grammar every other of these iterations works with derivation trees.
+			grammarIter++
+			if w.hub.grammar != nil && grammarIter%2 == 0 {
+				data, depth := w.generateGrammar(ro)
+				w.noteFuzzed()
+				data = w.fixChecksums(ro, data)
+				w.testInput(data, depth, execGrammar)
+				continue
+			}
+			data, depth := w.generate(ro)
+			w.noteFuzzed()
+			data = w.fixChecksums(ro, data)
 			// Every 1000-th iteration goes to sonar.
 			fuzzSonarIter++
 			if *flagSonar && fuzzSonarIter%1000 == 0 {
@@ -237,7 +281,8 @@ func (w *Worker) loop() {
 				w.processSonarData(data, sonar, depth, false)
 			} else {
 				// Plain old blind fuzzing.
-				w.testInput(data, depth, execFuzz)
+				found := w.testInput(data, depth, execFuzz)
+				w.mutator.credit(found)
 			}
 		} else {
 			// 1 out of 10 iterations goes to versifier.
@@ -246,6 +291,7 @@ func (w *Worker) loop() {
 			if len(data) > maxSize {
 				data = data[:maxSize]
 			}
+			data = w.fixChecksums(ro, data)
 			// Every 100-th versifier input goes to sonar.
 			versifierSonarIter++
 			if *flagSonar && versifierSonarIter%100 == 0 {
@@ -259,6 +305,139 @@ func (w *Worker) loop() {
 	w.shutdown()
 }
 
+// nextTriageInput returns the next input received from the coordinator, if any.
+func (w *Worker) nextTriageInput() (CoordinatorInput, bool) {
+	if *flagDeterministic {
+		return w.hub.popTriage()
+	}
+	select {
+	case input := <-w.hub.triageC:
+		return input, true
+	default:
+		return CoordinatorInput{}, false
+	}
+}
+
+// generate produces a new input for fuzzing either with the built-in mutator,
+// or with the custom mutator of the test binary (for -custommutator fraction of inputs).
+// Only inputs produced by the built-in mutator leave operators in m.ops for credit.
+func (w *Worker) generate(ro *ROData) ([]byte, int) {
+	m := w.mutator
+	m.ops = m.ops[:0]
+	m.input = -1
+	if w.hub.protoType != nil && m.rand(2) == 0 {
+		return w.generateProto(ro)
+	}
+	if *flagJSON && m.rand(2) == 0 {
+		return w.generateJSON(ro)
+	}
+	if !w.customMutator && !w.customCrossOver || m.rand(1000) >= int(*flagCustomMutator*1000) {
+		return m.generate(ro)
+	}
+	input := m.chooseFuzzInput(ro)
+	seed := uint64(m.r.Uint32())<<32 | uint64(m.r.Uint32())
+	var data []byte
+	if w.customCrossOver && (!w.customMutator || m.rand(4) == 0) {
+		// Both inputs must fit into the input region.
+		data1, data2 := input.data, m.chooseInput(ro).data
+		if len(data1) > MaxInputSize/2 {
+			data1 = data1[:MaxInputSize/2]
+		}
+		if len(data2) > MaxInputSize/2 {
+			data2 = data2[:MaxInputSize/2]
+		}
+		data = w.customMutate(CmdCrossOver, data1, data2, seed, MaxInputSize)
+	} else {
+		data = w.customMutate(CmdMutate, input.data, nil, seed, MaxInputSize)
+	}
+	if data == nil {
+		// The custom mutator crashed, fallback to the built-in one.
+		w.mutatorCrashes++
+		if w.mutatorCrashes == maxMutatorCrashes {
+			log.Printf("worker %v: custom mutator crashed %v times, disabling it (use -v=1 to see crash output)", w.id, w.mutatorCrashes)
+			w.customMutator = false
+			w.customCrossOver = false
+		}
+		return m.mutate(input.data, ro), input.depth + 1
+	}
+	return data, input.depth + 1
+}
+
+// generateProto mutates a corpus input as a -prototype protobuf message.
+// Inputs that are not valid messages are mutated with the built-in mutator.
+func (w *Worker) generateProto(ro *ROData) ([]byte, int) {
+	m := w.mutator
+	input := m.chooseFuzzInput(ro)
+	pm := &protomut.Mutator{
+		Type: w.hub.protoType,
+		Rand: m.r,
+		MutateBytes: func(data []byte) []byte {
+			return m.mutate(data, ro)
+		},
+	}
+	// Sub-messages can be swapped with sub-messages of few other corpus inputs.
+	donors := [][]byte{m.chooseInput(ro).data, m.chooseInput(ro).data}
+	data, ok := pm.Mutate(input.data, donors)
+	if !ok {
+		return m.mutate(input.data, ro), input.depth + 1
+	}
+	m.ops = m.ops[:0] // the input is not produced by the built-in operators alone
+	if len(data) > MaxInputSize {
+		data = data[:MaxInputSize]
+	}
+	return data, input.depth + 1
+}
+
+// generateJSON mutates a corpus input as JSON.
+// Inputs that are not valid JSON are mutated with the built-in mutator.
+func (w *Worker) generateJSON(ro *ROData) ([]byte, int) {
+	m := w.mutator
+	input := m.chooseFuzzInput(ro)
+	jm := &jsonmut.Mutator{
+		Rand: m.r,
+		Dict: w.hub.jsonDict,
+	}
+	// Subtrees can be spliced from few other corpus inputs.
+	donors := [][]byte{m.chooseInput(ro).data, m.chooseInput(ro).data}
+	data, ok := jm.Mutate(input.data, donors)
+	if !ok {
+		return m.mutate(input.data, ro), input.depth + 1
+	}
+	m.ops = m.ops[:0]
+	if len(data) > MaxInputSize {
+		data = data[:MaxInputSize]
+	}
+	return data, input.depth + 1
+}
+
+// generateGrammar produces a new input from the -grammar: either a fresh random derivation,
+// or a mutation of derivation tree of a corpus input.
+func (w *Worker) generateGrammar(ro *ROData) ([]byte, int) {
+	m := w.mutator
+	g := w.hub.grammar
+	var data []byte
+	depth := 0
+	input := m.chooseFuzzInput(ro)
+	if input.tree == nil || m.rand(10) == 0 {
+		data = g.Generate(m.r).Bytes()
+		m.input = -1
+	} else {
+		// Subtrees can be spliced from few other corpus inputs.
+		var others []*grammar.Node
+		for i := 0; i < 3; i++ {
+			if tree := m.chooseInput(ro).tree; tree != nil {
+				others = append(others, tree)
+			}
+		}
+		data = g.Mutate(m.r, input.tree, others).Bytes()
+		depth = input.depth + 1
+	}
+	if len(data) > MaxInputSize {
+		data = data[:MaxInputSize]
+	}
+	return data, depth
+}
+
 // triageInput processes every new input.
 // It calculates per-input metrics like execution time, coverage mask,
 // and minimizes the input to the minimal input with the same coverage.
@@ -271,11 +450,12 @@ func (w *Worker) triageInput(input CoordinatorInput) {
 		depth:    int(input.Prio),
 		typ:      input.Type,
 		execTime: 1 << 60,
+		alloc:    1 << 60,
 	}
-	// Calculate min exec time, min coverage and max result of 3 runs.
+	// Calculate min exec time, min allocations, max coverage and max result of 3 runs.
 	for i := 0; i < 3; i++ {
 		w.execs[execTriageInput]++
-		res, ns, cover, _, output, crashed, hanged := w.coverBin.test(inp.data)
+		res, ns, alloc, cover, _, output, crashed, hanged := w.coverBin.test(inp.data)
 		if crashed {
 			// Inputs in corpus should not crash.
 			w.noteCrasher(inp.data, output, hanged)
@@ -298,6 +478,9 @@ func (w *Worker) triageInput(input CoordinatorInput) {
 		if inp.execTime > ns {
 			inp.execTime = ns
 		}
+		if inp.alloc > alloc {
+			inp.alloc = alloc
+		}
 	}
 	if !input.Minimized {
 		inp.mine = true
@@ -307,19 +490,25 @@ func (w *Worker) triageInput(input CoordinatorInput) {
 		// Here we use corpusCover, because maxCover already includes the input coverage.
 		newCover, ok := findNewCover(ro.corpusCover, inp.cover)
 		if !ok {
-			return // covered by somebody else
-		}
-		inp.data = w.minimizeInput(inp.data, false, func(candidate, cover, output []byte, res int, crashed, hanged bool) bool {
-			if crashed {
-				w.noteCrasher(candidate, output, hanged)
-				return false
+			// The input can still set new resource usage maxima.
+			// Such inputs are not minimized, since minimization tends to lose
+			// exactly the parts that make the input slow or allocation-heavy.
+			if ro.resources == nil || !ro.resources.improves(inp.cover, inp.execTime, inp.alloc) {
+				return // covered by somebody else
 			}
-			if inp.res != res || worseCover(newCover, cover) {
-				w.noteNewInput(candidate, cover, res, inp.depth+1, execMinimizeInput)
-				return false
-			}
-			return true
-		})
+		} else {
+			inp.data = w.minimizeInput(inp.data, false, func(candidate, cover, output []byte, res int, crashed, hanged bool) bool {
+				if crashed {
+					w.noteCrasher(candidate, output, hanged)
+					return false
+				}
+				if inp.res != res || worseCover(newCover, cover) {
+					w.noteNewInput(candidate, cover, res, inp.depth+1, execMinimizeInput)
+					return false
+				}
+				return true
+			})
+		}
 	} else if !input.Smashed {
 		w.smash(inp.data, inp.depth)
 	}
@@ -329,7 +518,7 @@ func (w *Worker) triageInput(input CoordinatorInput) {
 			inp.coverSize++
 		}
 	}
-	w.hub.newInputC <- inp
+	w.hub.newInput(inp)
 }
 
 // processCrasher minimizes new crashers and sends them to the hub.
@@ -349,7 +538,13 @@ func (w *Worker) processCrasher(crash NewCrasherArgs) {
 			return true
 		})
 	}
-	w.hub.newCrasherC <- crash
+	w.hub.newCrasher(crash)
+}
+
+// minimizeExpired says if the time limit for minimization that started at start is exceeded.
+// Minimization is not limited in -deterministic mode.
+func minimizeExpired(start time.Time) bool {
+	return !*flagDeterministic && time.Since(start) > *flagMinimize
 }
 
 // minimizeInput applies series of minimizing transformations to data
@@ -366,12 +561,12 @@ func (w *Worker) minimizeInput(data []byte, canonicalize bool, pred func(candida
 	// First, try to cut tail.
 	for n := 1024; n != 0; n /= 2 {
 		for len(res) > n {
-			if time.Since(start) > *flagMinimize {
+			if minimizeExpired(start) {
 				return res
 			}
 			candidate := res[:len(res)-n]
 			*stat++
-			result, _, cover, _, output, crashed, hanged := w.coverBin.test(candidate)
+			result, _, _, cover, _, output, crashed, hanged := w.coverBin.test(candidate)
 			if !pred(candidate, cover, output, result, crashed, hanged) {
 				break
 			}
@@ -382,14 +577,14 @@ func (w *Worker) minimizeInput(data []byte, canonicalize bool, pred func(candida
 	// Then, try to remove each individual byte.
 	tmp := make([]byte, len(res))
 	for i := 0; i < len(res); i++ {
-		if time.Since(start) > *flagMinimize {
+		if minimizeExpired(start) {
 			return res
 		}
 		candidate := tmp[:len(res)-1]
 		copy(candidate[:i], res[:i])
 		copy(candidate[i:], res[i+1:])
 		*stat++
-		result, _, cover, _, output, crashed, hanged := w.coverBin.test(candidate)
+		result, _, _, cover, _, output, crashed, hanged := w.coverBin.test(candidate)
 		if !pred(candidate, cover, output, result, crashed, hanged) {
 			continue
 		}
@@ -401,13 +596,13 @@ func (w *Worker) minimizeInput(data []byte, canonicalize bool, pred func(candida
 	for i := 0; i < len(res)-1; i++ {
 		copy(tmp, res[:i])
 		for j := len(res); j > i+1; j-- {
-			if time.Since(start) > *flagMinimize {
+			if minimizeExpired(start) {
 				return res
 			}
 			candidate := tmp[:len(res)-j+i]
 			copy(candidate[i:], res[j:])
 			*stat++
-			result, _, cover, _, output, crashed, hanged := w.coverBin.test(candidate)
+			result, _, _, cover, _, output, crashed, hanged := w.coverBin.test(candidate)
 			if !pred(candidate, cover, output, result, crashed, hanged) {
 				continue
 			}
@@ -422,14 +617,14 @@ func (w *Worker) minimizeInput(data []byte, canonicalize bool, pred func(candida
 			if res[i] == '0' {
 				continue
 			}
-			if time.Since(start) > *flagMinimize {
+			if minimizeExpired(start) {
 				return res
 			}
 			candidate := tmp[:len(res)]
 			copy(candidate, res)
 			candidate[i] = '0'
 			*stat++
-			result, _, cover, _, output, crashed, hanged := w.coverBin.test(candidate)
+			result, _, _, cover, _, output, crashed, hanged := w.coverBin.test(candidate)
 			if !pred(candidate, cover, output, result, crashed, hanged) {
 				continue
 			}
@@ -581,45 +776,151 @@ func (w *Worker) smash(data []byte, depth int) {
 	}
 
 	// Do a bunch of random mutations so that this input catches up with the rest.
+	w.mutator.input = -1 // the input is not in corpus yet
 	for i := 0; i < 1e4; i++ {
 		tmp := w.mutator.mutate(data, ro)
-		w.testInput(tmp, depth+1, execFuzz)
+		found := w.testInput(tmp, depth+1, execFuzz)
+		w.mutator.credit(found)
 	}
 }
 
-func (w *Worker) testInput(data []byte, depth int, typ execType) {
-	w.testInputImpl(w.coverBin, data, depth, typ)
+// testInput executes the input and returns true if it gives new coverage.
+func (w *Worker) testInput(data []byte, depth int, typ execType) bool {
+	_, found := w.testInputImpl(w.coverBin, data, depth, typ)
+	return found
 }
 
 func (w *Worker) testInputSonar(data []byte, depth int) (sonar []byte) {
-	return w.testInputImpl(w.sonarBin, data, depth, execSonar)
+	sonar, _ = w.testInputImpl(w.sonarBin, data, depth, execSonar)
+	return sonar
 }
 
-func (w *Worker) testInputImpl(bin *TestBinary, data []byte, depth int, typ execType) (sonar []byte) {
+func (w *Worker) testInputImpl(bin *TestBinary, data []byte, depth int, typ execType) (sonar []byte, found bool) {
 	ro := w.hub.ro.Load().(*ROData)
 	if len(ro.badInputs) > 0 {
 		if _, ok := ro.badInputs[hash(data)]; ok {
-			return nil // no, thanks
+			return nil, false // no, thanks
 		}
 	}
 	w.execs[typ]++
-	res, _, cover, sonar, output, crashed, hanged := bin.test(data)
+	test := bin.test
+	if typ == execSonar {
+		test = bin.testSonar
+	}
+	res, ns, alloc, cover, sonar, output, crashed, hanged := test(data)
 	if crashed {
 		w.noteCrasher(data, output, hanged)
-		return nil
+		return nil, false
 	}
-	w.noteNewInput(data, cover, res, depth, typ)
-	return sonar
+	if typ != execSonar && ro.slowExecTime != 0 && ns > ro.slowExecTime {
+		// noteSlowInput reruns the input and overwrites sonar and cover regions.
+		// Slow inputs are rare, so copying is fine.
+		sonar = makeCopy(sonar)
+		cover = makeCopy(cover)
+		w.noteSlowInput(bin, data, cover, ns, ro)
+	}
+	if w.hub.schedule.edges {
+		w.sampleEdges(ro, cover, typ)
+	}
+	found = w.noteNewInput(data, cover, res, depth, typ)
+	if !found && typ != execSonar && res >= 0 &&
+		ro.resources != nil && ro.resources.improves(cover, ns, alloc) && w.noteTriageResources(cover, ns, alloc) {
+		w.triageQueue = append(w.triageQueue, CoordinatorInput{makeCopy(data), uint64(depth), typ, false, false})
+	}
+	return sonar, found
 }
 
-func (w *Worker) noteNewInput(data, cover []byte, res, depth int, typ execType) {
+// noteTriageResources accounts resource usage of an input queued for triage.
+// It returns false if an already queued input has the same or larger usage for all edges,
+// so that timing jitter does not queue the same edges until the hub publishes new maxima.
+func (w *Worker) noteTriageResources(cover []byte, ns, alloc uint64) bool {
+	if w.triageResources == nil {
+		w.triageResources = newResources()
+	}
+	if !w.triageResources.improves(cover, ns, alloc) {
+		return false
+	}
+	w.triageResources.update(cover, ns, alloc)
+	return true
+}
+
+// noteFuzzed accounts fuzzing of the corpus input chosen by the last chooseFuzzInput call.
+func (w *Worker) noteFuzzed() {
+	idx := w.mutator.input
+	if idx < 0 {
+		return
+	}
+	for len(w.stats.fuzzed) <= idx {
+		w.stats.fuzzed = append(w.stats.fuzzed, 0)
+	}
+	w.stats.fuzzed[idx]++
+}
+
+// sampleEdges accounts hits of covered edges for power schedules on every edgeSampleRate-th execution.
+// With the entropy schedule rare edges hit by mutants are also accounted to the mutated corpus input.
+func (w *Worker) sampleEdges(ro *ROData, cover []byte, typ execType) {
+	w.edgeSamples++
+	if w.edgeSamples%edgeSampleRate != 0 {
+		return
+	}
+	if w.stats.edgeHits == nil {
+		w.stats.edgeHits = make([]uint32, CoverSize)
+	}
+	parent := -1
+	if w.hub.schedule.species && ro.edgeHits != nil && (typ == execFuzz || typ == execGrammar) {
+		parent = w.mutator.input
+	}
+	var species map[int]uint32
+	for e, c := range cover {
+		if c == 0 {
+			continue
+		}
+		w.stats.edgeHits[e]++
+		if parent < 0 || ro.edgeHits[e] >= rareEdgeHits {
+			continue
+		}
+		if species == nil {
+			if w.stats.species == nil {
+				w.stats.species = make(map[int]map[int]uint32)
+			}
+			species = w.stats.species[parent]
+			if species == nil {
+				species = make(map[int]uint32)
+				w.stats.species[parent] = species
+			}
+		}
+		species[e]++
+	}
+}
+
+// noteSlowInput reruns a slow input to make sure that the slowness is not due to noise
+// (e.g. the machine being overloaded), and reports it to the hub.
+func (w *Worker) noteSlowInput(bin *TestBinary, data, cover []byte, ns uint64, ro *ROData) {
+	_, ns1, _, _, _, output, crashed, hanged := bin.test(data)
+	if crashed {
+		w.noteCrasher(data, output, hanged)
+		return
+	}
+	if ns1 <= ro.slowExecTime {
+		return
+	}
+	if ns > ns1 {
+		ns = ns1
+	}
+	w.hub.newSlowInput(NewSlowInputArgs{makeCopy(data), ns, ro.avgExecTime, coverSig(cover)})
+}
+
+// noteNewInput queues the input for triage if it gives new coverage.
+func (w *Worker) noteNewInput(data, cover []byte, res, depth int, typ execType) bool {
 	if res < 0 {
 		// User said to not add this input to corpus.
-		return
+		return false
 	}
-	if w.hub.updateMaxCover(cover) {
-		w.triageQueue = append(w.triageQueue, CoordinatorInput{makeCopy(data), uint64(depth), typ, false, false})
+	if !w.hub.updateMaxCover(cover) {
+		return false
 	}
+	w.triageQueue = append(w.triageQueue, CoordinatorInput{makeCopy(data), uint64(depth), typ, false, false})
+	return true
 }
 
 func (w *Worker) noteCrasher(data, output []byte, hanged bool) {
@@ -633,38 +934,81 @@ func (w *Worker) noteCrasher(data, output []byte, hanged bool) {
 		Error:       output,
 		Suppression: supp,
 		Hanging:     hanged,
+		Type:        crasherType(supp, hanged),
 	})
 }
 
+// crasherType classifies crash by its suppression.
+func crasherType(supp []byte, hanged bool) string {
+	switch {
+	case hanged:
+		return "hang"
+	case bytes.HasPrefix(supp, []byte("out of memory: ")),
+		bytes.HasPrefix(supp, []byte("fatal error: runtime: out of memory")),
+		bytes.HasSuffix(bytes.TrimSpace(supp), []byte("signal: killed")):
+		// Testee that is killed but not hanged is most likely killed by the OOM killer.
+		return "oom"
+	case bytes.HasPrefix(supp, []byte("WARNING: DATA RACE")):
+		return "race"
+	case bytes.HasPrefix(supp, []byte("goroutine leak: ")):
+		return "leak"
+	default:
+		return "crash"
+	}
+}
+
 func (w *Worker) periodicCheck() {
 	if atomic.LoadUint32(&shutdown) != 0 {
 		w.shutdown()
 		select {}
 	}
+	if *flagDeterministic {
+		// Stats are synced and scores are updated after a fixed number of executions
+		// rather than periodically, so that nothing depends on wall-clock time.
+		w.checks++
+		if w.checks%deterministicSyncPeriod == 0 {
+			w.syncStats()
+		}
+		if w.checks%deterministicScorePeriod == 0 {
+			w.hub.refreshScores()
+		}
+		return
+	}
 	if time.Since(w.lastSync) < syncPeriod {
 		return
 	}
-	w.execs[execTotal] += w.stats.execs
 	w.lastSync = time.Now()
-	w.hub.syncC <- w.stats
-	w.stats.execs = 0
-	w.stats.restarts = 0
+	w.syncStats()
+}
+
+// syncStats passes accumulated stats to the hub.
+func (w *Worker) syncStats() {
+	w.execs[execTotal] += w.stats.execs
+	w.stats.mutations = w.mutator.stats
+	w.hub.newStats(w.stats)
+	w.stats = Stats{}
+	w.mutator.stats = MutationStats{}
 	if *flagV >= 2 {
-		log.Printf("worker %v: triageq=%v execs=%v mininp=%v mincrash=%v triage=%v fuzz=%v versifier=%v smash=%v sonar=%v hint=%v",
+		log.Printf("worker %v: triageq=%v execs=%v mininp=%v mincrash=%v triage=%v fuzz=%v versifier=%v smash=%v grammar=%v sonar=%v hint=%v",
 			w.id, len(w.triageQueue),
 			w.execs[execTotal], w.execs[execMinimizeInput], w.execs[execMinimizeCrasher],
 			w.execs[execTriageInput], w.execs[execFuzz], w.execs[execVersifier], w.execs[execSmash],
-			w.execs[execSonar], w.execs[execSonarHint])
+			w.execs[execGrammar], w.execs[execSonar], w.execs[execSonarHint])
 	}
 }
 
 // shutdown cleanups after worker, it is not guaranteed to be called.
 func (w *Worker) shutdown() {
 	w.coverBin.close()
-	w.sonarBin.close()
+	if w.sonarBin != w.coverBin {
+		w.sonarBin.close()
+	}
 }
 
 func extractSuppression(out []byte) []byte {
+	if supp := extractRaceSuppression(out); supp != nil {
+		return supp
+	}
 	var supp []byte
 	seenPanic := false
 	collect := false
@@ -673,6 +1017,8 @@ func extractSuppression(out []byte) []byte {
 		line := s.Text()
 		if !seenPanic && (strings.HasPrefix(line, "panic: ") ||
 			strings.HasPrefix(line, "fatal error: ") ||
+			strings.HasPrefix(line, "goroutine leak: ") ||
+			strings.HasPrefix(line, "out of memory: ") ||
 			strings.HasPrefix(line, "SIG") && strings.Index(line, ": ") != 0) {
 			// Start of a crash message.
 			seenPanic = true
@@ -711,6 +1057,65 @@ func extractSuppression(out []byte) []byte {
 	return supp
 }
 
+// extractRaceSuppression extracts suppression from a race detector report:
+//	==================
+//	WARNING: DATA RACE
+//	Write at 0x00c0000b4010 by goroutine 7:
+//	  foo.bar()
+//	      /foo/bar.go:10 +0x3a
+//
+//	Previous read at 0x00c0000b4010 by main goroutine:
+//	  foo.baz()
+//	      /foo/bar.go:20 +0x4b
+//	...
+// The suppression consists of access types and function names of both racing stacks,
+// addresses and goroutine ids are omitted as they are different on every run.
+// Returns nil if out does not contain a race report.
+func extractRaceSuppression(out []byte) []byte {
+	var supp []byte
+	stacks := 0
+	collect := false
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		if supp == nil {
+			if line == "WARNING: DATA RACE" {
+				supp = append(supp, line...)
+				supp = append(supp, '\n')
+			}
+			continue
+		}
+		if !collect {
+			// Access header: "Write at 0x... by goroutine 7:".
+			idx := strings.Index(line, " at 0x")
+			if idx == -1 || !strings.HasSuffix(line, ":") {
+				continue
+			}
+			supp = append(supp, line[:idx]...)
+			supp = append(supp, '\n')
+			collect = true
+			continue
+		}
+		if line == "" {
+			// End of the stack.
+			collect = false
+			if stacks++; stacks == 2 {
+				break
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   ") {
+			// Function name line.
+			line = line[2:]
+			if idx := strings.LastIndex(line, "("); idx != -1 {
+				supp = append(supp, line[:idx]...)
+				supp = append(supp, '\n')
+			}
+		}
+	}
+	return supp
+}
+
 func reverse(data []byte) []byte {
 	tmp := make([]byte, len(data))
 	for i, v := range data {
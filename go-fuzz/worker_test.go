@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/binary"
 	"math"
 	"testing"
+
+	. "github.com/dvyukov/go-fuzz/go-fuzz-defs"
 )
 
 func TestIncrementDecrement(t *testing.T) {
@@ -25,3 +28,173 @@ func TestIncrementDecrement(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractRaceSuppression(t *testing.T) {
+	report := func(addr, gid string) []byte {
+		return []byte(`==================
+WARNING: DATA RACE
+Write at ` + addr + ` by goroutine ` + gid + `:
+  github.com/foo/bar.(*Parser).next()
+      /gopath/src/github.com/foo/bar/parser.go:10 +0x3a
+  github.com/foo/bar.Fuzz.func1()
+      /gopath/src/github.com/foo/bar/fuzz.go:7 +0x4f
+
+Previous read at ` + addr + ` by main goroutine:
+  github.com/foo/bar.Fuzz()
+      /gopath/src/github.com/foo/bar/fuzz.go:12 +0x9e
+  go-fuzz-dep.Main()
+      /tmp/go-fuzz-build/goroot/src/go-fuzz-dep/main.go:36 +0x1a0
+
+Goroutine ` + gid + ` (running) created at:
+  github.com/foo/bar.Fuzz()
+      /gopath/src/github.com/foo/bar/fuzz.go:6 +0x86
+==================
+exit status 66`)
+	}
+	want := `WARNING: DATA RACE
+Write
+github.com/foo/bar.(*Parser).next
+github.com/foo/bar.Fuzz.func1
+Previous read
+github.com/foo/bar.Fuzz
+go-fuzz-dep.Main
+`
+	supp1 := extractSuppression(report("0x00c0000b4010", "7"))
+	if string(supp1) != want {
+		t.Fatalf("bad suppression:\n%s\nwant:\n%s", supp1, want)
+	}
+	supp2 := extractSuppression(report("0x00c00001a0f8", "19"))
+	if string(supp1) != string(supp2) {
+		t.Fatalf("suppression depends on addresses and goroutine ids:\n%s\n%s", supp1, supp2)
+	}
+	if supp := extractRaceSuppression([]byte("panic: foo\n\ngoroutine 1 [running]:\nmain.main()\n")); supp != nil {
+		t.Fatalf("extracted race suppression from a panic: %q", supp)
+	}
+}
+
+func TestExtractLeakSuppression(t *testing.T) {
+	out := []byte(`goroutine leak: fuzz function returned leaving running goroutines
+leaked goroutines: 2
+
+goroutine 18 [chan receive]:
+github.com/foo/bar.(*Conn).readLoop(0xc000010000)
+	/gopath/src/github.com/foo/bar/conn.go:42 +0x5d
+created by github.com/foo/bar.Fuzz in goroutine 1
+	/gopath/src/github.com/foo/bar/fuzz.go:9 +0x8f
+
+goroutine 19 [select]:
+github.com/foo/bar.(*Conn).writeLoop(0xc000010000)
+	/gopath/src/github.com/foo/bar/conn.go:60 +0x7a
+exit status 1`)
+	want := `goroutine leak: fuzz function returned leaving running goroutines
+github.com/foo/bar.(*Conn).readLoop
+`
+	if supp := extractSuppression(out); string(supp) != want {
+		t.Fatalf("bad suppression:\n%s\nwant:\n%s", supp, want)
+	}
+}
+
+func TestCrasherType(t *testing.T) {
+	tests := []struct {
+		out    string
+		hanged bool
+		typ    string
+	}{
+		{"panic: foo\n\ngoroutine 1 [running]:\nmain.main()\n", false, "crash"},
+		{"SIGABRT: abort\n", true, "hang"},
+		{"out of memory: heap growth exceeds -memlimit\nheap growth: 2048 MB, limit: 1024 MB\n\n" +
+			"2147483648 bytes in 1 objects:\nfoo.bar(...)\n\t/foo/bar.go:10\n", false, "oom"},
+		{"fatal error: runtime: out of memory\n\ngoroutine 1 [running]:\nmain.main()\n", false, "oom"},
+		{"some output\nsignal: killed\n", false, "oom"},
+		{"==================\nWARNING: DATA RACE\nWrite at 0x1 by goroutine 7:\n  foo.bar()\n", false, "race"},
+		{"goroutine leak: fuzz function returned leaving running goroutines\n\ngoroutine 18 [select]:\nfoo.bar()\n", false, "leak"},
+	}
+	for _, test := range tests {
+		if typ := crasherType(extractSuppression([]byte(test.out)), test.hanged); typ != test.typ {
+			t.Errorf("crasherType(%q) = %q, want %q", test.out, typ, test.typ)
+		}
+	}
+}
+
+func TestCustomMutatorFallback(t *testing.T) {
+	defer func(v float64) { *flagCustomMutator = v }(*flagCustomMutator)
+	*flagCustomMutator = 1
+	ro := &ROData{}
+	for i, data := range []string{"foo", "bar"} {
+		ro.corpus = append(ro.corpus, Input{data: []byte(data), score: 1, runningScoreSum: i + 1})
+	}
+	var calls [2]int
+	crash := false
+	w := &Worker{
+		hub:             &Hub{},
+		mutator:         newMutator(),
+		customMutator:   true,
+		customCrossOver: true,
+		customMutate: func(cmd uint8, data, data2 []byte, seed uint64, maxSize int) []byte {
+			if cmd == CmdCrossOver {
+				calls[1]++
+			} else {
+				calls[0]++
+			}
+			if crash {
+				return nil
+			}
+			return []byte("custom")
+		},
+	}
+	for i := 0; i < 100; i++ {
+		if data, _ := w.generate(ro); string(data) != "custom" {
+			t.Fatalf("input is not produced by the custom mutator: %q", data)
+		}
+	}
+	if calls[0] == 0 || calls[1] == 0 || calls[0]+calls[1] != 100 {
+		t.Fatalf("bad custom mutator calls (mutate/crossover): %v", calls)
+	}
+	// Crashing custom mutator is disabled after maxMutatorCrashes crashes,
+	// inputs are produced by the built-in mutator meanwhile.
+	crash = true
+	calls = [2]int{}
+	for i := 0; i < 100; i++ {
+		if data, _ := w.generate(ro); string(data) == "custom" {
+			t.Fatalf("crashed custom mutator produced an input")
+		}
+	}
+	if calls[0]+calls[1] != maxMutatorCrashes || w.mutatorCrashes != maxMutatorCrashes {
+		t.Fatalf("custom mutator is called %v times and crashed %v times, want %v", calls, w.mutatorCrashes, maxMutatorCrashes)
+	}
+	if w.customMutator || w.customCrossOver {
+		t.Fatalf("custom mutator is not disabled")
+	}
+}
+
+func TestNoteTriageResources(t *testing.T) {
+	w := &Worker{}
+	cover := make([]byte, CoverSize)
+	cover[1] = 1
+	if !w.noteTriageResources(cover, 1<<20, 0) {
+		t.Fatalf("first input is not queued")
+	}
+	// Timing jitter within the same bucket does not queue the edge again.
+	if w.noteTriageResources(cover, 1<<20+1000, 0) {
+		t.Errorf("input with the same time bucket is queued")
+	}
+	if !w.noteTriageResources(cover, 1<<22, 0) {
+		t.Errorf("input with a larger time bucket is not queued")
+	}
+	cover[2] = 1
+	if !w.noteTriageResources(cover, 1<<20, 0) {
+		t.Errorf("input with a new edge is not queued")
+	}
+}
+
+func TestRaceGoroutineLimit(t *testing.T) {
+	// Messages printed by different versions of race runtime.
+	for _, out := range []string{
+		"race: limit on 8128 simultaneously alive goroutines is exceeded, dying\n",
+		"race: limit on 8192 simultaneously alive goroutines is exceeded, dying\n",
+	} {
+		if !bytes.Contains([]byte(out), raceGoroutineLimit) {
+			t.Errorf("goroutine limit is not detected in %q", out)
+		}
+	}
+}
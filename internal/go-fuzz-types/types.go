@@ -25,4 +25,17 @@ type MetaData struct {
 	Sonar       []CoverBlock
 	Funcs       []string // fuzz function names; must have length > 0
 	DefaultFunc string   // default function to fuzz
+	Race        bool     // binaries are built with race detector
+	PkgPath     string   // import path of the package with fuzz functions
+	PkgName     string   // name of the package with fuzz functions
+
+	CustomMutator   bool // package has FuzzMutate function
+	CustomCrossOver bool // package has FuzzCrossOver function
+}
+
+// GenRecord is an input produced by a generator built with go-fuzz/gen package.
+// Generators started by go-fuzz -gen stream gob-encoded records to stdout.
+type GenRecord struct {
+	Data []byte
+	Hint []byte // decimal priority of the input, optional
 }
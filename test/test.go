@@ -6,6 +6,7 @@ package test
 import (
 	"bytes"
 	"runtime"
+	"strings"
 
 	// Test vendoring support.
 	vendored_foo "non.existent.com/foo"
@@ -199,3 +200,46 @@ func shadowedBool() {
 	}
 	_ = bool
 }
+
+type keyword string
+
+var keywords = map[string]int{"func": 1, "var": 2}
+var namedKeywords = map[keyword]bool{"if": true}
+var codes = map[uint16]string{200: "OK"}
+
+type lexer struct {
+	tab map[string]int
+}
+
+func mapIndex(l *lexer, ident string, code uint16) int {
+	if keywords[ident] != 0 {
+		return 1
+	}
+	if _, ok := namedKeywords[keyword(ident)]; ok {
+		return 2
+	}
+	if codes[code] == "OK" {
+		return 3
+	}
+	l.tab[ident]++
+	l.tab[ident] = keywords[ident] + l.tab[ident+"x"]
+	keywords[ident] += 1
+	return l.tab[ident]
+}
+
+func libraryCmp(data []byte, s string) int {
+	if bytes.Equal(data[:4], []byte("\x89PNG")) || bytes.HasPrefix(data, []byte("GIF8")) {
+		return 1
+	}
+	if strings.HasSuffix(s, ".tar.gz") || strings.EqualFold(s, "Content-Type") || strings.HasPrefix("const", "c") {
+		return 2
+	}
+	if strings.Contains(s, "://") && bytes.Index(data, []byte{0xff, 0xd8}) > 0 {
+		return 3
+	}
+	return bytes.Compare(data, []byte(s)) + strings.Compare(s, "abc")
+}
+
+func bitfields(b []byte, x ChanDir, v int16) bool {
+	return (b[0]>>4)&7 == 5 || b[1]&0x0f != 8 || x&SEND == SEND || (v>>8)&0x7f == 0x12 || v>>12 == -1
+}